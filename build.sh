@@ -23,4 +23,5 @@ rm -rf ./bin
 
 # Build and install the necessary binaries for scripts to run
 go get github.com/go-ini/ini
+go get google.golang.org/grpc google.golang.org/protobuf/encoding/protowire
 go install ./...
@@ -0,0 +1,82 @@
+package mydynamo
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+//Makes the node serving on self a member of the cluster seeds belong to, used
+//by a node that runs in its own process. The seeds are asked for the members
+//they know. When one answers with members, self joins them through it, or
+//rejoins if it is already one of them because its process restarted. When
+//every other seed answers that it has no members yet, or BOOTSTRAP_TIMEOUT
+//passes, the cluster is started with the seeds and self as its members. Nodes
+//started with the same seeds therefore agree on the members
+func BootstrapNode(self DynamoNode, seeds []DynamoNode) error {
+	local := NewDynamoRPCClient(memberKey(self))
+	defer local.CleanConn()
+
+	initial := append([]DynamoNode{}, seeds...)
+	if !containsNode(initial, self) {
+		initial = append(initial, self)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(BOOTSTRAP_TIMEOUT)*time.Millisecond)
+	defer cancel()
+	for ctx.Err() == nil {
+		answered := 0
+		for _, seed := range seeds {
+			if seed.Equals(self) {
+				continue
+			}
+			members, err := seedMembers(ctx, seed)
+			if err != nil {
+				continue
+			}
+			answered++
+			if len(members) == 0 {
+				continue
+			}
+			method := "MyDynamo.Join"
+			if containsNode(members, self) {
+				method = "MyDynamo.Rejoin"
+			}
+			log.Println(DYNAMO_SERVER, "calling", method, "through seed", seed)
+			return local.callCtx(context.Background(), method, seed, &Empty{})
+		}
+		if answered == len(initial)-1 {
+			// every other seed is starting as well
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(BOOTSTRAP_RETRY_INTERVAL) * time.Millisecond):
+		}
+	}
+	log.Println(DYNAMO_SERVER, "starting a cluster of", initial)
+	return local.callCtx(context.Background(), "MyDynamo.SendPreferenceList", initial, &Empty{})
+}
+
+//Returns the members seed knows, with a single try bounded by requestTimeout
+func seedMembers(ctx context.Context, seed DynamoNode) ([]DynamoNode, error) {
+	client := NewDynamoRPCClient(memberKey(seed))
+	defer client.CleanConn()
+	client.Retry.MaxAttempts = 1
+	client.Retry.AttemptTimeout = requestTimeout
+	var members []DynamoNode
+	if err := client.callCtx(ctx, "MyDynamo.Members", Empty{}, &members); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+//Returns true if node is one of nodes
+func containsNode(nodes []DynamoNode, node DynamoNode) bool {
+	for _, other := range nodes {
+		if other.Equals(node) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,563 @@
+package mydynamo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//The kind of conflict-free replicated data type an ObjectEntry holds. Entries
+//holding a CRDT are merged instead of kept as siblings, so concurrent updates
+//converge without help from the client
+type CRDTType int
+
+const (
+	CRDT_NONE CRDTType = iota // a plain []byte value
+	CRDT_G_COUNTER
+	CRDT_PN_COUNTER
+	CRDT_OR_SET
+	CRDT_LWW_REGISTER
+	CRDT_MAP
+)
+
+func (kind CRDTType) String() string {
+	switch kind {
+	case CRDT_G_COUNTER:
+		return "g-counter"
+	case CRDT_PN_COUNTER:
+		return "pn-counter"
+	case CRDT_OR_SET:
+		return "or-set"
+	case CRDT_LWW_REGISTER:
+		return "lww-register"
+	case CRDT_MAP:
+		return "map"
+	default:
+		return "value"
+	}
+}
+
+//A state-based CRDT. Merge folds other, which must be of the same type, into
+//the receiver. Merging is commutative, associative and idempotent
+type CRDT interface {
+	Type() CRDTType
+	Merge(other CRDT) error
+}
+
+//A grow-only counter: one count per node, summed
+type GCounter struct {
+	Counts map[string]uint64
+}
+
+func NewGCounter() *GCounter {
+	return &GCounter{Counts: make(map[string]uint64)}
+}
+
+func (c *GCounter) Type() CRDTType {
+	return CRDT_G_COUNTER
+}
+
+//Adds delta to node's count
+func (c *GCounter) Increment(node string, delta uint64) {
+	c.Counts[node] += delta
+}
+
+func (c *GCounter) Value() uint64 {
+	var total uint64
+	for _, count := range c.Counts {
+		total += count
+	}
+	return total
+}
+
+func (c *GCounter) Merge(other CRDT) error {
+	o, ok := other.(*GCounter)
+	if !ok {
+		return mismatchError(c, other)
+	}
+	c.merge(o)
+	return nil
+}
+
+func (c *GCounter) merge(o *GCounter) {
+	for node, count := range o.Counts {
+		if count > c.Counts[node] {
+			c.Counts[node] = count
+		}
+	}
+}
+
+//A counter that can go up and down, kept as one G-Counter of increments and
+//one of decrements
+type PNCounter struct {
+	P *GCounter
+	N *GCounter
+}
+
+func NewPNCounter() *PNCounter {
+	return &PNCounter{P: NewGCounter(), N: NewGCounter()}
+}
+
+func (c *PNCounter) Type() CRDTType {
+	return CRDT_PN_COUNTER
+}
+
+//Adds delta, which may be negative, to node's count
+func (c *PNCounter) Increment(node string, delta int64) {
+	if delta >= 0 {
+		c.P.Increment(node, uint64(delta))
+	} else {
+		c.N.Increment(node, uint64(-delta))
+	}
+}
+
+func (c *PNCounter) Value() int64 {
+	return int64(c.P.Value()) - int64(c.N.Value())
+}
+
+func (c *PNCounter) Merge(other CRDT) error {
+	o, ok := other.(*PNCounter)
+	if !ok {
+		return mismatchError(c, other)
+	}
+	c.P.merge(o.P)
+	c.N.merge(o.N)
+	return nil
+}
+
+//An observed-remove set. Every add tags the element with a unique tag, and a
+//remove discards the tags it has seen, so an add concurrent with a remove wins.
+//Removed tags are kept forever so that a late copy of the add can not revive it
+type ORSet struct {
+	Adds    map[string]map[string]bool // element -> tags of the adds seen
+	Removed map[string]bool            // tags of the adds that were removed
+}
+
+func NewORSet() *ORSet {
+	return &ORSet{
+		Adds:    make(map[string]map[string]bool),
+		Removed: make(map[string]bool),
+	}
+}
+
+func (s *ORSet) Type() CRDTType {
+	return CRDT_OR_SET
+}
+
+//Adds element under tag, which must never have been used before
+func (s *ORSet) Add(element string, tag string) {
+	if s.Adds[element] == nil {
+		s.Adds[element] = make(map[string]bool)
+	}
+	s.Adds[element][tag] = true
+}
+
+//Removes element as far as this replica has seen it
+func (s *ORSet) Remove(element string) {
+	for tag := range s.Adds[element] {
+		s.Removed[tag] = true
+	}
+	delete(s.Adds, element)
+}
+
+func (s *ORSet) Contains(element string) bool {
+	return len(s.Adds[element]) > 0
+}
+
+//Returns the elements of the set in sorted order
+func (s *ORSet) Elements() []string {
+	elements := make([]string, 0, len(s.Adds))
+	for element, tags := range s.Adds {
+		if len(tags) > 0 {
+			elements = append(elements, element)
+		}
+	}
+	sort.Strings(elements)
+	return elements
+}
+
+func (s *ORSet) Merge(other CRDT) error {
+	o, ok := other.(*ORSet)
+	if !ok {
+		return mismatchError(s, other)
+	}
+	for tag := range o.Removed {
+		s.Removed[tag] = true
+	}
+	for element, tags := range o.Adds {
+		for tag := range tags {
+			s.Add(element, tag)
+		}
+	}
+	// drop the adds either side has removed
+	for element, tags := range s.Adds {
+		for tag := range tags {
+			if s.Removed[tag] {
+				delete(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			delete(s.Adds, element)
+		}
+	}
+	return nil
+}
+
+//A register that keeps the value written last. Ties on Timestamp go to the
+//larger Node so every replica keeps the same value
+type LWWRegister struct {
+	Value     []byte
+	Timestamp int64
+	Node      string
+}
+
+func NewLWWRegister(value []byte, timestamp int64, node string) *LWWRegister {
+	return &LWWRegister{Value: value, Timestamp: timestamp, Node: node}
+}
+
+func (r *LWWRegister) Type() CRDTType {
+	return CRDT_LWW_REGISTER
+}
+
+func (r *LWWRegister) Merge(other CRDT) error {
+	o, ok := other.(*LWWRegister)
+	if !ok {
+		return mismatchError(r, other)
+	}
+	if o.Timestamp > r.Timestamp || (o.Timestamp == r.Timestamp && o.Node > r.Node) {
+		*r = *o
+	}
+	return nil
+}
+
+//A map from field names to multi-value registers. Setting a field replaces the
+//values this replica has seen, so a field written concurrently on two replicas
+//holds both values until it is set again
+type CRDTMap struct {
+	Fields map[string]*ORSet // field -> set of base64 encoded values
+}
+
+func NewCRDTMap() *CRDTMap {
+	return &CRDTMap{Fields: make(map[string]*ORSet)}
+}
+
+func (m *CRDTMap) Type() CRDTType {
+	return CRDT_MAP
+}
+
+//Sets field to value under tag, which must never have been used before
+func (m *CRDTMap) Set(field string, value []byte, tag string) {
+	values, ok := m.Fields[field]
+	if !ok {
+		values = NewORSet()
+		m.Fields[field] = values
+	}
+	for _, old := range values.Elements() {
+		values.Remove(old)
+	}
+	values.Add(base64.StdEncoding.EncodeToString(value), tag)
+}
+
+//Removes field as far as this replica has seen it
+func (m *CRDTMap) Remove(field string) {
+	if values, ok := m.Fields[field]; ok {
+		for _, old := range values.Elements() {
+			values.Remove(old)
+		}
+	}
+}
+
+//Returns the values of field, more than one if it was set concurrently
+func (m *CRDTMap) Get(field string) [][]byte {
+	values := make([][]byte, 0)
+	if set, ok := m.Fields[field]; ok {
+		for _, encoded := range set.Elements() {
+			if value, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+//Returns the fields that hold at least one value, in sorted order
+func (m *CRDTMap) Keys() []string {
+	keys := make([]string, 0, len(m.Fields))
+	for field, values := range m.Fields {
+		if len(values.Elements()) > 0 {
+			keys = append(keys, field)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *CRDTMap) Merge(other CRDT) error {
+	o, ok := other.(*CRDTMap)
+	if !ok {
+		return mismatchError(m, other)
+	}
+	for field, values := range o.Fields {
+		if mine, ok := m.Fields[field]; ok {
+			mine.Merge(values)
+		} else {
+			copied := NewORSet()
+			copied.Merge(values)
+			m.Fields[field] = copied
+		}
+	}
+	return nil
+}
+
+func mismatchError(c CRDT, other CRDT) error {
+	return fmt.Errorf("can not merge a %v into a %v", other.Type(), c.Type())
+}
+
+//Returns an empty CRDT of the given type
+func NewCRDT(kind CRDTType) (CRDT, error) {
+	switch kind {
+	case CRDT_G_COUNTER:
+		return NewGCounter(), nil
+	case CRDT_PN_COUNTER:
+		return NewPNCounter(), nil
+	case CRDT_OR_SET:
+		return NewORSet(), nil
+	case CRDT_LWW_REGISTER:
+		return &LWWRegister{}, nil
+	case CRDT_MAP:
+		return NewCRDTMap(), nil
+	}
+	return nil, fmt.Errorf("%v is not a CRDT type", kind)
+}
+
+//Encodes a CRDT as the Value of an ObjectEntry
+func EncodeCRDT(c CRDT) ([]byte, error) {
+	return json.Marshal(c)
+}
+
+//Decodes the CRDT held by entry
+func DecodeCRDT(entry ObjectEntry) (CRDT, error) {
+	c, err := NewCRDT(entry.CRDT)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(entry.Value, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//Creates a PutArgs that writes c to key
+func NewCRDTPutArgs(key string, context Context, c CRDT) (PutArgs, error) {
+	value, err := EncodeCRDT(c)
+	if err != nil {
+		return PutArgs{}, err
+	}
+	args := NewPutArgs(key, context, value)
+	args.CRDT = c.Type()
+	return args, nil
+}
+
+//Merges newEntry, which holds a CRDT, into the entries stored for a key. Every
+//stored entry of the same type is merged with it into a single entry whose
+//clock descends from all of them, and entries that clock supersedes are
+//dropped. Returns false if newEntry holds no CRDT or no stored entry holds the
+//same type, in which case newEntry is stored like a plain value
+func mergeCRDTInto(entries []ObjectEntry, newEntry ObjectEntry) ([]ObjectEntry, bool, error) {
+	if newEntry.CRDT == CRDT_NONE || newEntry.Tombstone {
+		return nil, false, nil
+	}
+	merged, err := DecodeCRDT(newEntry)
+	if err != nil {
+		return nil, false, err
+	}
+	clocks := []VectorClock{}
+	timestamp := newEntry.Timestamp
+	found := false
+	for _, entry := range entries {
+		if entry.CRDT != newEntry.CRDT || entry.Tombstone {
+			continue
+		}
+		stored, err := DecodeCRDT(entry)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := merged.Merge(stored); err != nil {
+			return nil, false, err
+		}
+		clocks = append(clocks, entry.Context.Clock)
+		if entry.Timestamp > timestamp {
+			timestamp = entry.Timestamp
+		}
+		found = true
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	clock := NewVectorClock()
+	clock.Combine(append(clocks, newEntry.Context.Clock))
+	value, err := EncodeCRDT(merged)
+	if err != nil {
+		return nil, false, err
+	}
+	result := NewObjectEntry(NewContext(clock), value)
+	result.CRDT = newEntry.CRDT
+	result.Timestamp = timestamp
+
+	kept := make([]ObjectEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.CRDT == newEntry.CRDT && !entry.Tombstone {
+			continue
+		}
+		if !entry.Context.Clock.LessThan(clock) {
+			kept = append(kept, entry)
+		}
+	}
+	return append(kept, result), true, nil
+}
+
+//Merges the CRDT entries of a Get result that hold the same type, so replicas
+//that applied different updates read as one value
+func mergeCRDTEntries(entries []ObjectEntry) []ObjectEntry {
+	merged := make([]ObjectEntry, 0, len(entries))
+	for _, entry := range entries {
+		if folded, ok, err := mergeCRDTInto(merged, entry); err == nil && ok {
+			merged = folded
+		} else {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+//Adds args.Delta to the counter stored at args.Key, creating it as an
+//args.Kind counter if the key holds none. Kind defaults to a PN-Counter
+func (s *DynamoServer) Increment(args CounterArgs, result *bool) error {
+	return s.updateCRDT("MyDynamo.Increment", args, args.Key, func(kind CRDTType) CRDTType {
+		if kind == CRDT_NONE {
+			kind = args.Kind
+		}
+		if kind == CRDT_NONE {
+			kind = CRDT_PN_COUNTER
+		}
+		return kind
+	}, func(state CRDT) error {
+		switch counter := state.(type) {
+		case *GCounter:
+			if args.Delta < 0 {
+				return fmt.Errorf("can not decrement the g-counter at %v", args.Key)
+			}
+			counter.Increment(s.nodeID, uint64(args.Delta))
+		case *PNCounter:
+			counter.Increment(s.nodeID, args.Delta)
+		default:
+			return fmt.Errorf("%v holds a %v, not a counter", args.Key, state.Type())
+		}
+		return nil
+	}, result)
+}
+
+//Adds args.Element to the OR-Set stored at args.Key, creating the set if the
+//key holds none
+func (s *DynamoServer) AddToSet(args SetArgs, result *bool) error {
+	return s.updateCRDT("MyDynamo.AddToSet", args, args.Key, orSetKind, func(state CRDT) error {
+		set, ok := state.(*ORSet)
+		if !ok {
+			return fmt.Errorf("%v holds a %v, not a set", args.Key, state.Type())
+		}
+		set.Add(args.Element, s.newTag())
+		return nil
+	}, result)
+}
+
+//Removes args.Element from the OR-Set stored at args.Key. Adds of the element
+//this node has not seen yet survive the remove
+func (s *DynamoServer) RemoveFromSet(args SetArgs, result *bool) error {
+	return s.updateCRDT("MyDynamo.RemoveFromSet", args, args.Key, orSetKind, func(state CRDT) error {
+		set, ok := state.(*ORSet)
+		if !ok {
+			return fmt.Errorf("%v holds a %v, not a set", args.Key, state.Type())
+		}
+		set.Remove(args.Element)
+		return nil
+	}, result)
+}
+
+func orSetKind(_ CRDTType) CRDTType {
+	return CRDT_OR_SET
+}
+
+//Sequence number that keeps the tags this process makes unique
+var tagSequence uint64
+
+//Returns a tag no other add has used
+func (s *DynamoServer) newTag() string {
+	return fmt.Sprintf("%v.%v.%v", s.nodeID, time.Now().UnixNano(), atomic.AddUint64(&tagSequence, 1))
+}
+
+//Applies update to the CRDT stored at key on this node and writes the result
+//to the replicas of key. kind picks the type of CRDT from the type already
+//stored, CRDT_NONE if there is none. Updates this node coordinates are
+//serialized per key so none of them is lost, and the write descends from every
+//version this node holds so the replicas merge it instead of keeping siblings
+func (s *DynamoServer) updateCRDT(method string, args interface{}, key string, kind func(CRDTType) CRDTType, update func(CRDT) error, result *bool) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+
+	v := s.view()
+	replicas := v.replicasFor(key)
+	if !contains(replicas, v.pListLoc) {
+		// this node does not hold the key, hand the request to one of its replicas
+		return s.forward(v, method, replicas, args, result)
+	}
+
+	s.crdtLocks.Lock(key)
+	defer s.crdtLocks.Unlock(key)
+
+	entries, _ := s.store.Get(key)
+	stored := CRDT_NONE
+	clocks := make([]VectorClock, 0, len(entries))
+	for _, entry := range entries {
+		clocks = append(clocks, entry.Context.Clock)
+		if entry.Tombstone {
+			continue
+		}
+		if entry.CRDT == CRDT_NONE {
+			return fmt.Errorf("server %v: %v holds a plain value", s.nodeID, key)
+		}
+		stored = entry.CRDT
+	}
+
+	state, err := NewCRDT(kind(stored))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Tombstone {
+			continue
+		}
+		current, err := DecodeCRDT(entry)
+		if err != nil {
+			return err
+		}
+		if err := state.Merge(current); err != nil {
+			return err
+		}
+	}
+	if err := update(state); err != nil {
+		return fmt.Errorf("server %v: %v", s.nodeID, err)
+	}
+
+	clock := NewVectorClock()
+	clock.Combine(clocks)
+	value, err := NewCRDTPutArgs(key, NewContext(clock), state)
+	if err != nil {
+		return err
+	}
+	return s.replicatePut(v, replicas, value, result)
+}
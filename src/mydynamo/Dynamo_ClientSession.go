@@ -0,0 +1,268 @@
+package mydynamo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Commands of the DynamoClient REPL
+const REPL_HELP_STRING string = `commands: get <key> | put [-context token] <key> <value> | delete [-context token] <key>
+          crash <seconds> | gossip | status | contexts | help | quit
+put and delete use the context of the last get of the key unless -context is given.
+Quote arguments that contain spaces: put k "two words"`
+
+//Runs the commands of DynamoClient against one node. Contexts read by get are
+//remembered per key when Contexts is not nil, and used by the next put or
+//delete of that key
+type ClientSession struct {
+	Client   *RPCClient
+	Timeout  time.Duration // deadline of every command
+	Out      io.Writer
+	Contexts map[string]Context
+}
+
+//Returned by ClientSession for arguments that do not match the usage of a command
+var ErrUsage = errors.New("bad usage")
+
+//Runs one command, given as its name followed by its arguments. Returns
+//ErrUsage if the arguments do not match the usage of the command
+func (s *ClientSession) Run(args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return ErrUsage
+		}
+		return s.get(ctx, args[1])
+	case "put":
+		return s.write(ctx, args, 2)
+	case "delete":
+		return s.write(ctx, args, 1)
+	case "crash":
+		if len(args) != 2 {
+			return ErrUsage
+		}
+		seconds, err := strconv.Atoi(args[1])
+		if err != nil || seconds < 0 {
+			return ErrUsage
+		}
+		if err := s.Client.CrashCtx(ctx, seconds); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.Out, "%v is offline for %v seconds\n", s.Client.ServerAddr, seconds)
+	case "gossip":
+		if len(args) != 1 {
+			return ErrUsage
+		}
+		if err := s.Client.GossipCtx(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(s.Out, "ok")
+	case "status":
+		if len(args) != 1 {
+			return ErrUsage
+		}
+		return s.status(ctx)
+	default:
+		return ErrUsage
+	}
+	return nil
+}
+
+//Prints the value of key, or every sibling with its clock. The context printed
+//last descends from all of them, so passing it to put replaces them
+func (s *ClientSession) get(ctx context.Context, key string) error {
+	result, err := s.Client.GetCtx(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(result.EntryList) == 0 {
+		fmt.Fprintf(s.Out, "%v not found\n", key)
+		return nil
+	}
+	clocks := make([]VectorClock, 0, len(result.EntryList))
+	for _, entry := range result.EntryList {
+		clocks = append(clocks, entry.Context.Clock)
+	}
+	if len(result.EntryList) == 1 {
+		fmt.Fprintln(s.Out, FormatValue(result.EntryList[0].Value))
+		fmt.Fprintf(s.Out, "clock:   %v\n", PrintFormatVectorClock(clocks[0]))
+	} else {
+		fmt.Fprintf(s.Out, "%v siblings:\n", len(result.EntryList))
+		for i, entry := range result.EntryList {
+			fmt.Fprintf(s.Out, "  [%v] %v\n      clock: %v\n", i, FormatValue(entry.Value), PrintFormatVectorClock(entry.Context.Clock))
+		}
+	}
+	clock := NewVectorClock()
+	clock.Combine(clocks)
+	context := NewContext(clock)
+	fmt.Fprintf(s.Out, "context: %v\n", EncodeContextToken(context))
+	if s.Contexts != nil {
+		s.Contexts[key] = context
+	}
+	return nil
+}
+
+//Runs put or delete, which take a -context flag followed by the key and, for
+//put, the value. values is the number of arguments after the flag
+func (s *ClientSession) write(ctx context.Context, args []string, values int) error {
+	flags := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	token := flags.String("context", "", "context from a previous get")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != values {
+		return ErrUsage
+	}
+	key := flags.Arg(0)
+	context, err := s.contextFor(key, *token)
+	if err != nil {
+		return err
+	}
+	if args[0] == "put" {
+		err = s.Client.PutCtx(ctx, NewPutArgs(key, context, []byte(flags.Arg(1))))
+	} else {
+		err = s.Client.DeleteCtx(ctx, key, context)
+	}
+	if err != nil {
+		return err
+	}
+	// the remembered context is older than the write just made
+	delete(s.Contexts, key)
+	fmt.Fprintln(s.Out, "ok")
+	return nil
+}
+
+//Returns the context to write key with: the token if one was given, else the
+//context remembered from the last get of key, else a fresh one
+func (s *ClientSession) contextFor(key string, token string) (Context, error) {
+	if token != "" {
+		return DecodeContextToken(token)
+	}
+	if context, ok := s.Contexts[key]; ok {
+		return context, nil
+	}
+	return NewContext(NewVectorClock()), nil
+}
+
+//Prints the membership view of the node, ordered by address
+func (s *ClientSession) status(ctx context.Context) error {
+	view, err := s.Client.MembershipCtx(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(view, func(i, j int) bool {
+		a, b := view[i].Node, view[j].Node
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return len(a.Port) < len(b.Port) || (len(a.Port) == len(b.Port) && a.Port < b.Port)
+	})
+	w := tabwriter.NewWriter(s.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSTATUS\tINCARNATION\tHEARTBEAT")
+	for _, member := range view {
+		fmt.Fprintf(w, "%v:%v\t%v\t%v\t%v\n", member.Node.Address, member.Node.Port, member.Status, member.Incarnation, member.Heartbeat)
+	}
+	return w.Flush()
+}
+
+//Returns value as text if it is printable, and quoted otherwise
+func FormatValue(value []byte) string {
+	if utf8.Valid(value) && strings.IndexFunc(string(value), func(r rune) bool { return !unicode.IsPrint(r) }) < 0 {
+		return string(value)
+	}
+	return strconv.Quote(string(value))
+}
+
+//Reads commands from in until it ends or quit is entered. Errors of a command
+//are printed and do not end the session
+func (s *ClientSession) Repl(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprintf(s.Out, "connected to %v, type help for the commands\n", s.Client.ServerAddr)
+	for {
+		fmt.Fprint(s.Out, "dynamo> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.Out)
+			return scanner.Err()
+		}
+		args, err := SplitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(s.Out, err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "quit", "exit":
+			return nil
+		case "help":
+			fmt.Fprintln(s.Out, REPL_HELP_STRING)
+		case "contexts":
+			keys := make([]string, 0, len(s.Contexts))
+			for key := range s.Contexts {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintf(s.Out, "%v\t%v\n", key, EncodeContextToken(s.Contexts[key]))
+			}
+		default:
+			if err := s.Run(args); errors.Is(err, ErrUsage) {
+				fmt.Fprintln(s.Out, REPL_HELP_STRING)
+			} else if err != nil {
+				fmt.Fprintln(s.Out, "error:", err)
+			}
+		}
+	}
+}
+
+//Splits a line into arguments at spaces. Double quotes group words into one
+//argument, and a backslash escapes the character after it
+func SplitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	var current strings.Builder
+	inArg, quoted, escaped := false, false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inArg = true, true
+		case r == '"':
+			quoted, inArg = !quoted, true
+		case r == ' ' || r == '\t':
+			if quoted {
+				current.WriteRune(r)
+			} else if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quoted || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,223 @@
+package mydynamo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+//A client for a whole cluster rather than a single node. It learns the members
+//and the ring from a list of seed nodes, sends every request straight to the
+//first replica of its key, and fails over to the next replica when a node is
+//offline or can not be reached. The view of the cluster is fetched again every
+//RefreshInterval and whenever every replica of a key fails.
+//Like RPCClient, a ClusterClient is not safe for concurrent use
+type ClusterClient struct {
+	Seeds           []DynamoNode     // nodes asked for the membership when no member answers
+	Retry           RetryPolicy      // how each node is retried before failing over to the next one
+	RefreshInterval time.Duration    // how long a view of the cluster is used before it is fetched again
+	Resolver        ConflictResolver // if set, Get merges siblings with it and writes the result back
+
+	members   []DynamoNode
+	status    []MemberStatus
+	ring      *Ring
+	nValue    int
+	refreshed time.Time
+	clients   map[string]*RPCClient // keyed by address:port
+}
+
+//Creates a ClusterClient that finds the cluster through seeds. Nodes are not
+//contacted until the first request
+func NewClusterClient(seeds []DynamoNode) *ClusterClient {
+	retry := DefaultRetryPolicy()
+	// a node that fails is skipped, the next replica is the retry
+	retry.MaxAttempts = 1
+	return &ClusterClient{
+		Seeds:           append([]DynamoNode{}, seeds...),
+		Retry:           retry,
+		RefreshInterval: time.Duration(DEFAULT_CLIENT_REFRESH_INTERVAL) * time.Millisecond,
+		clients:         make(map[string]*RPCClient),
+	}
+}
+
+//Returns the client for node, creating it on first use
+func (c *ClusterClient) client(node DynamoNode) *RPCClient {
+	key := memberKey(node)
+	if client, ok := c.clients[key]; ok {
+		client.Retry = c.Retry
+		return client
+	}
+	client := NewDynamoRPCClient(key)
+	client.Retry = c.Retry
+	c.clients[key] = client
+	return client
+}
+
+//Fetches the membership and ring from the current members, or from the seeds
+//if none of them answers
+func (c *ClusterClient) Refresh(ctx context.Context) error {
+	candidates := append(append([]DynamoNode{}, c.members...), c.Seeds...)
+	var lastErr error = fmt.Errorf("no seed nodes")
+	for _, node := range candidates {
+		var info ClusterInfo
+		if err := c.client(node).callCtx(ctx, "MyDynamo.ClusterInfo", Empty{}, &info); err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+		if len(info.Members) == 0 {
+			// the node has not been given its preference list yet
+			continue
+		}
+		c.setView(info)
+		return nil
+	}
+	return fmt.Errorf("could not fetch the cluster membership: %w", lastErr)
+}
+
+//Replaces the view of the cluster, closing the clients of nodes that left
+func (c *ClusterClient) setView(info ClusterInfo) {
+	c.members = info.Members
+	c.status = info.Status
+	c.ring = NewRing(info.Members, VIRTUAL_NODES)
+	c.nValue = info.NValue
+	c.refreshed = time.Now()
+
+	current := make(map[string]bool)
+	for _, node := range append(append([]DynamoNode{}, info.Members...), c.Seeds...) {
+		current[memberKey(node)] = true
+	}
+	for key, client := range c.clients {
+		if !current[key] {
+			client.CleanConn()
+			delete(c.clients, key)
+		}
+	}
+}
+
+//Fetches the view of the cluster if there is none or it is older than
+//RefreshInterval
+func (c *ClusterClient) refreshIfStale(ctx context.Context) error {
+	if c.ring != nil && time.Since(c.refreshed) < c.RefreshInterval {
+		return nil
+	}
+	if err := c.Refresh(ctx); err != nil && c.ring == nil {
+		return err
+	}
+	// an old view still routes most keys correctly
+	return nil
+}
+
+//Returns the replicas of key in the order requests are sent to them. Nodes the
+//cluster considers dead are moved to the end
+func (c *ClusterClient) PreferenceList(key string) []DynamoNode {
+	if c.ring == nil {
+		return []DynamoNode{}
+	}
+	alive := make([]DynamoNode, 0, c.nValue)
+	dead := make([]DynamoNode, 0)
+	for _, i := range c.ring.PreferenceIndices(key, c.nValue) {
+		if i < len(c.status) && c.status[i] == MEMBER_DEAD {
+			dead = append(dead, c.members[i])
+		} else {
+			alive = append(alive, c.members[i])
+		}
+	}
+	return append(alive, dead...)
+}
+
+//Sends a request for key to its replicas in order until one of them handles
+//it. If every replica fails, the view is fetched again and the new replicas
+//are tried once. Errors reported by a replica that handled the request, such
+//as ErrStaleContext or ErrQuorumNotMet, are returned without failing over
+func (c *ClusterClient) route(ctx context.Context, key string, request func(*RPCClient) error) error {
+	if err := c.refreshIfStale(ctx); err != nil {
+		return err
+	}
+	var lastErr error
+	for round := 0; round < 2; round++ {
+		for _, node := range c.PreferenceList(key) {
+			err := request(c.client(node))
+			if err == nil || !retryable(err) {
+				return err
+			}
+			lastErr = err
+		}
+		if round == 0 {
+			if err := c.Refresh(ctx); err != nil {
+				break
+			}
+		}
+	}
+	if lastErr == nil {
+		return fmt.Errorf("no replica known for key %v", key)
+	}
+	return fmt.Errorf("every replica of %v failed: %w", key, lastErr)
+}
+
+//Puts a value to the replicas of its key
+func (c *ClusterClient) Put(ctx context.Context, value PutArgs) error {
+	return c.route(ctx, value.Key, func(client *RPCClient) error {
+		return client.PutCtx(ctx, value)
+	})
+}
+
+//Gets a value from the replicas of key. With a Resolver set, siblings are
+//merged, the merged value is written back with a context descended from all of
+//them and from the tombstones of deleted versions, and the key is read again so
+//the result carries the new context
+func (c *ClusterClient) Get(ctx context.Context, key string) (*DynamoResult, error) {
+	if c.Resolver == nil {
+		return c.get(ctx, key)
+	}
+	var result *DynamoResult
+	err := c.route(ctx, key, func(client *RPCClient) error {
+		var err error
+		result, err = client.GetVersionsCtx(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	merged, ok, err := ResolveSiblings(key, *result, c.Resolver)
+	if err != nil || !ok {
+		RemoveTombstones(result)
+		return result, err
+	}
+	if err := c.Put(ctx, merged); err != nil {
+		return nil, fmt.Errorf("failed to write back resolved %v: %w", key, err)
+	}
+	return c.get(ctx, key)
+}
+
+func (c *ClusterClient) get(ctx context.Context, key string) (*DynamoResult, error) {
+	var result *DynamoResult
+	err := c.route(ctx, key, func(client *RPCClient) error {
+		var err error
+		result, err = client.GetCtx(ctx, key)
+		return err
+	})
+	return result, err
+}
+
+//Deletes key from its replicas. context should come from a prior Get of the key
+func (c *ClusterClient) Delete(ctx context.Context, key string, context Context) error {
+	return c.route(ctx, key, func(client *RPCClient) error {
+		return client.DeleteCtx(ctx, key, context)
+	})
+}
+
+//Returns the members of the cluster as of the last refresh
+func (c *ClusterClient) Members() []DynamoNode {
+	return append([]DynamoNode{}, c.members...)
+}
+
+//Closes the connections to every node
+func (c *ClusterClient) Close() {
+	for key, client := range c.clients {
+		client.CleanConn()
+		delete(c.clients, key)
+	}
+}
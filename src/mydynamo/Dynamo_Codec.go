@@ -0,0 +1,373 @@
+package mydynamo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+//Version of the binary encoding, written as the first byte of every message
+const CODEC_VERSION byte = 1
+
+//Returned when a message is not a valid binary encoding
+var ErrMalformed = errors.New("malformed encoding")
+
+//Flags of an encoded ObjectEntry
+const (
+	entryTombstone byte = 1 << iota
+	entryHasValue       // tells a nil Value from an empty one
+)
+
+//The binary encoding replaces gob for replication traffic between nodes. Node
+//IDs that are decimal numbers, as the coordinator assigns them, are written as
+//a single varint, every other ID as a length-prefixed string. The elements of a
+//clock are written in sorted order, so equal clocks encode to equal bytes, and
+//values are length-prefixed. A message starts with CODEC_VERSION
+
+//Encodes clock in the binary encoding
+func MarshalVectorClock(clock VectorClock) []byte {
+	return appendVectorClock([]byte{CODEC_VERSION}, clock)
+}
+
+//Decodes a clock encoded by MarshalVectorClock
+func UnmarshalVectorClock(data []byte) (VectorClock, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return VectorClock{}, err
+	}
+	clock := d.vectorClock()
+	return clock, d.finish()
+}
+
+//Encodes context in the binary encoding
+func MarshalContext(context Context) []byte {
+	return appendVectorClock([]byte{CODEC_VERSION}, context.Clock)
+}
+
+//Decodes a context encoded by MarshalContext
+func UnmarshalContext(data []byte) (Context, error) {
+	clock, err := UnmarshalVectorClock(data)
+	return Context{Clock: clock}, err
+}
+
+//Encodes entry in the binary encoding
+func MarshalObjectEntry(entry ObjectEntry) []byte {
+	return appendObjectEntry([]byte{CODEC_VERSION}, entry)
+}
+
+//Decodes an entry encoded by MarshalObjectEntry
+func UnmarshalObjectEntry(data []byte) (ObjectEntry, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return ObjectEntry{}, err
+	}
+	entry := d.objectEntry()
+	return entry, d.finish()
+}
+
+//Encodes value in the binary encoding
+func MarshalPutArgs(value PutArgs) []byte {
+	buf := appendString([]byte{CODEC_VERSION}, value.Key)
+	return appendObjectEntry(buf, entryFromPutArgs(value))
+}
+
+//Decodes a PutArgs encoded by MarshalPutArgs
+func UnmarshalPutArgs(data []byte) (PutArgs, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return PutArgs{}, err
+	}
+	key := d.string()
+	value := putArgsFromEntry(key, d.objectEntry())
+	return value, d.finish()
+}
+
+//Encodes values in the binary encoding, as a batch sent in one message
+func MarshalPutArgsList(values []PutArgs) []byte {
+	buf := binary.AppendUvarint([]byte{CODEC_VERSION}, uint64(len(values)))
+	for _, value := range values {
+		buf = appendString(buf, value.Key)
+		buf = appendObjectEntry(buf, entryFromPutArgs(value))
+	}
+	return buf
+}
+
+//Decodes a batch encoded by MarshalPutArgsList
+func UnmarshalPutArgsList(data []byte) ([]PutArgs, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return nil, err
+	}
+	n := d.count()
+	values := make([]PutArgs, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		key := d.string()
+		values = append(values, putArgsFromEntry(key, d.objectEntry()))
+	}
+	return values, d.finish()
+}
+
+//Encodes result in the binary encoding
+func MarshalDynamoResult(result DynamoResult) []byte {
+	buf := binary.AppendUvarint([]byte{CODEC_VERSION}, uint64(len(result.EntryList)))
+	for _, entry := range result.EntryList {
+		buf = appendObjectEntry(buf, entry)
+	}
+	return buf
+}
+
+//Decodes a result encoded by MarshalDynamoResult
+func UnmarshalDynamoResult(data []byte) (DynamoResult, error) {
+	d, err := newDecoder(data)
+	if err != nil {
+		return DynamoResult{}, err
+	}
+	n := d.count()
+	result := DynamoResult{EntryList: make([]ObjectEntry, 0, n)}
+	for i := 0; i < n && d.err == nil; i++ {
+		result.EntryList = append(result.EntryList, d.objectEntry())
+	}
+	return result, d.finish()
+}
+
+func appendVectorClock(buf []byte, clock VectorClock) []byte {
+	buf = appendCounts(buf, clock.Elements)
+	// timestamps are written as the difference from the one before, which
+	// is small for elements updated around the same time
+	buf = binary.AppendUvarint(buf, uint64(len(clock.Updated)))
+	var previous int64
+	for _, id := range sortedIDs(clock.Updated) {
+		buf = appendNodeID(buf, id)
+		buf = binary.AppendVarint(buf, clock.Updated[id]-previous)
+		previous = clock.Updated[id]
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(clock.Pruned)))
+	for _, marker := range clock.Pruned {
+		buf = appendString(buf, marker)
+	}
+	buf = binary.AppendVarint(buf, int64(clock.Dot.Counter))
+	if clock.Dot.Counter != 0 {
+		buf = appendNodeID(buf, clock.Dot.Node)
+	}
+	return buf
+}
+
+func appendCounts(buf []byte, counts map[string]int) []byte {
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	buf = binary.AppendUvarint(buf, uint64(len(ids)))
+	for _, id := range ids {
+		buf = appendNodeID(buf, id)
+		buf = binary.AppendVarint(buf, int64(counts[id]))
+	}
+	return buf
+}
+
+func sortedIDs(timestamps map[string]int64) []string {
+	ids := make([]string, 0, len(timestamps))
+	for id := range timestamps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func appendObjectEntry(buf []byte, entry ObjectEntry) []byte {
+	var flags byte
+	if entry.Tombstone {
+		flags |= entryTombstone
+	}
+	if entry.Value != nil {
+		flags |= entryHasValue
+	}
+	buf = append(buf, flags)
+	buf = appendVectorClock(buf, entry.Context.Clock)
+	buf = binary.AppendVarint(buf, entry.Timestamp)
+	buf = binary.AppendVarint(buf, int64(entry.CRDT))
+	if entry.Value != nil {
+		buf = appendBytes(buf, entry.Value)
+	}
+	return buf
+}
+
+//Writes id as a varint if it is a decimal number without leading zeros, with
+//the low bit clear, and otherwise as its length with the low bit set followed
+//by its bytes
+func appendNodeID(buf []byte, id string) []byte {
+	if n, err := strconv.ParseUint(id, 10, 63); err == nil && strconv.FormatUint(n, 10) == id {
+		return binary.AppendUvarint(buf, n<<1)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(id))<<1|1)
+	return append(buf, id...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+//Reads a binary encoded message. The first error sticks, and every read after
+//it returns a zero value
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func newDecoder(data []byte) (*decoder, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty message", ErrMalformed)
+	}
+	if data[0] != CODEC_VERSION {
+		return nil, fmt.Errorf("%w: unknown version %v", ErrMalformed, data[0])
+	}
+	return &decoder{data: data[1:]}, nil
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: "+format, append([]interface{}{ErrMalformed}, args...)...)
+	}
+}
+
+//Returns the error of the first failed read, or an error if bytes are left over
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) > 0 {
+		d.fail("%v trailing bytes", len(d.data))
+	}
+	return d.err
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+//Reads the number of items that follow. Every item takes at least a byte, so
+//a count larger than what is left is rejected before anything is allocated
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail("count %v exceeds the message", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) raw(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.data)) {
+		d.fail("length %v exceeds the message", n)
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	b := d.raw(d.uvarint())
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+func (d *decoder) string() string {
+	return string(d.raw(d.uvarint()))
+}
+
+func (d *decoder) byte() byte {
+	b := d.raw(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) nodeID() string {
+	v := d.uvarint()
+	if v&1 == 0 {
+		return strconv.FormatUint(v>>1, 10)
+	}
+	return string(d.raw(v >> 1))
+}
+
+func (d *decoder) vectorClock() VectorClock {
+	clock := NewVectorClock()
+	for i, n := 0, d.count(); i < n && d.err == nil; i++ {
+		id := d.nodeID()
+		clock.Elements[id] = int(d.varint())
+	}
+	if n := d.count(); n > 0 {
+		clock.Updated = make(map[string]int64, n)
+		var previous int64
+		for i := 0; i < n && d.err == nil; i++ {
+			id := d.nodeID()
+			previous += d.varint()
+			clock.Updated[id] = previous
+		}
+	}
+	if n := d.count(); n > 0 {
+		clock.Pruned = make([]string, 0, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			clock.Pruned = append(clock.Pruned, d.string())
+		}
+	}
+	if counter := int(d.varint()); counter != 0 {
+		clock.Dot = Dot{Node: d.nodeID(), Counter: counter}
+	}
+	return clock
+}
+
+func (d *decoder) objectEntry() ObjectEntry {
+	flags := d.byte()
+	if flags&^(entryTombstone|entryHasValue) != 0 {
+		d.fail("unknown entry flags %v", flags)
+	}
+	entry := ObjectEntry{
+		Context:   Context{Clock: d.vectorClock()},
+		Tombstone: flags&entryTombstone != 0,
+		Timestamp: d.varint(),
+		CRDT:      CRDTType(d.varint()),
+	}
+	if flags&entryHasValue != 0 {
+		entry.Value = d.bytes()
+		if entry.Value == nil && d.err == nil {
+			entry.Value = []byte{}
+		}
+	}
+	return entry
+}
@@ -0,0 +1,152 @@
+package mydynamo
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+//Settings read from the [mydynamo] section of a config file. The coordinator
+//and DynamoNode share the cluster-wide keys. NodeID, ListenAddress and Seeds are
+//only read by DynamoNode, and the node process keys only by the coordinator
+type Config struct {
+	StartingPort        int
+	RValue              int
+	WValue              int
+	NValue              int
+	ClusterSize         int
+	StorageEngine       string
+	DataDir             string
+	TombstoneGrace      time.Duration
+	AntiEntropyInterval time.Duration
+	SyncReadRepair      bool
+	HeartbeatInterval   time.Duration
+	SuspectTimeout      time.Duration
+	DeadTimeout         time.Duration
+	RequestTimeout      time.Duration
+	MaxClockSize        int
+	Causality           string
+	ConflictResolvers   map[string]ConflictResolver // keyed by key prefix
+
+	NodeID        string       // identity of the node in vector clocks, stable across restarts
+	ListenAddress string       // host:port the node serves on
+	Seeds         []DynamoNode // nodes asked for the members of the cluster at startup
+
+	NodeProcesses    bool          // run every node in its own DynamoNode process
+	NodeBinary       string        // path of the DynamoNode binary
+	NodeRestartDelay time.Duration // wait before restarting a node process that exited, 0 never restarts
+}
+
+//Reads the config file at path. Returns an error if a key has the wrong type
+//or the quorum sizes can not be satisfied
+func LoadConfig(path string) (*Config, error) {
+	content, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	section := content.Section(MYDYNAMO)
+
+	config := &Config{ConflictResolvers: make(map[string]ConflictResolver)}
+	for _, field := range []struct {
+		key   string
+		value *int
+	}{
+		{R_VALUE, &config.RValue},
+		{W_VALUE, &config.WValue},
+		{CLUSTER_SIZE, &config.ClusterSize},
+	} {
+		if *field.value, err = section.Key(field.key).Int(); err != nil {
+			return nil, fmt.Errorf("%v: %v", field.key, err)
+		}
+	}
+	// starting_port is only needed by the coordinator
+	if section.HasKey(SERVER_PORT) {
+		if config.StartingPort, err = section.Key(SERVER_PORT).Int(); err != nil {
+			return nil, fmt.Errorf("%v: %v", SERVER_PORT, err)
+		}
+	}
+	// n_value is optional, by default every node replicates every key
+	config.NValue = config.ClusterSize
+	if section.HasKey(N_VALUE) {
+		if config.NValue, err = section.Key(N_VALUE).Int(); err != nil {
+			return nil, fmt.Errorf("%v: %v", N_VALUE, err)
+		}
+	}
+	if err := ValidateQuorum(config.RValue, config.WValue, config.NValue, config.ClusterSize); err != nil {
+		return nil, err
+	}
+
+	// storage is optional, by default nodes keep their data in memory
+	config.StorageEngine = section.Key(STORAGE_ENGINE).MustString(STORAGE_MEMORY)
+	config.DataDir = section.Key(DATA_DIR).MustString("data")
+	config.TombstoneGrace = time.Duration(section.Key(TOMBSTONE_GRACE).MustInt(DEFAULT_TOMBSTONE_GRACE)) * time.Second
+	config.AntiEntropyInterval = time.Duration(section.Key(ANTI_ENTROPY_INTERVAL).MustInt(DEFAULT_ANTI_ENTROPY_INTERVAL)) * time.Second
+	config.SyncReadRepair = section.Key(SYNC_READ_REPAIR).MustBool(false)
+	config.HeartbeatInterval = time.Duration(section.Key(HEARTBEAT_INTERVAL).MustInt(DEFAULT_HEARTBEAT_INTERVAL)) * time.Millisecond
+	config.SuspectTimeout = time.Duration(section.Key(SUSPECT_TIMEOUT).MustInt(DEFAULT_SUSPECT_TIMEOUT)) * time.Millisecond
+	config.DeadTimeout = time.Duration(section.Key(DEAD_TIMEOUT).MustInt(DEFAULT_DEAD_TIMEOUT)) * time.Millisecond
+	config.RequestTimeout = time.Duration(section.Key(REQUEST_TIMEOUT).MustInt(DEFAULT_REQUEST_TIMEOUT)) * time.Millisecond
+	config.MaxClockSize = section.Key(MAX_CLOCK_SIZE).MustInt(DEFAULT_MAX_CLOCK_SIZE)
+	config.Causality = section.Key(CAUSALITY).MustString(CAUSALITY_VECTOR_CLOCK)
+	if config.Causality != CAUSALITY_VECTOR_CLOCK && config.Causality != CAUSALITY_DVV {
+		return nil, fmt.Errorf("unknown causality mode %v", config.Causality)
+	}
+	// comma separated prefix=resolver pairs, e.g. "cart_=set_union,count_=max"
+	for _, pair := range section.Key(CONFLICT_RESOLVERS).Strings(",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid conflict resolver %v, expected prefix=resolver", pair)
+		}
+		resolver, err := BuiltinResolver(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		config.ConflictResolvers[strings.TrimSpace(parts[0])] = resolver
+	}
+
+	config.NodeID = section.Key(NODE_ID).String()
+	config.ListenAddress = section.Key(LISTEN_ADDRESS).String()
+	if config.Seeds, err = ParseNodeList(section.Key(SEEDS).String()); err != nil {
+		return nil, fmt.Errorf("%v: %v", SEEDS, err)
+	}
+
+	config.NodeProcesses = section.Key(NODE_PROCESSES).MustBool(false)
+	config.NodeBinary = section.Key(NODE_BINARY).MustString("DynamoNode")
+	config.NodeRestartDelay = time.Duration(section.Key(NODE_RESTART_DELAY).MustInt(DEFAULT_NODE_RESTART_DELAY)) * time.Second
+	return config, nil
+}
+
+//Sets the package-wide settings of config, which every server in the process shares
+func (config *Config) Apply() {
+	for prefix, resolver := range config.ConflictResolvers {
+		RegisterResolver(prefix, resolver)
+	}
+	SetCausality(config.Causality)
+	SetClusterSize(config.ClusterSize)
+	SetTombstoneGrace(config.TombstoneGrace)
+	SetAntiEntropyInterval(config.AntiEntropyInterval)
+	SetSyncReadRepair(config.SyncReadRepair)
+	SetMembershipTimings(config.HeartbeatInterval, config.SuspectTimeout, config.DeadTimeout)
+	SetRequestTimeout(config.RequestTimeout)
+	SetMaxClockSize(config.MaxClockSize)
+}
+
+//Parses a comma separated list of host:port addresses, as taken by seeds
+func ParseNodeList(list string) ([]DynamoNode, error) {
+	nodes := make([]DynamoNode, 0)
+	for _, address := range strings.Split(list, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, NewDynamoNode(host, port))
+	}
+	return nodes, nil
+}
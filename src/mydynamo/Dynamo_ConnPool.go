@@ -0,0 +1,233 @@
+package mydynamo
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+//The connections a node keeps to one peer. At most MAX_PEER_CONNECTIONS calls
+//run at once, each on its own connection, and connections are kept for reuse
+//once their call returns. A peer that can not be dialed is not dialed again
+//until its backoff has passed, which doubles after every failed dial
+type peerConns struct {
+	node     DynamoNode
+	slots    chan struct{}  // one token per call in flight
+	idle     []*rpc.Client  // connections no call is using
+	failures int            // dials that failed in a row
+	retryAt  time.Time      // no dial is attempted before this moment
+	closed   bool           // set once the peer left the cluster
+	m        sync.Mutex
+}
+
+//Connections to every peer of a node, dialed lazily on first use and shared by
+//every view of the cluster
+type connPool struct {
+	peers map[DynamoNode]*peerConns
+	m     sync.Mutex
+}
+
+func newConnPool() *connPool {
+	return &connPool{
+		peers: make(map[DynamoNode]*peerConns),
+	}
+}
+
+//Returns the connections to node, creating an empty set on first use
+func (pool *connPool) peer(node DynamoNode) *peerConns {
+	pool.m.Lock()
+	defer pool.m.Unlock()
+
+	p, ok := pool.peers[node]
+	if !ok {
+		p = &peerConns{
+			node:  node,
+			slots: make(chan struct{}, MAX_PEER_CONNECTIONS),
+		}
+		pool.peers[node] = p
+	}
+	return p
+}
+
+//Calls method on node, waiting at most requestTimeout for a free connection
+//and then for the answer. A connection that fails or hangs is closed, so the
+//next call dials a fresh one
+func (pool *connPool) call(node DynamoNode, method string, args interface{}, reply interface{}) error {
+	p := pool.peer(node)
+	if err := p.acquire(); err != nil {
+		return err
+	}
+	defer p.release()
+
+	conn, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = callWithTimeout(conn, method, args, reply)
+	if _, ok := err.(rpc.ServerError); err != nil && !ok {
+		conn.Close()
+		return err
+	}
+	p.put(conn)
+	return err
+}
+
+//Closes the connections to every node that is not in nodes
+func (pool *connPool) Retain(nodes []DynamoNode) {
+	keep := make(map[DynamoNode]bool)
+	for _, node := range nodes {
+		keep[node] = true
+	}
+	pool.m.Lock()
+	removed := make([]*peerConns, 0)
+	for node, p := range pool.peers {
+		if !keep[node] {
+			removed = append(removed, p)
+			delete(pool.peers, node)
+		}
+	}
+	pool.m.Unlock()
+
+	for _, p := range removed {
+		p.close()
+	}
+}
+
+//Closes every connection in the pool
+func (pool *connPool) Close() {
+	pool.Retain(nil)
+}
+
+//Takes a call slot, waiting up to requestTimeout for one to free up
+func (p *peerConns) acquire() error {
+	if requestTimeout <= 0 {
+		p.slots <- struct{}{}
+		return nil
+	}
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("all %v connections to %v are busy", MAX_PEER_CONNECTIONS, memberKey(p.node))
+	}
+}
+
+func (p *peerConns) release() {
+	<-p.slots
+}
+
+//Returns an idle connection, or dials a new one unless the peer is backing off
+func (p *peerConns) get() (*rpc.Client, error) {
+	p.m.Lock()
+	if n := len(p.idle); n > 0 {
+		conn := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.m.Unlock()
+		return conn, nil
+	}
+	if wait := time.Until(p.retryAt); wait > 0 {
+		p.m.Unlock()
+		return nil, fmt.Errorf("not dialing %v for another %v", memberKey(p.node), wait)
+	}
+	p.m.Unlock()
+
+	conn, err := dialPeer(memberKey(p.node))
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if err != nil {
+		p.failures++
+		p.retryAt = time.Now().Add(peerBackoff(p.failures))
+		return nil, err
+	}
+	p.failures = 0
+	return conn, nil
+}
+
+//Returns conn to the idle connections
+func (p *peerConns) put(conn *rpc.Client) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, conn)
+}
+
+//Closes the idle connections. Connections in use are closed when their call
+//returns
+func (p *peerConns) close() {
+	p.m.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.m.Unlock()
+
+	closeConnections(idle)
+}
+
+//Connects to the RPC server at addr like rpc.DialHTTP, but gives up after
+//requestTimeout
+func dialPeer(addr string) (*rpc.Client, error) {
+	ctx := context.Background()
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	return dialRPC(ctx, addr)
+}
+
+//Connects to the RPC server at addr like rpc.DialHTTP, but gives up once ctx
+//is done, whether it is still dialing or waiting for the server to answer
+func dialRPC(ctx context.Context, addr string) (*rpc.Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	io.WriteString(conn, "CONNECT "+rpc.DefaultRPCPath+" HTTP/1.0\n\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
+	if err == nil && resp.Status != "200 Connected to Go RPC" {
+		err = errors.New("unexpected HTTP response: " + resp.Status)
+	}
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// calls have their own timeout
+	conn.SetDeadline(time.Time{})
+	return rpc.NewClient(conn), nil
+}
+
+//Returns how long to wait before dialing a peer again after failures failed
+//dials in a row
+func peerBackoff(failures int) time.Duration {
+	backoff := time.Duration(PEER_RETRY_BACKOFF) * time.Millisecond
+	max := time.Duration(MAX_PEER_RETRY_BACKOFF) * time.Millisecond
+	for i := 1; i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
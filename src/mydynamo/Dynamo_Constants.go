@@ -7,6 +7,7 @@ const LOAD_FROM_DIR int = 0
 const LOAD_FROM_METAFILE int = 1
 
 const USAGE_STRING string = "usage: ./run-server [config file]"
+const NODE_USAGE_STRING string = "usage: ./DynamoNode [-id node id] [-listen host:port] [-seeds host:port,...] [-supervised] [config file]"
 
 //Server constants
 const ARG_COUNT int = 2
@@ -19,4 +20,110 @@ const MYDYNAMO string = "mydynamo"
 const SERVER_PORT string = "starting_port"
 const W_VALUE string = "w_value"
 const R_VALUE string = "r_value"
+const N_VALUE string = "n_value"
 const CLUSTER_SIZE string = "cluster_size"
+const STORAGE_ENGINE string = "storage_engine"
+const DATA_DIR string = "data_dir"
+const TOMBSTONE_GRACE string = "tombstone_grace"
+const ANTI_ENTROPY_INTERVAL string = "anti_entropy_interval"
+const SYNC_READ_REPAIR string = "sync_read_repair"
+const HEARTBEAT_INTERVAL string = "heartbeat_interval"
+const SUSPECT_TIMEOUT string = "suspect_timeout"
+const DEAD_TIMEOUT string = "dead_timeout"
+const REQUEST_TIMEOUT string = "request_timeout"
+const MAX_CLOCK_SIZE string = "max_clock_size"
+const CAUSALITY string = "causality"
+const CONFLICT_RESOLVERS string = "conflict_resolvers"
+const NODE_ID string = "node_id"
+const LISTEN_ADDRESS string = "listen_address"
+const SEEDS string = "seeds"
+const NODE_PROCESSES string = "node_processes"
+const NODE_BINARY string = "node_binary"
+const NODE_RESTART_DELAY string = "node_restart_delay"
+
+//causality modes accepted by causality
+const CAUSALITY_VECTOR_CLOCK string = "vector_clock"
+const CAUSALITY_DVV string = "dvv"
+
+//storage engine names accepted by storage_engine
+const STORAGE_MEMORY string = "memory"
+const STORAGE_DISK string = "disk"
+const STORAGE_LSM string = "lsm"
+
+//Number of positions each node takes on the consistent-hashing ring
+const VIRTUAL_NODES int = 16
+
+//Number of write-ahead log records a disk store accepts before taking a snapshot
+const SNAPSHOT_INTERVAL int = 1024
+
+//Largest log or SSTable record, in bytes, a store reads. A longer length in a
+//record header can only come from corruption
+const MAX_RECORD_SIZE uint32 = 64 << 20
+
+//Number of keys an LSM memtable holds before it is flushed to an SSTable
+const MEMTABLE_SIZE int = 256
+
+//Number of SSTables that triggers a background compaction
+const COMPACTION_THRESHOLD int = 4
+
+//Seconds a tombstone is kept after every replica has stored it
+const DEFAULT_TOMBSTONE_GRACE int = 60
+
+//Seconds between background anti-entropy rounds
+const DEFAULT_ANTI_ENTROPY_INTERVAL int = 30
+
+//Depth of the Merkle trees used by anti-entropy, which have 2^MERKLE_DEPTH leaves
+const MERKLE_DEPTH int = 6
+
+//Milliseconds between membership rounds
+const DEFAULT_HEARTBEAT_INTERVAL int = 500
+
+//Milliseconds without a new heartbeat before a member is suspected
+const DEFAULT_SUSPECT_TIMEOUT int = 2000
+
+//Milliseconds without a new heartbeat before a member is declared dead
+const DEFAULT_DEAD_TIMEOUT int = 5000
+
+//Milliseconds a node waits for a peer to answer a single request
+const DEFAULT_REQUEST_TIMEOUT int = 2000
+
+//Number of elements after which a vector clock drops the ones updated longest ago
+const DEFAULT_MAX_CLOCK_SIZE int = 10
+
+//Number of random peers a node sends its membership view to every round
+const MEMBERSHIP_FANOUT int = 2
+
+//Number of locks a server spreads keys over to serialize writes to the same key
+const KEY_LOCK_STRIPES int = 64
+
+//Number of times an RPCClient tries a request before giving up
+const DEFAULT_RETRY_ATTEMPTS int = 3
+
+//Milliseconds an RPCClient waits before its first retry, doubled after every retry
+const DEFAULT_RETRY_BACKOFF int = 100
+
+//Upper bound, in milliseconds, on the wait between two retries
+const DEFAULT_MAX_RETRY_BACKOFF int = 2000
+
+//Milliseconds a ClusterClient uses its view of the cluster before fetching it again
+const DEFAULT_CLIENT_REFRESH_INTERVAL int = 5000
+
+//Number of calls a node runs at once to one peer, each on its own connection
+const MAX_PEER_CONNECTIONS int = 8
+
+//Milliseconds a node waits before dialing a peer again after a failed dial,
+//doubled after every further failure
+const PEER_RETRY_BACKOFF int = 100
+
+//Upper bound, in milliseconds, on the wait before dialing a peer again
+const MAX_PEER_RETRY_BACKOFF int = 2000
+
+//Milliseconds a starting node keeps asking its seeds for the members of the
+//cluster before it starts one out of the seeds and itself
+const BOOTSTRAP_TIMEOUT int = 10000
+
+//Milliseconds a starting node waits between two rounds of asking its seeds
+const BOOTSTRAP_RETRY_INTERVAL int = 250
+
+//Seconds the coordinator waits before restarting a node process that exited
+const DEFAULT_NODE_RESTART_DELAY int = 2
@@ -0,0 +1,120 @@
+package mydynamo
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+//A single write: the Counter'th write coordinated by Node
+type Dot struct {
+	Node    string
+	Counter int
+}
+
+//Whether writes are stamped with dotted version vectors instead of vector clocks
+var dottedVersionVectors int32
+
+//Selects how the nodes of this process stamp writes: CAUSALITY_VECTOR_CLOCK
+//increments the coordinator's element of the client's context, CAUSALITY_DVV
+//gives every write its own dot on top of that context
+func SetCausality(mode string) error {
+	switch mode {
+	case CAUSALITY_VECTOR_CLOCK:
+		atomic.StoreInt32(&dottedVersionVectors, 0)
+	case CAUSALITY_DVV:
+		atomic.StoreInt32(&dottedVersionVectors, 1)
+	default:
+		return fmt.Errorf("unknown causality mode %v", mode)
+	}
+	return nil
+}
+
+//Returns the causality mode set by SetCausality
+func GetCausality() string {
+	if atomic.LoadInt32(&dottedVersionVectors) == 1 {
+		return CAUSALITY_DVV
+	}
+	return CAUSALITY_VECTOR_CLOCK
+}
+
+//Returns the clock of the version a node coordinating a write to a key stores,
+//given the client's context and the versions the node already holds.
+//
+//With vector clocks the node increments its own element of the context. Two
+//clients writing through the same node from the same context then produce the
+//same clock, and the second write is rejected. With dotted version vectors the
+//write is the context plus a dot, the node's next counter past every one it
+//has seen for the key. The dot names the write alone, so concurrent writes
+//always become siblings and a write only supersedes the versions its context
+//has seen
+func StampClock(mode string, node string, context VectorClock, stored []ObjectEntry) VectorClock {
+	clock := context.flatten()
+	if mode != CAUSALITY_DVV {
+		clock.Increment(node)
+		return clock
+	}
+	counter := clock.Elements[node]
+	for _, entry := range stored {
+		if seen := entry.Context.Clock.maxCounter(node); seen > counter {
+			counter = seen
+		}
+	}
+	clock.Dot = Dot{Node: node, Counter: counter + 1}
+	clock.Updated[node] = time.Now().UnixNano()
+	return clock
+}
+
+//Returns the clock holding every write of s, without a dot
+func (s VectorClock) flatten() VectorClock {
+	clock := NewVectorClock()
+	clock.Updated = make(map[string]int64)
+	clock.Combine([]VectorClock{s})
+	return clock
+}
+
+//Returns the largest counter of node among the writes s holds
+func (s VectorClock) maxCounter(node string) int {
+	counter := s.Elements[node]
+	if s.Dot.Node == node && s.Dot.Counter > counter {
+		counter = s.Dot.Counter
+	}
+	return counter
+}
+
+func (s VectorClock) hasDot() bool {
+	return s.Dot.Counter > 0
+}
+
+//Returns true if s holds the counter'th write of node
+func (s VectorClock) containsWrite(node string, counter int) bool {
+	return counter <= s.Elements[node] || (s.Dot.Node == node && s.Dot.Counter == counter)
+}
+
+//Returns true if every write s holds is held by other. Without a dot a clock
+//holds the first Elements[id] writes of every id, a dot adds the one write it
+//names to the writes of its context
+func (s VectorClock) writesWithin(other VectorClock) bool {
+	for id, ver := range s.Elements {
+		if ver <= other.Elements[id] {
+			continue
+		}
+		// only other's dot can hold the rest, and then only if it is the
+		// single write missing from other's context
+		if !(other.Dot.Node == id && other.Dot.Counter == ver && other.Elements[id] >= ver-1) {
+			return false
+		}
+	}
+	return !s.hasDot() || other.containsWrite(s.Dot.Node, s.Dot.Counter)
+}
+
+//LessThan for clocks of which at least one has a dot: s precedes other if
+//other holds every write of s and at least one more
+func (s VectorClock) dottedLessThan(other VectorClock) bool {
+	return s.writesWithin(other) && !other.writesWithin(s)
+}
+
+//Concurrent for clocks of which at least one has a dot
+func (s VectorClock) dottedConcurrent(other VectorClock) bool {
+	return !s.writesWithin(other) && !other.writesWithin(s)
+}
@@ -0,0 +1,313 @@
+package mydynamo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const walFileName string = "wal.log"
+const snapshotFileName string = "snapshot.gob"
+
+//A single write-ahead log record: the full sibling list stored at a key. A
+//record with Reset set discards everything stored at the key before it, which
+//is how deletes are logged
+type walRecord struct {
+	Key     string
+	Entries []ObjectEntry
+	Reset   bool
+}
+
+//Storage engine that serves reads from memory, logs every write to a
+//write-ahead log before applying it, and periodically folds the log into a
+//snapshot. Reopening the same directory recovers the store exactly
+type DiskStorage struct {
+	dir        string
+	entries    map[string][]ObjectEntry
+	wal        *os.File
+	walRecords int // records written to the log since the last snapshot
+	m          sync.RWMutex
+}
+
+//Opens the DiskStorage kept in dir, creating dir if needed and recovering any
+//keys left by a previous run
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ds := &DiskStorage{
+		dir:     dir,
+		entries: make(map[string][]ObjectEntry),
+	}
+	if err := ds.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	wal, err := openLog(filepath.Join(dir, walFileName), func(record walRecord) {
+		if record.Reset && len(record.Entries) == 0 {
+			delete(ds.entries, record.Key)
+		} else {
+			ds.entries[record.Key] = record.Entries
+		}
+		ds.walRecords++
+	})
+	if err != nil {
+		return nil, err
+	}
+	ds.wal = wal
+	return ds, nil
+}
+
+func (ds *DiskStorage) Get(key string) ([]ObjectEntry, bool) {
+	ds.m.RLock()
+	defer ds.m.RUnlock()
+
+	entries, ok := ds.entries[key]
+	return copyEntries(entries), ok
+}
+
+func (ds *DiskStorage) Put(key string, entries []ObjectEntry) error {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	if err := appendLogRecord(ds.wal, walRecord{Key: key, Entries: entries}); err != nil {
+		return err
+	}
+	ds.entries[key] = copyEntries(entries)
+	return ds.logged()
+}
+
+func (ds *DiskStorage) Delete(key string) error {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	if err := appendLogRecord(ds.wal, walRecord{Key: key, Reset: true}); err != nil {
+		return err
+	}
+	delete(ds.entries, key)
+	return ds.logged()
+}
+
+//Counts a record written to the log, taking a snapshot once enough records
+//have accumulated. Must be called with ds.m held
+func (ds *DiskStorage) logged() error {
+	ds.walRecords++
+	if ds.walRecords >= SNAPSHOT_INTERVAL {
+		return ds.snapshot()
+	}
+	return nil
+}
+
+func (ds *DiskStorage) Keys() []string {
+	ds.m.RLock()
+	defer ds.m.RUnlock()
+
+	return sortedKeys(ds.entries)
+}
+
+//Writes a final snapshot and closes the log
+func (ds *DiskStorage) Close() error {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	if err := ds.snapshot(); err != nil {
+		return err
+	}
+	return ds.wal.Close()
+}
+
+//Loads the most recent snapshot, if there is one
+func (ds *DiskStorage) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(ds.dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries := make(map[string][]ObjectEntry)
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&entries); err != nil {
+		return err
+	}
+	for key, siblings := range entries {
+		ds.entries[key] = normalizeEntries(siblings)
+	}
+	return nil
+}
+
+//Writes the whole store to a new snapshot and empties the log. The snapshot is
+//written to a temporary file and renamed so a crash never leaves a partial one
+func (ds *DiskStorage) snapshot() error {
+	tmpPath := filepath.Join(ds.dir, snapshotFileName+".tmp")
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+	if err := gob.NewEncoder(writer).Encode(ds.entries); err != nil {
+		f.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(ds.dir, snapshotFileName)); err != nil {
+		return err
+	}
+	// the rename must be durable before the log it replaces is emptied
+	if err := syncDir(ds.dir); err != nil {
+		return err
+	}
+
+	// every record in the log is now covered by the snapshot
+	if err := ds.wal.Truncate(0); err != nil {
+		return err
+	}
+	ds.walRecords = 0
+	return nil
+}
+
+//Appends a record to a log and syncs it to disk. Each record is framed by its
+//length and a CRC32 so that a torn write at the tail can be detected
+func appendLogRecord(log *os.File, record walRecord) error {
+	frame, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+	if _, err := log.Write(frame); err != nil {
+		return err
+	}
+	return log.Sync()
+}
+
+//Encodes a record as a length and CRC32 framed block
+func encodeRecord(record walRecord) ([]byte, error) {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(record); err != nil {
+		return nil, err
+	}
+	if payload.Len() > int(MAX_RECORD_SIZE) {
+		return nil, fmt.Errorf("record of %v bytes is larger than %v", payload.Len(), MAX_RECORD_SIZE)
+	}
+	frame := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(frame, payload.Bytes()...), nil
+}
+
+//Reads one framed record. A record cut short by the end of the file returns
+//io.EOF or io.ErrUnexpectedEOF, a corrupt one any other error
+func readRecord(reader io.Reader) (walRecord, error) {
+	var record walRecord
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return record, err
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > MAX_RECORD_SIZE {
+		// a corrupt length, not worth allocating
+		return record, fmt.Errorf("record of %v bytes is larger than %v", size, MAX_RECORD_SIZE)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return record, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return record, fmt.Errorf("record checksum mismatch")
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+		// not wrapped, a record that passed its checksum is not torn
+		return record, fmt.Errorf("record does not decode: %v", err)
+	}
+	record.Entries = normalizeEntries(record.Entries)
+	return record, nil
+}
+
+//Calls apply with every complete record in the log at path. Replay stops at a
+//record cut short by the end of the file, which a crash in the middle of an
+//append leaves at the tail. Any other bad record fails the replay, since the
+//records after it may still be valid. Returns the offset just past the last
+//complete record
+func replayLog(path string, apply func(walRecord)) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := &countingReader{reader: bufio.NewReader(f)}
+	var end int64
+	for {
+		record, err := readRecord(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return end, nil
+		} else if err != nil {
+			return end, fmt.Errorf("log %v is corrupt at offset %v: %v", path, end, err)
+		}
+		end = reader.count
+		apply(record)
+	}
+}
+
+//Replays the log at path into apply and opens it for appending. A torn tail
+//is cut off first, or the records appended after it would be lost on the next
+//replay, which stops at the torn record
+func openLog(path string, apply func(walRecord)) (*os.File, error) {
+	end, err := replayLog(path, apply)
+	if err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := wal.Truncate(end); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	if err := wal.Sync(); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	return wal, nil
+}
+
+//Counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+//gob drops empty maps, so clocks with no elements decode with a nil map.
+//Restore them so the clocks can be incremented again
+func normalizeEntries(entries []ObjectEntry) []ObjectEntry {
+	for i := range entries {
+		if entries[i].Context.Clock.Elements == nil {
+			entries[i].Context.Clock.Elements = make(map[string]int)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,978 @@
+package mydynamo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Prefix of the X-Amz-Target header of every request to the DynamoDB API,
+//followed by the name of the operation
+const DYNAMODB_TARGET_PREFIX string = "DynamoDB_20120810."
+
+//Content type of requests to and responses from the DynamoDB API
+const DYNAMODB_CONTENT_TYPE string = "application/x-amz-json-1.0"
+
+//Times an item write is retried when another write to the same item got to
+//the coordinator first
+const DYNAMODB_WRITE_ATTEMPTS int = 5
+
+//Largest request body the DynamoDB API reads
+const dynamoDBMaxRequest = 16 << 20
+
+//Storage keys of the DynamoDB API. A table is stored as its description,
+//every item as its own JSON value, and the range keys of the items that share
+//a hash key as an OR-Set, the index a Query reads through
+const (
+	dynamoDBTablePrefix = "dynamodb-table/"
+	dynamoDBItemPrefix  = "dynamodb/"
+	dynamoDBIndexPrefix = "dynamodb-index/"
+)
+
+//Fields of a request that ask for features the API does not implement. They
+//are rejected rather than ignored, so a client never mistakes an unconditional
+//write for a conditional one
+var dynamoDBUnsupported = []string{
+	"ConditionExpression", "Expected", "ConditionalOperator", "FilterExpression",
+	"QueryFilter", "KeyConditions", "AttributeUpdates", "AttributesToGet",
+	"IndexName", "GlobalSecondaryIndexes", "LocalSecondaryIndexes",
+	"StreamSpecification", "SSESpecification",
+}
+
+var dynamoDBTableName = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+
+//A value in an item, in the JSON form of the DynamoDB API, such as {"S": "x"}
+//or {"NS": ["1", "2"]}. Exactly one field is set. Numbers are kept as the
+//strings the client sent
+type AttributeValue struct {
+	S    *string
+	N    *string
+	B    []byte
+	BOOL *bool
+	NULL bool
+	L    []AttributeValue
+	M    map[string]AttributeValue
+	SS   []string
+	NS   []string
+	BS   [][]byte
+}
+
+//An item: its attributes by name
+type DynamoDBItem map[string]AttributeValue
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func (v AttributeValue) isSet() bool {
+	return v.SS != nil || v.NS != nil || v.BS != nil
+}
+
+func (v AttributeValue) isEmptySet() bool {
+	return v.isSet() && len(v.SS)+len(v.NS)+len(v.BS) == 0
+}
+
+func (v AttributeValue) MarshalJSON() ([]byte, error) {
+	var field string
+	var value interface{}
+	switch {
+	case v.S != nil:
+		field, value = "S", *v.S
+	case v.N != nil:
+		field, value = "N", *v.N
+	case v.B != nil:
+		field, value = "B", v.B
+	case v.BOOL != nil:
+		field, value = "BOOL", *v.BOOL
+	case v.NULL:
+		field, value = "NULL", true
+	case v.L != nil:
+		field, value = "L", v.L
+	case v.M != nil:
+		field, value = "M", v.M
+	case v.SS != nil:
+		field, value = "SS", v.SS
+	case v.NS != nil:
+		field, value = "NS", v.NS
+	case v.BS != nil:
+		field, value = "BS", v.BS
+	default:
+		return nil, fmt.Errorf("attribute value has no type")
+	}
+	return json.Marshal(map[string]interface{}{field: value})
+}
+
+func (v *AttributeValue) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 1 {
+		return fmt.Errorf("an attribute value must have exactly one type, found %v", len(fields))
+	}
+	*v = AttributeValue{}
+	for field, raw := range fields {
+		var err error
+		switch field {
+		case "S":
+			err = json.Unmarshal(raw, &v.S)
+		case "N":
+			if err = json.Unmarshal(raw, &v.N); err == nil && v.N != nil {
+				_, err = parseNumber(*v.N)
+			}
+		case "B":
+			if err = json.Unmarshal(raw, &v.B); v.B == nil {
+				v.B = []byte{}
+			}
+		case "BOOL":
+			err = json.Unmarshal(raw, &v.BOOL)
+		case "NULL":
+			if err = json.Unmarshal(raw, &v.NULL); err == nil && !v.NULL {
+				err = fmt.Errorf("NULL must be true")
+			}
+		case "L":
+			if err = json.Unmarshal(raw, &v.L); v.L == nil {
+				v.L = []AttributeValue{}
+			}
+		case "M":
+			if err = json.Unmarshal(raw, &v.M); v.M == nil {
+				v.M = map[string]AttributeValue{}
+			}
+		case "SS":
+			err = json.Unmarshal(raw, &v.SS)
+		case "NS":
+			if err = json.Unmarshal(raw, &v.NS); err == nil {
+				for _, n := range v.NS {
+					if _, err = parseNumber(n); err != nil {
+						break
+					}
+				}
+			}
+		case "BS":
+			err = json.Unmarshal(raw, &v.BS)
+		default:
+			err = fmt.Errorf("unknown attribute type %v", field)
+		}
+		if err != nil {
+			return err
+		}
+		if (v.S == nil && field == "S") || (v.N == nil && field == "N") || (v.BOOL == nil && field == "BOOL") {
+			return fmt.Errorf("%v must not be null", field)
+		}
+		if strings.HasSuffix(field, "S") && field != "S" && len(v.SS)+len(v.NS)+len(v.BS) == 0 {
+			return fmt.Errorf("an %v set may not be empty", field)
+		}
+	}
+	return nil
+}
+
+//One attribute of the primary key of a table
+type KeySchemaElement struct {
+	AttributeName string
+	KeyType       string // HASH or RANGE
+}
+
+//The type of a key attribute: S, N or B
+type AttributeDefinition struct {
+	AttributeName string
+	AttributeType string
+}
+
+type ProvisionedThroughput struct {
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+}
+
+type BillingModeSummary struct {
+	BillingMode string
+}
+
+//A table as DescribeTable reports it, which is also how it is stored
+type ddbTable struct {
+	TableName             string
+	TableArn              string
+	TableStatus           string
+	CreationDateTime      float64
+	KeySchema             []KeySchemaElement
+	AttributeDefinitions  []AttributeDefinition
+	ProvisionedThroughput *ProvisionedThroughput `json:",omitempty"`
+	BillingModeSummary    *BillingModeSummary    `json:",omitempty"`
+	ItemCount             int64
+	TableSizeBytes        int64
+}
+
+func (t *ddbTable) hashKey() string {
+	return t.KeySchema[0].AttributeName
+}
+
+//Returns the name of the range key, or "" if the table has none
+func (t *ddbTable) rangeKey() string {
+	if len(t.KeySchema) < 2 {
+		return ""
+	}
+	return t.KeySchema[1].AttributeName
+}
+
+func (t *ddbTable) attributeType(name string) string {
+	for _, def := range t.AttributeDefinitions {
+		if def.AttributeName == name {
+			return def.AttributeType
+		}
+	}
+	return ""
+}
+
+//Checks that item holds every key attribute with its declared type, and
+//returns the hash key and the encoded range key, "" if the table has none
+func (t *ddbTable) keyOf(item DynamoDBItem) (AttributeValue, string, error) {
+	for _, element := range t.KeySchema {
+		value, ok := item[element.AttributeName]
+		if !ok {
+			return AttributeValue{}, "", validationError("missing the key %v in the item", element.AttributeName)
+		}
+		if keyType(value) != t.attributeType(element.AttributeName) {
+			return AttributeValue{}, "", validationError("type mismatch for key %v, expected %v", element.AttributeName, t.attributeType(element.AttributeName))
+		}
+		if (value.S != nil && *value.S == "") || (value.B != nil && len(value.B) == 0) {
+			return AttributeValue{}, "", validationError("the key %v must not be empty", element.AttributeName)
+		}
+	}
+	rangeID := ""
+	if t.rangeKey() != "" {
+		rangeID = encodeKeyValue(item[t.rangeKey()])
+	}
+	return item[t.hashKey()], rangeID, nil
+}
+
+//Checks that key holds exactly the key attributes of the table
+func (t *ddbTable) checkKey(key DynamoDBItem) (AttributeValue, string, error) {
+	if len(key) != len(t.KeySchema) {
+		return AttributeValue{}, "", validationError("the provided key element does not match the schema")
+	}
+	return t.keyOf(key)
+}
+
+//Returns the key attributes of item
+func (t *ddbTable) keyAttributes(item DynamoDBItem) DynamoDBItem {
+	key := make(DynamoDBItem)
+	for _, element := range t.KeySchema {
+		key[element.AttributeName] = item[element.AttributeName]
+	}
+	return key
+}
+
+//Returns S, N or B for a value that can be a key, or "" for any other
+func keyType(v AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return "S"
+	case v.N != nil:
+		return "N"
+	case v.B != nil:
+		return "B"
+	}
+	return ""
+}
+
+//Encodes a key value as its type followed by its value, with numbers in their
+//canonical form so 1 and 1.0 are the same key
+func encodeKeyValue(v AttributeValue) string {
+	switch {
+	case v.S != nil:
+		return "S" + *v.S
+	case v.N != nil:
+		if n, err := parseNumber(*v.N); err == nil {
+			return "N" + formatNumber(n)
+		}
+		return "N" + *v.N
+	}
+	return "B" + base64.StdEncoding.EncodeToString(v.B)
+}
+
+//An error reported to the client as the named DynamoDB exception
+type dynamoDBError struct {
+	name    string
+	status  int
+	message string
+}
+
+func (e *dynamoDBError) Error() string {
+	return e.name + ": " + e.message
+}
+
+func validationError(format string, args ...interface{}) error {
+	return &dynamoDBError{"ValidationException", http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+func tableNotFound(name string) error {
+	return &dynamoDBError{"ResourceNotFoundException", http.StatusBadRequest, "Requested resource not found: Table: " + name + " not found"}
+}
+
+//Serves the DynamoDB low-level JSON protocol on top of a DynamoServer, so the
+//AWS CLI and SDKs can talk to the cluster with --endpoint-url. It implements
+//CreateTable, DescribeTable, PutItem, GetItem, DeleteItem, UpdateItem and Query
+//on the hash key.
+//
+//Every request is a POST to / naming the operation in X-Amz-Target. Every item
+//is stored under its own key of the cluster, and the range keys of the items
+//with the same hash key are kept in an OR-Set that Query reads through. Writes
+//read the item, change it, and write it back with the context of the read,
+//retrying if another write got there first. Concurrent writes to the same item
+//through different nodes are resolved by keeping the latest
+type DynamoDBAPI struct {
+	server     *DynamoServer
+	operations map[string]func([]byte) (interface{}, error)
+	tables     sync.Map // name to *ddbTable. Tables never change once created
+}
+
+func NewDynamoDBAPI(server *DynamoServer) *DynamoDBAPI {
+	api := &DynamoDBAPI{server: server}
+	api.operations = map[string]func([]byte) (interface{}, error){
+		"CreateTable":   api.createTable,
+		"DescribeTable": api.describeTable,
+		"PutItem":       api.putItem,
+		"GetItem":       api.getItem,
+		"DeleteItem":    api.deleteItem,
+		"UpdateItem":    api.updateItem,
+		"Query":         api.query,
+	}
+	return api
+}
+
+func (api *DynamoDBAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, r.Method+" is not supported", http.StatusMethodNotAllowed)
+		return
+	}
+	target := r.Header.Get("X-Amz-Target")
+	operation, ok := api.operations[strings.TrimPrefix(target, DYNAMODB_TARGET_PREFIX)]
+	if !ok || !strings.HasPrefix(target, DYNAMODB_TARGET_PREFIX) {
+		writeDynamoDBError(w, &dynamoDBError{"UnknownOperationException", http.StatusBadRequest, "unknown operation " + target})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, dynamoDBMaxRequest))
+	if err != nil {
+		writeDynamoDBError(w, &dynamoDBError{"SerializationException", http.StatusBadRequest, err.Error()})
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		writeDynamoDBError(w, &dynamoDBError{"SerializationException", http.StatusBadRequest, err.Error()})
+		return
+	}
+	for _, field := range dynamoDBUnsupported {
+		if _, ok := fields[field]; ok {
+			writeDynamoDBError(w, validationError("%v is not supported", field))
+			return
+		}
+	}
+	response, err := operation(body)
+	if err != nil {
+		writeDynamoDBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", DYNAMODB_CONTENT_TYPE)
+	json.NewEncoder(w).Encode(response)
+}
+
+//Reports err as a DynamoDB exception. Errors of the cluster map onto the
+//exceptions the SDKs retry where that makes sense
+func writeDynamoDBError(w http.ResponseWriter, err error) {
+	var apiErr *dynamoDBError
+	if !errors.As(err, &apiErr) {
+		err = decodeError(err)
+		switch {
+		case errors.Is(err, ErrStaleContext):
+			apiErr = &dynamoDBError{"TransactionConflictException", http.StatusBadRequest, err.Error()}
+		case errors.Is(err, ErrNodeOffline), errors.Is(err, ErrQuorumNotMet):
+			apiErr = &dynamoDBError{"ServiceUnavailable", http.StatusServiceUnavailable, err.Error()}
+		default:
+			apiErr = &dynamoDBError{"InternalServerError", http.StatusInternalServerError, err.Error()}
+		}
+	}
+	w.Header().Set("Content-Type", DYNAMODB_CONTENT_TYPE)
+	w.WriteHeader(apiErr.status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.dynamodb.v20120810#" + apiErr.name,
+		"message": apiErr.message,
+	})
+}
+
+func decodeRequest(body []byte, request interface{}) error {
+	if err := json.Unmarshal(body, request); err != nil {
+		return validationError("%v", err)
+	}
+	return nil
+}
+
+//Reads key from the cluster. Siblings are resolved by keeping the latest
+//write, and the context returned descends from all of them, so writing it back
+//replaces them
+func (api *DynamoDBAPI) read(key string) ([]byte, bool, Context, error) {
+	var result DynamoResult
+	if err := api.server.Get(key, &result); err != nil {
+		return nil, false, Context{}, err
+	}
+	if len(result.EntryList) == 0 {
+		return nil, false, NewContext(NewVectorClock()), nil
+	}
+	latest := result.EntryList[0]
+	clocks := make([]VectorClock, 0, len(result.EntryList))
+	for _, entry := range result.EntryList {
+		clocks = append(clocks, entry.Context.Clock)
+		if entry.Timestamp > latest.Timestamp ||
+			(entry.Timestamp == latest.Timestamp && bytes.Compare(entry.Value, latest.Value) > 0) {
+			latest = entry
+		}
+	}
+	clock := NewVectorClock()
+	clock.Combine(clocks)
+	return latest.Value, true, NewContext(clock), nil
+}
+
+//Returns the table called name
+func (api *DynamoDBAPI) table(name string) (*ddbTable, error) {
+	if table, ok := api.tables.Load(name); ok {
+		return table.(*ddbTable), nil
+	}
+	value, found, _, err := api.read(dynamoDBTablePrefix + name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, tableNotFound(name)
+	}
+	table := new(ddbTable)
+	if err := json.Unmarshal(value, table); err != nil {
+		return nil, err
+	}
+	api.tables.Store(name, table)
+	return table, nil
+}
+
+//Returns the storage key of the item with the given hash key and encoded range
+//key. Both are escaped, so no two items share a key
+func itemKey(table *ddbTable, hash AttributeValue, rangeID string) string {
+	return dynamoDBItemPrefix + table.TableName + "/" + url.PathEscape(encodeKeyValue(hash)) + "/" + url.PathEscape(rangeID)
+}
+
+//Returns the storage key of the set of encoded range keys under hash
+func indexKey(table *ddbTable, hash AttributeValue) string {
+	return dynamoDBIndexPrefix + table.TableName + "/" + url.PathEscape(encodeKeyValue(hash))
+}
+
+//Returns the item with the given key, nil if there is none, and the context to
+//write it back with
+func (api *DynamoDBAPI) readItem(table *ddbTable, hash AttributeValue, rangeID string) (DynamoDBItem, Context, error) {
+	value, found, context, err := api.read(itemKey(table, hash, rangeID))
+	if err != nil || !found {
+		return nil, context, err
+	}
+	var item DynamoDBItem
+	if err := json.Unmarshal(value, &item); err != nil {
+		return nil, Context{}, err
+	}
+	return item, context, nil
+}
+
+//Returns the items stored under hash, by encoded range key. Range keys in the
+//index whose item is gone are skipped
+func (api *DynamoDBAPI) readPartition(table *ddbTable, hash AttributeValue) (map[string]DynamoDBItem, error) {
+	var result DynamoResult
+	if err := api.server.Get(indexKey(table, hash), &result); err != nil {
+		return nil, err
+	}
+	index := NewORSet()
+	for _, entry := range result.EntryList {
+		set, err := DecodeCRDT(entry)
+		if err != nil {
+			return nil, err
+		}
+		if err := index.Merge(set); err != nil {
+			return nil, err
+		}
+	}
+	partition := make(map[string]DynamoDBItem)
+	for _, rangeID := range index.Elements() {
+		item, _, err := api.readItem(table, hash, rangeID)
+		if err != nil {
+			return nil, err
+		}
+		if item != nil {
+			partition[rangeID] = item
+		}
+	}
+	return partition, nil
+}
+
+//Reads the item with the given key, lets update change it, and writes it back,
+//deleting it if update returns nil. update gets nil if there is no such item.
+//It runs again if another write got to the coordinator first. The index of the
+//hash key is updated once the item is written, so a Query never lists an item
+//that was not acknowledged
+func (api *DynamoDBAPI) updateStoredItem(table *ddbTable, hash AttributeValue, rangeID string, update func(DynamoDBItem) (DynamoDBItem, error)) error {
+	key := itemKey(table, hash, rangeID)
+	var err error
+	for attempt := 0; attempt < DYNAMODB_WRITE_ATTEMPTS; attempt++ {
+		current, context, readErr := api.readItem(table, hash, rangeID)
+		if readErr != nil {
+			return readErr
+		}
+		item, updateErr := update(current)
+		if updateErr != nil {
+			return updateErr
+		}
+		if item == nil && current == nil {
+			return nil
+		}
+
+		var result bool
+		if item == nil {
+			err = api.server.Delete(NewDeleteArgs(key, context), &result)
+		} else {
+			value, _ := json.Marshal(item)
+			err = api.server.Put(NewPutArgs(key, context, value), &result)
+		}
+		if err == nil && result {
+			return api.updateIndex(table, hash, rangeID, item != nil)
+		}
+		if err != nil && !errors.Is(decodeError(err), ErrStaleContext) {
+			return err
+		}
+	}
+	if err == nil {
+		err = ErrStaleContext
+	}
+	return err
+}
+
+//Adds rangeID to the index of hash after its item was written, or removes it
+//after the item was deleted. A write that raced the delete may have added
+//rangeID before the remove, so the item is read again and indexed again if it
+//came back
+func (api *DynamoDBAPI) updateIndex(table *ddbTable, hash AttributeValue, rangeID string, written bool) error {
+	args := SetArgs{Key: indexKey(table, hash), Element: rangeID}
+	var result bool
+	if written {
+		return api.server.AddToSet(args, &result)
+	}
+	if err := api.server.RemoveFromSet(args, &result); err != nil {
+		return err
+	}
+	item, _, err := api.readItem(table, hash, rangeID)
+	if err != nil || item == nil {
+		return err
+	}
+	return api.server.AddToSet(args, &result)
+}
+
+type createTableRequest struct {
+	TableName             string
+	KeySchema             []KeySchemaElement
+	AttributeDefinitions  []AttributeDefinition
+	BillingMode           string
+	ProvisionedThroughput *ProvisionedThroughput
+}
+
+func (api *DynamoDBAPI) createTable(body []byte) (interface{}, error) {
+	var request createTableRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	if !dynamoDBTableName.MatchString(request.TableName) {
+		return nil, validationError("invalid table name %q", request.TableName)
+	}
+	schema := request.KeySchema
+	if len(schema) == 0 || len(schema) > 2 || schema[0].KeyType != "HASH" ||
+		(len(schema) == 2 && (schema[1].KeyType != "RANGE" || schema[1].AttributeName == schema[0].AttributeName)) {
+		return nil, validationError("the key schema must be a HASH key, optionally followed by a RANGE key")
+	}
+	if len(request.AttributeDefinitions) != len(schema) {
+		return nil, validationError("the attribute definitions must define exactly the key attributes")
+	}
+	table := &ddbTable{
+		TableName:             request.TableName,
+		TableArn:              "arn:aws:dynamodb:local:000000000000:table/" + request.TableName,
+		TableStatus:           "ACTIVE",
+		CreationDateTime:      float64(time.Now().UnixNano()) / float64(time.Second),
+		KeySchema:             schema,
+		AttributeDefinitions:  request.AttributeDefinitions,
+		ProvisionedThroughput: request.ProvisionedThroughput,
+	}
+	if request.BillingMode != "" {
+		table.BillingModeSummary = &BillingModeSummary{BillingMode: request.BillingMode}
+	}
+	for _, element := range schema {
+		if t := table.attributeType(element.AttributeName); t != "S" && t != "N" && t != "B" {
+			return nil, validationError("the key %v must be defined with type S, N or B", element.AttributeName)
+		}
+	}
+
+	key := dynamoDBTablePrefix + request.TableName
+	_, found, context, err := api.read(key)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return nil, &dynamoDBError{"ResourceInUseException", http.StatusBadRequest, "Table already exists: " + request.TableName}
+	}
+	value, _ := json.Marshal(table)
+	var result bool
+	if err := api.server.Put(NewPutArgs(key, context, value), &result); err != nil {
+		return nil, err
+	}
+	if !result {
+		return nil, ErrStaleContext
+	}
+	return map[string]interface{}{"TableDescription": table}, nil
+}
+
+type tableRequest struct {
+	TableName string
+}
+
+func (api *DynamoDBAPI) describeTable(body []byte) (interface{}, error) {
+	var request tableRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	table, err := api.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"Table": table}, nil
+}
+
+//The response of the item operations. Attributes holds the item as
+//ReturnValues asked for
+type itemResponse struct {
+	Item       DynamoDBItem `json:",omitempty"`
+	Attributes DynamoDBItem `json:",omitempty"`
+}
+
+type putItemRequest struct {
+	TableName    string
+	Item         DynamoDBItem
+	ReturnValues string
+}
+
+func (api *DynamoDBAPI) putItem(body []byte) (interface{}, error) {
+	var request putItemRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	if err := checkReturnValues(request.ReturnValues, "NONE", "ALL_OLD"); err != nil {
+		return nil, err
+	}
+	table, err := api.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	hash, rangeID, err := table.keyOf(request.Item)
+	if err != nil {
+		return nil, err
+	}
+	var old DynamoDBItem
+	err = api.updateStoredItem(table, hash, rangeID, func(item DynamoDBItem) (DynamoDBItem, error) {
+		old = item
+		return request.Item, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if request.ReturnValues == "ALL_OLD" {
+		return itemResponse{Attributes: old}, nil
+	}
+	return itemResponse{}, nil
+}
+
+type getItemRequest struct {
+	TableName                string
+	Key                      DynamoDBItem
+	ProjectionExpression     string
+	ExpressionAttributeNames map[string]string
+}
+
+func (api *DynamoDBAPI) getItem(body []byte) (interface{}, error) {
+	var request getItemRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	table, err := api.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	hash, rangeID, err := table.checkKey(request.Key)
+	if err != nil {
+		return nil, err
+	}
+	item, _, err := api.readItem(table, hash, rangeID)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return itemResponse{}, nil
+	}
+	if item, err = project(item, request.ProjectionExpression, request.ExpressionAttributeNames); err != nil {
+		return nil, err
+	}
+	return itemResponse{Item: item}, nil
+}
+
+type deleteItemRequest struct {
+	TableName    string
+	Key          DynamoDBItem
+	ReturnValues string
+}
+
+func (api *DynamoDBAPI) deleteItem(body []byte) (interface{}, error) {
+	var request deleteItemRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	if err := checkReturnValues(request.ReturnValues, "NONE", "ALL_OLD"); err != nil {
+		return nil, err
+	}
+	table, err := api.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	hash, rangeID, err := table.checkKey(request.Key)
+	if err != nil {
+		return nil, err
+	}
+	var old DynamoDBItem
+	err = api.updateStoredItem(table, hash, rangeID, func(item DynamoDBItem) (DynamoDBItem, error) {
+		old = item
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if request.ReturnValues == "ALL_OLD" {
+		return itemResponse{Attributes: old}, nil
+	}
+	return itemResponse{}, nil
+}
+
+type updateItemRequest struct {
+	TableName                 string
+	Key                       DynamoDBItem
+	UpdateExpression          string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]AttributeValue
+	ReturnValues              string
+}
+
+//Applies an update expression to the item with the given key, creating it if
+//it does not exist
+func (api *DynamoDBAPI) updateItem(body []byte) (interface{}, error) {
+	var request updateItemRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	if err := checkReturnValues(request.ReturnValues, "NONE", "ALL_OLD", "UPDATED_OLD", "ALL_NEW", "UPDATED_NEW"); err != nil {
+		return nil, err
+	}
+	table, err := api.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	hash, rangeID, err := table.checkKey(request.Key)
+	if err != nil {
+		return nil, err
+	}
+	var old, updated DynamoDBItem
+	err = api.updateStoredItem(table, hash, rangeID, func(item DynamoDBItem) (DynamoDBItem, error) {
+		old = item
+		updated = make(DynamoDBItem)
+		for name, value := range item {
+			updated[name] = value
+		}
+		for name, value := range request.Key {
+			updated[name] = value
+		}
+		if request.UpdateExpression != "" {
+			err := applyUpdateExpression(updated, request.UpdateExpression, request.ExpressionAttributeNames, request.ExpressionAttributeValues)
+			if err != nil {
+				return nil, validationError("invalid UpdateExpression: %v", err)
+			}
+		}
+		for name, value := range request.Key {
+			if !reflect.DeepEqual(updated[name], value) {
+				return nil, validationError("cannot update attribute %v, it is part of the key", name)
+			}
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch request.ReturnValues {
+	case "ALL_OLD":
+		return itemResponse{Attributes: old}, nil
+	case "ALL_NEW":
+		return itemResponse{Attributes: updated}, nil
+	case "UPDATED_OLD":
+		return itemResponse{Attributes: changedAttributes(old, updated, old)}, nil
+	case "UPDATED_NEW":
+		return itemResponse{Attributes: changedAttributes(old, updated, updated)}, nil
+	}
+	return itemResponse{}, nil
+}
+
+//Returns the attributes of from that differ between old and updated
+func changedAttributes(old, updated, from DynamoDBItem) DynamoDBItem {
+	changed := make(DynamoDBItem)
+	for name, value := range from {
+		if !reflect.DeepEqual(old[name], updated[name]) {
+			changed[name] = value
+		}
+	}
+	return changed
+}
+
+type queryRequest struct {
+	TableName                 string
+	KeyConditionExpression    string
+	ExpressionAttributeNames  map[string]string
+	ExpressionAttributeValues map[string]AttributeValue
+	ProjectionExpression      string
+	ScanIndexForward          *bool
+	Limit                     int
+	ExclusiveStartKey         DynamoDBItem
+	Select                    string
+}
+
+type queryResponse struct {
+	Items            *[]DynamoDBItem `json:",omitempty"` // nil when Select is COUNT
+	Count            int
+	ScannedCount     int
+	LastEvaluatedKey DynamoDBItem `json:",omitempty"`
+}
+
+//Returns the items with one hash key, in the order of their range key
+func (api *DynamoDBAPI) query(body []byte) (interface{}, error) {
+	var request queryRequest
+	if err := decodeRequest(body, &request); err != nil {
+		return nil, err
+	}
+	if request.Select != "" && request.Select != "ALL_ATTRIBUTES" && request.Select != "COUNT" {
+		return nil, validationError("Select %v is not supported", request.Select)
+	}
+	if request.Limit < 0 {
+		return nil, validationError("Limit must be positive")
+	}
+	table, err := api.table(request.TableName)
+	if err != nil {
+		return nil, err
+	}
+	hash, condition, err := parseKeyCondition(request.KeyConditionExpression, table, request.ExpressionAttributeNames, request.ExpressionAttributeValues)
+	if err != nil {
+		return nil, validationError("invalid KeyConditionExpression: %v", err)
+	}
+	if keyType(hash) != table.attributeType(table.hashKey()) {
+		return nil, validationError("type mismatch for key %v", table.hashKey())
+	}
+	partition, err := api.readPartition(table, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]DynamoDBItem, 0, len(partition))
+	rangeKey := table.rangeKey()
+	for _, item := range partition {
+		if condition != nil {
+			match, err := condition.matches(item[rangeKey])
+			if err != nil {
+				return nil, validationError("invalid KeyConditionExpression: %v", err)
+			}
+			if !match {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	forward := request.ScanIndexForward == nil || *request.ScanIndexForward
+	if rangeKey != "" {
+		sort.Slice(items, func(i, j int) bool {
+			cmp, _ := compareKeys(items[i][rangeKey], items[j][rangeKey])
+			return (cmp < 0) == forward && cmp != 0
+		})
+	}
+	if request.ExclusiveStartKey != nil && rangeKey != "" {
+		if _, _, err := table.checkKey(request.ExclusiveStartKey); err != nil {
+			return nil, err
+		}
+		start := request.ExclusiveStartKey[rangeKey]
+		remaining := items[:0]
+		for _, item := range items {
+			if cmp, _ := compareKeys(item[rangeKey], start); (cmp > 0) == forward && cmp != 0 {
+				remaining = append(remaining, item)
+			}
+		}
+		items = remaining
+	} else if request.ExclusiveStartKey != nil {
+		items = nil
+	}
+
+	var response queryResponse
+	if request.Limit > 0 && len(items) > request.Limit {
+		items = items[:request.Limit]
+		response.LastEvaluatedKey = table.keyAttributes(items[len(items)-1])
+	}
+	response.Count = len(items)
+	response.ScannedCount = len(items)
+	if request.Select != "COUNT" {
+		projected := make([]DynamoDBItem, 0, len(items))
+		for _, item := range items {
+			if item, err = project(item, request.ProjectionExpression, request.ExpressionAttributeNames); err != nil {
+				return nil, err
+			}
+			projected = append(projected, item)
+		}
+		response.Items = &projected
+	}
+	return response, nil
+}
+
+//Returns the attributes of item named by a projection expression, or all of
+//them if there is none
+func project(item DynamoDBItem, expr string, names map[string]string) (DynamoDBItem, error) {
+	if expr == "" {
+		return item, nil
+	}
+	projected, err := applyProjection(item, expr, names)
+	if err != nil {
+		return nil, validationError("invalid ProjectionExpression: %v", err)
+	}
+	return projected, nil
+}
+
+func checkReturnValues(returnValues string, allowed ...string) error {
+	if returnValues == "" {
+		return nil
+	}
+	for _, value := range allowed {
+		if returnValues == value {
+			return nil
+		}
+	}
+	return validationError("ReturnValues %v is not supported by this operation", returnValues)
+}
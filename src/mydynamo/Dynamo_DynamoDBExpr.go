@@ -0,0 +1,544 @@
+package mydynamo
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//The expressions of the DynamoDB API that the endpoint understands: update
+//expressions with SET, REMOVE, ADD and DELETE on top-level attributes, key
+//condition expressions on the hash key with an optional condition on the range
+//key, and projection expressions naming top-level attributes
+
+//Splits an expression into names, #name and :value placeholders, and the
+//punctuation and comparison operators
+func tokenizeExpression(expr string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("=+-(),", c):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '<' || c == '>':
+			if i+1 < len(expr) && (expr[i+1] == '=' || (c == '<' && expr[i+1] == '>')) {
+				tokens = append(tokens, expr[i:i+2])
+				i += 2
+			} else {
+				tokens = append(tokens, string(c))
+				i++
+			}
+		case c == '#' || c == ':' || c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j]))) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		case c == '.' || c == '[':
+			return nil, fmt.Errorf("nested attribute paths are not supported")
+		default:
+			return nil, fmt.Errorf("unexpected %q in expression", c)
+		}
+	}
+	return tokens, nil
+}
+
+//Reads the tokens of an expression, resolving placeholders as it goes
+type exprParser struct {
+	tokens []string
+	pos    int
+	names  map[string]string
+	values map[string]AttributeValue
+}
+
+func newExprParser(expr string, names map[string]string, values map[string]AttributeValue) (*exprParser, error) {
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &exprParser{tokens: tokens, names: names, values: values}, nil
+}
+
+func (p *exprParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *exprParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+//Consumes token, which is matched without regard to case
+func (p *exprParser) expect(token string) error {
+	if got := p.next(); !strings.EqualFold(got, token) {
+		return fmt.Errorf("expected %q, found %q", token, got)
+	}
+	return nil
+}
+
+//Reads an attribute name, resolving a #name placeholder
+func (p *exprParser) path() (string, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return "", fmt.Errorf("expected an attribute name")
+	case strings.HasPrefix(token, "#"):
+		name, ok := p.names[token]
+		if !ok {
+			return "", fmt.Errorf("undefined expression attribute name %v", token)
+		}
+		return name, nil
+	case strings.HasPrefix(token, ":") || !isIdentifier(token):
+		return "", fmt.Errorf("expected an attribute name, found %q", token)
+	}
+	return token, nil
+}
+
+//Reads a :value placeholder
+func (p *exprParser) value() (AttributeValue, error) {
+	token := p.next()
+	value, ok := p.values[token]
+	if !strings.HasPrefix(token, ":") || !ok {
+		return AttributeValue{}, fmt.Errorf("undefined expression attribute value %q", token)
+	}
+	return value, nil
+}
+
+func isIdentifier(token string) bool {
+	return token != "" && strings.IndexFunc(token, func(c rune) bool {
+		return c != '_' && !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) < 0
+}
+
+//Applies an update expression to item
+func applyUpdateExpression(item DynamoDBItem, expr string, names map[string]string, values map[string]AttributeValue) error {
+	p, err := newExprParser(expr, names, values)
+	if err != nil {
+		return err
+	}
+	if p.done() {
+		return fmt.Errorf("empty update expression")
+	}
+	for !p.done() {
+		clause := strings.ToUpper(p.next())
+		for {
+			switch clause {
+			case "SET":
+				err = p.set(item)
+			case "REMOVE":
+				var name string
+				if name, err = p.path(); err == nil {
+					delete(item, name)
+				}
+			case "ADD", "DELETE":
+				err = p.addOrDelete(item, clause == "ADD")
+			default:
+				err = fmt.Errorf("unknown update clause %q", clause)
+			}
+			if err != nil {
+				return err
+			}
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+	}
+	return nil
+}
+
+//Applies one SET action: path = operand, optionally plus or minus another
+func (p *exprParser) set(item DynamoDBItem) error {
+	name, err := p.path()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	value, err := p.operand(item)
+	if err != nil {
+		return err
+	}
+	if op := p.peek(); op == "+" || op == "-" {
+		p.next()
+		other, err := p.operand(item)
+		if err != nil {
+			return err
+		}
+		if value, err = addNumbers(value, other, op == "-"); err != nil {
+			return err
+		}
+	}
+	item[name] = value
+	return nil
+}
+
+//Reads a value, an attribute of item, or an if_not_exists or list_append call
+func (p *exprParser) operand(item DynamoDBItem) (AttributeValue, error) {
+	token := p.peek()
+	switch {
+	case strings.HasPrefix(token, ":"):
+		return p.value()
+	case strings.EqualFold(token, "if_not_exists"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return AttributeValue{}, err
+		}
+		name, err := p.path()
+		if err != nil {
+			return AttributeValue{}, err
+		}
+		if err := p.expect(","); err != nil {
+			return AttributeValue{}, err
+		}
+		fallback, err := p.operand(item)
+		if err != nil {
+			return AttributeValue{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return AttributeValue{}, err
+		}
+		if current, ok := item[name]; ok {
+			return current, nil
+		}
+		return fallback, nil
+	case strings.EqualFold(token, "list_append"):
+		p.next()
+		if err := p.expect("("); err != nil {
+			return AttributeValue{}, err
+		}
+		first, err := p.operand(item)
+		if err != nil {
+			return AttributeValue{}, err
+		}
+		if err := p.expect(","); err != nil {
+			return AttributeValue{}, err
+		}
+		second, err := p.operand(item)
+		if err != nil {
+			return AttributeValue{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return AttributeValue{}, err
+		}
+		if first.L == nil || second.L == nil {
+			return AttributeValue{}, fmt.Errorf("list_append takes two lists")
+		}
+		return AttributeValue{L: append(append([]AttributeValue{}, first.L...), second.L...)}, nil
+	}
+	name, err := p.path()
+	if err != nil {
+		return AttributeValue{}, err
+	}
+	current, ok := item[name]
+	if !ok {
+		return AttributeValue{}, fmt.Errorf("the attribute %v in the update expression does not exist", name)
+	}
+	return current, nil
+}
+
+//Applies one ADD or DELETE action. ADD adds to a number or a set, creating the
+//attribute if it is missing, and DELETE removes elements from a set
+func (p *exprParser) addOrDelete(item DynamoDBItem, add bool) error {
+	name, err := p.path()
+	if err != nil {
+		return err
+	}
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+	current, ok := item[name]
+	switch {
+	case add && value.N != nil:
+		if !ok {
+			current = AttributeValue{N: stringPtr("0")}
+		}
+		if item[name], err = addNumbers(current, value, false); err != nil {
+			return err
+		}
+	case add && value.isSet():
+		if !ok {
+			item[name] = value
+			return nil
+		}
+		if item[name], err = updateSet(current, value, true); err != nil {
+			return err
+		}
+	case !add && value.isSet():
+		if !ok {
+			return nil
+		}
+		if current, err = updateSet(current, value, false); err != nil {
+			return err
+		}
+		if current.isEmptySet() {
+			delete(item, name)
+		} else {
+			item[name] = current
+		}
+	default:
+		return fmt.Errorf("an operand of the update expression has the wrong type")
+	}
+	return nil
+}
+
+//Returns a + b, or a - b if subtract is set
+func addNumbers(a, b AttributeValue, subtract bool) (AttributeValue, error) {
+	if a.N == nil || b.N == nil {
+		return AttributeValue{}, fmt.Errorf("an operand of the update expression has the wrong type")
+	}
+	x, err := parseNumber(*a.N)
+	if err != nil {
+		return AttributeValue{}, err
+	}
+	y, err := parseNumber(*b.N)
+	if err != nil {
+		return AttributeValue{}, err
+	}
+	if subtract {
+		y.Neg(y)
+	}
+	return AttributeValue{N: stringPtr(formatNumber(x.Add(x, y)))}, nil
+}
+
+func parseNumber(n string) (*big.Float, error) {
+	f, _, err := big.ParseFloat(strings.TrimSpace(n), 10, 200, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", n)
+	}
+	return f, nil
+}
+
+func formatNumber(f *big.Float) string {
+	return f.Text('f', -1)
+}
+
+//Adds the elements of other to set, or removes them if add is false. Both
+//must be sets of the same type
+func updateSet(set, other AttributeValue, add bool) (AttributeValue, error) {
+	switch {
+	case set.SS != nil && other.SS != nil:
+		set.SS = updateStrings(set.SS, other.SS, add)
+	case set.NS != nil && other.NS != nil:
+		set.NS = updateStrings(set.NS, other.NS, add)
+	case set.BS != nil && other.BS != nil:
+		encoded := make([]string, 0, len(set.BS))
+		for _, b := range set.BS {
+			encoded = append(encoded, string(b))
+		}
+		changes := make([]string, 0, len(other.BS))
+		for _, b := range other.BS {
+			changes = append(changes, string(b))
+		}
+		set.BS = nil
+		for _, b := range updateStrings(encoded, changes, add) {
+			set.BS = append(set.BS, []byte(b))
+		}
+		if set.BS == nil {
+			set.BS = [][]byte{}
+		}
+	default:
+		return AttributeValue{}, fmt.Errorf("an operand of the update expression has the wrong type")
+	}
+	return set, nil
+}
+
+func updateStrings(set, changes []string, add bool) []string {
+	members := make(map[string]bool, len(set))
+	for _, s := range set {
+		members[s] = true
+	}
+	for _, s := range changes {
+		if add {
+			members[s] = true
+		} else {
+			delete(members, s)
+		}
+	}
+	result := make([]string, 0, len(members))
+	for s := range members {
+		result = append(result, s)
+	}
+	sort.Strings(result)
+	return result
+}
+
+//A condition on the range key of a Query
+type rangeCondition struct {
+	op     string // =, <, <=, >, >=, BETWEEN or BEGINS_WITH
+	values []AttributeValue
+}
+
+//Parses a key condition expression: an equality on the hash key, optionally
+//followed by AND and a condition on the range key. Returns the value of the
+//hash key and the condition on the range key, nil if there is none
+func parseKeyCondition(expr string, table *ddbTable, names map[string]string, values map[string]AttributeValue) (AttributeValue, *rangeCondition, error) {
+	p, err := newExprParser(expr, names, values)
+	if err != nil {
+		return AttributeValue{}, nil, err
+	}
+	var hash *AttributeValue
+	var condition *rangeCondition
+	for {
+		name, cond, err := p.keyCondition()
+		if err != nil {
+			return AttributeValue{}, nil, err
+		}
+		switch {
+		case name == table.hashKey() && cond.op == "=" && hash == nil:
+			hash = &cond.values[0]
+		case name == table.rangeKey() && name != "" && condition == nil:
+			condition = cond
+		default:
+			return AttributeValue{}, nil, fmt.Errorf("query key condition not supported")
+		}
+		if p.done() {
+			break
+		}
+		if err := p.expect("AND"); err != nil {
+			return AttributeValue{}, nil, err
+		}
+	}
+	if hash == nil {
+		return AttributeValue{}, nil, fmt.Errorf("query condition missed key schema element: %v", table.hashKey())
+	}
+	return *hash, condition, nil
+}
+
+//Reads one condition on a key: name op :value, name BETWEEN :a AND :b, or
+//begins_with(name, :value)
+func (p *exprParser) keyCondition() (string, *rangeCondition, error) {
+	if strings.EqualFold(p.peek(), "begins_with") {
+		p.next()
+		if err := p.expect("("); err != nil {
+			return "", nil, err
+		}
+		name, err := p.path()
+		if err != nil {
+			return "", nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return "", nil, err
+		}
+		prefix, err := p.value()
+		if err != nil {
+			return "", nil, err
+		}
+		return name, &rangeCondition{op: "BEGINS_WITH", values: []AttributeValue{prefix}}, p.expect(")")
+	}
+	name, err := p.path()
+	if err != nil {
+		return "", nil, err
+	}
+	op := strings.ToUpper(p.next())
+	switch op {
+	case "=", "<", "<=", ">", ">=":
+		value, err := p.value()
+		return name, &rangeCondition{op: op, values: []AttributeValue{value}}, err
+	case "BETWEEN":
+		low, err := p.value()
+		if err != nil {
+			return "", nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return "", nil, err
+		}
+		high, err := p.value()
+		return name, &rangeCondition{op: op, values: []AttributeValue{low, high}}, err
+	}
+	return "", nil, fmt.Errorf("unsupported key condition operator %q", op)
+}
+
+//Returns true if value meets the condition
+func (c *rangeCondition) matches(value AttributeValue) (bool, error) {
+	if c.op == "BEGINS_WITH" {
+		switch {
+		case value.S != nil && c.values[0].S != nil:
+			return strings.HasPrefix(*value.S, *c.values[0].S), nil
+		case value.B != nil && c.values[0].B != nil:
+			return bytes.HasPrefix(value.B, c.values[0].B), nil
+		}
+		return false, fmt.Errorf("begins_with takes a string or binary key")
+	}
+	cmp, err := compareKeys(value, c.values[0])
+	if err != nil {
+		return false, err
+	}
+	switch c.op {
+	case "=":
+		return cmp == 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	high, err := compareKeys(value, c.values[1])
+	return cmp >= 0 && high <= 0, err
+}
+
+//Compares two key values of the same type: numbers by value, strings and
+//binaries byte by byte
+func compareKeys(a, b AttributeValue) (int, error) {
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S), nil
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B), nil
+	case a.N != nil && b.N != nil:
+		x, err := parseNumber(*a.N)
+		if err != nil {
+			return 0, err
+		}
+		y, err := parseNumber(*b.N)
+		if err != nil {
+			return 0, err
+		}
+		return x.Cmp(y), nil
+	}
+	return 0, fmt.Errorf("key values have different types")
+}
+
+//Returns the attributes of item named by a projection expression
+func applyProjection(item DynamoDBItem, expr string, names map[string]string) (DynamoDBItem, error) {
+	p, err := newExprParser(expr, names, nil)
+	if err != nil {
+		return nil, err
+	}
+	projected := make(DynamoDBItem)
+	for {
+		name, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := item[name]; ok {
+			projected[name] = value
+		}
+		if p.done() {
+			return projected, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
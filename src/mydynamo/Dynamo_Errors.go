@@ -0,0 +1,65 @@
+package mydynamo
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"strings"
+)
+
+//The node that received the request is crashed or has left the cluster
+var ErrNodeOffline = errors.New("node offline")
+
+//The write carried a context that is older than, or equal to, a version the
+//node already stores
+var ErrStaleContext = errors.New("stale context rejected")
+
+//Fewer than W replicas stored the write
+var ErrQuorumNotMet = errors.New("quorum not met")
+
+//The kinds of error a server can report, in the order they are matched
+var dynamoErrorKinds = []error{ErrNodeOffline, ErrStaleContext, ErrQuorumNotMet}
+
+//An error reported by a server. Kind is one of the errors above, or nil if the
+//server reported some other failure, and can be tested with errors.Is
+type DynamoError struct {
+	Kind    error
+	Message string // the message the server sent
+}
+
+func (e *DynamoError) Error() string {
+	return e.Message
+}
+
+func (e *DynamoError) Unwrap() error {
+	return e.Kind
+}
+
+//Returns the error a server reported through net/rpc, which only carries its
+//message, as a DynamoError of the matching kind. Other errors are returned as is
+func decodeError(err error) error {
+	serverErr, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	decoded := &DynamoError{Message: string(serverErr)}
+	for _, kind := range dynamoErrorKinds {
+		if strings.Contains(decoded.Message, kind.Error()) {
+			decoded.Kind = kind
+			break
+		}
+	}
+	return decoded
+}
+
+//Returns true if err was reported by a server, as opposed to a broken or hung
+//connection
+func isServerError(err error) bool {
+	var dynamoErr *DynamoError
+	_, ok := err.(rpc.ServerError)
+	return ok || errors.As(err, &dynamoErr)
+}
+
+func (s *DynamoServer) offlineError() error {
+	return fmt.Errorf("server %v: %w", s.nodeID, ErrNodeOffline)
+}
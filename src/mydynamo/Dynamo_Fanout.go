@@ -0,0 +1,122 @@
+package mydynamo
+
+import (
+	"fmt"
+	"log"
+	"net/rpc"
+	"time"
+)
+
+var requestTimeout time.Duration = time.Duration(DEFAULT_REQUEST_TIMEOUT) * time.Millisecond
+
+//Sets how long a node waits for a peer to answer a single request. Zero waits
+//forever
+func SetRequestTimeout(timeout time.Duration) {
+	requestTimeout = timeout
+}
+
+//Calls method on conn, giving up after requestTimeout so a peer that hangs can
+//not block the caller. A call that times out may still complete later, so the
+//caller must not read reply unless the call succeeded
+func callWithTimeout(conn *rpc.Client, method string, args interface{}, reply interface{}) error {
+	if requestTimeout <= 0 {
+		return conn.Call(method, args, reply)
+	}
+	call := conn.Go(method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return fmt.Errorf("%v timed out after %v", method, requestTimeout)
+	}
+}
+
+//The answer of one replica to a request sent by fanOut
+type replicaResponse struct {
+	replica int         // preferenceList index of the replica
+	reply   interface{} // the reply made by newReply, only valid if err is nil
+	err     error
+}
+
+//Returns the entries of a ReplicateGet response
+func (r replicaResponse) entries() ([]ObjectEntry, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	result, err := UnmarshalDynamoResult(*r.reply.(*[]byte))
+	return result.EntryList, err
+}
+
+//Sends method to every replica at once, each call with its own reply made by
+//newReply. The returned channel receives one response per replica in the order
+//they arrive. It is buffered, so replicas that answer after the caller stopped
+//listening never block
+func (v *clusterView) fanOut(replicas []int, method string, args interface{}, newReply func() interface{}) chan replicaResponse {
+	responses := make(chan replicaResponse, len(replicas))
+	for _, i := range replicas {
+		go func(i int) {
+			reply := newReply()
+			err := v.call(i, method, args, reply)
+			responses <- replicaResponse{replica: i, reply: reply, err: err}
+		}(i)
+	}
+	return responses
+}
+
+//Returns the replicas other than this node that the failure detector does not
+//consider dead, followed by the ones it does
+func (s *DynamoServer) liveReplicas(v *clusterView, replicas []int) ([]int, []int) {
+	live := make([]int, 0, len(replicas))
+	dead := make([]int, 0)
+	for _, i := range replicas {
+		if skipNode(v.pListLoc, i) {
+			continue
+		}
+		if s.isDead(v, i) {
+			dead = append(dead, i)
+		} else {
+			live = append(live, i)
+		}
+	}
+	return live, dead
+}
+
+//Collects the PutOnce responses that arrived after a Put returned. Replicas
+//that stored the write acknowledge its tombstone and no longer need it from
+//the Gossiper, the others keep it queued for the next Gossip
+func (s *DynamoServer) finishPut(v *clusterView, value PutArgs, responses chan replicaResponse, outstanding int) {
+	for ; outstanding > 0; outstanding-- {
+		response := <-responses
+		node := v.preferenceList[response.replica]
+		if response.err != nil {
+			log.Println(DYNAMO_SERVER, "write of", value.Key, "to", node, "failed:", response.err)
+			continue
+		}
+		v.gossiper[response.replica].ConsumeVersion(value.Key, value.Context.Clock)
+		if value.Tombstone {
+			s.tombstones.Ack(value.Key, value.Context.Clock, memberKey(node))
+		}
+	}
+}
+
+//Collects the GetOnce responses that arrived after a Get returned, then repairs
+//every replica that answered against the versions all of them returned
+func (s *DynamoServer) finishGet(v *clusterView, key string, responses map[int][]ObjectEntry, remaining chan replicaResponse, outstanding int) {
+	for ; outstanding > 0; outstanding-- {
+		response := <-remaining
+		if entries, err := response.entries(); err == nil {
+			responses[response.replica] = entries
+		}
+	}
+	lists := make([][]ObjectEntry, 0, len(responses))
+	for _, entries := range responses {
+		lists = append(lists, entries)
+	}
+	reconciled := DynamoResult{EntryList: mergeCRDTEntries(MergeSiblings(lists...))}
+	RemoveResultAncestors(&reconciled)
+	if stale := staleReplicas(key, responses, reconciled.EntryList); len(stale) > 0 {
+		s.readRepair(v, stale)
+	}
+}
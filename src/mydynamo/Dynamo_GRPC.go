@@ -0,0 +1,188 @@
+package mydynamo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//Full name of the gRPC service, as declared in dynamo.proto
+const GRPC_SERVICE string = "mydynamo.Dynamo"
+
+//Serves the methods of a DynamoServer over gRPC. Requests carry their deadline,
+//and a request whose deadline passes returns DeadlineExceeded while the server
+//finishes the operation in the background, as net/rpc clients already see
+type grpcService struct {
+	server *DynamoServer
+}
+
+//Returns a gRPC server for the Dynamo service of dynamoServer. It only knows
+//the messages of dynamo.proto, so it can not host other services
+func NewGRPCServer(dynamoServer *DynamoServer) *grpc.Server {
+	grpcServer := grpc.NewServer(grpc.ForceServerCodec(protoCodec{}))
+	grpcServer.RegisterService(&dynamoServiceDesc, &grpcService{server: dynamoServer})
+	return grpcServer
+}
+
+//Routes gRPC requests, which are HTTP/2 with a gRPC content type, to grpcServer
+//and every other request to handler
+func withGRPC(grpcServer *grpc.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+var dynamoServiceDesc = grpc.ServiceDesc{
+	ServiceName: GRPC_SERVICE,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		unaryMethod("Put", func() interface{} { return new(PutArgs) }, func(s *DynamoServer, req interface{}) (interface{}, error) {
+			reply := new(grpcBool)
+			return reply, s.Put(*req.(*PutArgs), &reply.Result)
+		}),
+		unaryMethod("Get", func() interface{} { return new(grpcKey) }, func(s *DynamoServer, req interface{}) (interface{}, error) {
+			reply := new(DynamoResult)
+			return reply, s.Get(req.(*grpcKey).Key, reply)
+		}),
+		unaryMethod("PutOnce", func() interface{} { return new(PutArgs) }, func(s *DynamoServer, req interface{}) (interface{}, error) {
+			reply := new(grpcBool)
+			return reply, s.PutOnce(*req.(*PutArgs), &reply.Result)
+		}),
+		unaryMethod("GetOnce", func() interface{} { return new(grpcKey) }, func(s *DynamoServer, req interface{}) (interface{}, error) {
+			reply := new(DynamoResult)
+			return reply, s.GetOnce(req.(*grpcKey).Key, reply)
+		}),
+		unaryMethod("Gossip", func() interface{} { return new(Empty) }, func(s *DynamoServer, req interface{}) (interface{}, error) {
+			reply := new(Empty)
+			return reply, s.Gossip(Empty{}, reply)
+		}),
+		unaryMethod("Crash", func() interface{} { return new(grpcCrash) }, func(s *DynamoServer, req interface{}) (interface{}, error) {
+			reply := new(grpcBool)
+			return reply, s.Crash(req.(*grpcCrash).Seconds, &reply.Result)
+		}),
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "PutOnceStream", Handler: putOnceStream, ClientStreams: true},
+		{StreamName: "GetOnceStream", Handler: getOnceStream, ClientStreams: true, ServerStreams: true},
+	},
+	Metadata: "dynamo.proto",
+}
+
+//Returns the description of a unary method that decodes a request made by
+//newRequest and answers it with call
+func unaryMethod(name string, newRequest func() interface{}, call func(*DynamoServer, interface{}) (interface{}, error)) grpc.MethodDesc {
+	fullMethod := "/" + GRPC_SERVICE + "/" + name
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newRequest()
+			if err := dec(req); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return withDeadline(ctx, func() (interface{}, error) {
+					return call(srv.(*grpcService).server, req)
+				})
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, handler)
+		},
+	}
+}
+
+//Runs call, returning early with the status of ctx if it is done first
+func withDeadline(ctx context.Context, call func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	type outcome struct {
+		reply interface{}
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		reply, err := call()
+		done <- outcome{reply, err}
+	}()
+	select {
+	case o := <-done:
+		if o.err != nil {
+			return nil, grpcStatus(o.err)
+		}
+		return o.reply, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+//Stores every value the client streams on this node, then reports how many were
+//stored and how many were rejected as stale
+func putOnceStream(srv interface{}, stream grpc.ServerStream) error {
+	s := srv.(*grpcService).server
+	var summary grpcSummary
+	for {
+		var value PutArgs
+		if err := stream.RecvMsg(&value); err == io.EOF {
+			return stream.SendMsg(&summary)
+		} else if err != nil {
+			return err
+		}
+		var result bool
+		if err := s.PutOnce(value, &result); err != nil {
+			return grpcStatus(err)
+		}
+		if result {
+			summary.Stored++
+		} else {
+			summary.Rejected++
+		}
+	}
+}
+
+//Answers every key the client streams with the entries this node stores for it
+func getOnceStream(srv interface{}, stream grpc.ServerStream) error {
+	s := srv.(*grpcService).server
+	for {
+		var key grpcKey
+		if err := stream.RecvMsg(&key); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var result DynamoResult
+		if err := s.GetOnce(key.Key, &result); err != nil {
+			return grpcStatus(err)
+		}
+		if err := stream.SendMsg(&result); err != nil {
+			return err
+		}
+	}
+}
+
+//Returns err as a gRPC status with the code that matches its kind: Aborted for
+//a stale context, Unavailable when the node is offline or fewer than W replicas
+//answered, and Internal for anything else. The message is kept, so clients can
+//tell the kinds apart the same way net/rpc clients do
+func grpcStatus(err error) error {
+	err = decodeError(err)
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrStaleContext):
+		code = codes.Aborted
+	case errors.Is(err, ErrNodeOffline), errors.Is(err, ErrQuorumNotMet):
+		code = codes.Unavailable
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,166 @@
+package mydynamo
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+//A client of the gRPC interface of a node. Every call takes a context, whose
+//deadline travels with the request
+type GRPCClient struct {
+	ServerAddr string
+	conn       *grpc.ClientConn
+}
+
+func NewGRPCClient(serverAddr string) *GRPCClient {
+	return &GRPCClient{ServerAddr: serverAddr}
+}
+
+//Sets up the connection. The client connects lazily, so an unreachable node
+//only shows up on the first call
+func (client *GRPCClient) Connect() error {
+	conn, err := grpc.NewClient(client.ServerAddr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(protoCodec{})))
+	if err != nil {
+		return err
+	}
+	client.conn = conn
+	return nil
+}
+
+func (client *GRPCClient) Close() error {
+	if client.conn == nil {
+		return nil
+	}
+	err := client.conn.Close()
+	client.conn = nil
+	return err
+}
+
+//Puts a value to W replicas. Returns ErrStaleContext, wrapped in a
+//DynamoError, when the write is rejected
+func (client *GRPCClient) Put(ctx context.Context, value PutArgs) error {
+	var reply grpcBool
+	if err := client.invoke(ctx, "Put", &value, &reply); err != nil {
+		return err
+	}
+	if !reply.Result {
+		return &DynamoError{Kind: ErrStaleContext, Message: fmt.Sprintf("put of %v was rejected", value.Key)}
+	}
+	return nil
+}
+
+//Gets a key from R replicas
+func (client *GRPCClient) Get(ctx context.Context, key string) (*DynamoResult, error) {
+	var result DynamoResult
+	if err := client.invoke(ctx, "Get", &grpcKey{Key: key}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+//Puts a value to the node only
+func (client *GRPCClient) PutOnce(ctx context.Context, value PutArgs) error {
+	var reply grpcBool
+	if err := client.invoke(ctx, "PutOnce", &value, &reply); err != nil {
+		return err
+	}
+	if !reply.Result {
+		return &DynamoError{Kind: ErrStaleContext, Message: fmt.Sprintf("put of %v was rejected", value.Key)}
+	}
+	return nil
+}
+
+//Gets a key from the node only
+func (client *GRPCClient) GetOnce(ctx context.Context, key string) (*DynamoResult, error) {
+	var result DynamoResult
+	if err := client.invoke(ctx, "GetOnce", &grpcKey{Key: key}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (client *GRPCClient) Gossip(ctx context.Context) error {
+	return client.invoke(ctx, "Gossip", &Empty{}, &Empty{})
+}
+
+func (client *GRPCClient) Crash(ctx context.Context, seconds int) error {
+	var reply grpcBool
+	return client.invoke(ctx, "Crash", &grpcCrash{Seconds: seconds}, &reply)
+}
+
+//Streams values to the node, which stores each one as PutOnce does. Returns the
+//number stored and the number rejected as stale
+func (client *GRPCClient) PutOnceStream(ctx context.Context, values []PutArgs) (int, int, error) {
+	stream, err := client.conn.NewStream(ctx, &dynamoServiceDesc.Streams[0], "/"+GRPC_SERVICE+"/PutOnceStream")
+	if err != nil {
+		return 0, 0, grpcError(err)
+	}
+	for i := range values {
+		if err := stream.SendMsg(&values[i]); err != nil {
+			// the server ended the stream, its status is returned by RecvMsg
+			break
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return 0, 0, grpcError(err)
+	}
+	var summary grpcSummary
+	if err := stream.RecvMsg(&summary); err != nil {
+		return 0, 0, grpcError(err)
+	}
+	return int(summary.Stored), int(summary.Rejected), nil
+}
+
+//Streams keys to the node and returns the entries it stores for each, in order
+func (client *GRPCClient) GetOnceStream(ctx context.Context, keys []string) ([]DynamoResult, error) {
+	stream, err := client.conn.NewStream(ctx, &dynamoServiceDesc.Streams[1], "/"+GRPC_SERVICE+"/GetOnceStream")
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	// send from another goroutine, so neither side blocks on a full window
+	go func() {
+		for _, key := range keys {
+			if stream.SendMsg(&grpcKey{Key: key}) != nil {
+				return
+			}
+		}
+		stream.CloseSend()
+	}()
+	results := make([]DynamoResult, 0, len(keys))
+	for range keys {
+		var result DynamoResult
+		if err := stream.RecvMsg(&result); err != nil {
+			return nil, grpcError(err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (client *GRPCClient) invoke(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if client.conn == nil {
+		return fmt.Errorf("not connected to %v", client.ServerAddr)
+	}
+	return grpcError(client.conn.Invoke(ctx, "/"+GRPC_SERVICE+"/"+method, args, reply))
+}
+
+//Returns an error the server reported as a DynamoError of the matching kind,
+//so it can be tested with errors.Is. Other errors are returned as is
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if err == nil || !ok {
+		return err
+	}
+	decoded := decodeError(rpc.ServerError(st.Message()))
+	if dynamoErr, ok := decoded.(*DynamoError); ok && dynamoErr.Kind != nil {
+		return dynamoErr
+	}
+	return err
+}
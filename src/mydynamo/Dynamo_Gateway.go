@@ -0,0 +1,176 @@
+package mydynamo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+//Header that carries the context of a key between the REST gateway and its
+//clients. Clients treat it as opaque and echo it back on PUT and DELETE
+const CONTEXT_HEADER string = "X-Dynamo-Context"
+
+//Path the REST gateway serves keys under, as /kv/{key}
+const GATEWAY_PATH string = "/kv/"
+
+//One sibling in the body of a 300 Multiple Choices response. Value is base64
+//encoded by encoding/json
+type GatewaySibling struct {
+	Value   []byte `json:"value"`
+	Context string `json:"context"`
+}
+
+//Serves the keys of a DynamoServer over HTTP and JSON, so clients in any
+//language can use the cluster:
+//
+//	GET    /kv/{key}  200 with the value, or 300 with a JSON array of siblings
+//	PUT    /kv/{key}  stores the request body, 204 once W replicas have it
+//	DELETE /kv/{key}  deletes the key, 204 once W replicas have the tombstone
+//
+//Every GET returns the context in CONTEXT_HEADER. For siblings it descends
+//from all of them, so echoing it on the next PUT replaces them
+type Gateway struct {
+	server *DynamoServer
+}
+
+func NewGateway(server *DynamoServer) *Gateway {
+	return &Gateway{server: server}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, GATEWAY_PATH)
+	if key == "" || key == r.URL.Path {
+		http.Error(w, "expected "+GATEWAY_PATH+"{key}", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		g.get(w, key)
+	case http.MethodPut:
+		g.put(w, r, key)
+	case http.MethodDelete:
+		g.delete(w, r, key)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, r.Method+" is not supported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (g *Gateway) get(w http.ResponseWriter, key string) {
+	var result DynamoResult
+	if err := g.server.Get(key, &result); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	switch len(result.EntryList) {
+	case 0:
+		http.Error(w, key+" not found", http.StatusNotFound)
+	case 1:
+		entry := result.EntryList[0]
+		w.Header().Set(CONTEXT_HEADER, EncodeContextToken(entry.Context))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write(entry.Value)
+	default:
+		siblings := make([]GatewaySibling, 0, len(result.EntryList))
+		clocks := make([]VectorClock, 0, len(result.EntryList))
+		for _, entry := range result.EntryList {
+			siblings = append(siblings, GatewaySibling{Value: entry.Value, Context: EncodeContextToken(entry.Context)})
+			clocks = append(clocks, entry.Context.Clock)
+		}
+		clock := NewVectorClock()
+		clock.Combine(clocks)
+		w.Header().Set(CONTEXT_HEADER, EncodeContextToken(NewContext(clock)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultipleChoices)
+		json.NewEncoder(w).Encode(siblings)
+	}
+}
+
+func (g *Gateway) put(w http.ResponseWriter, r *http.Request, key string) {
+	context, err := requestContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result bool
+	if err := g.server.Put(NewPutArgs(key, context, value), &result); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	writeGatewayResult(w, key, result)
+}
+
+func (g *Gateway) delete(w http.ResponseWriter, r *http.Request, key string) {
+	context, err := requestContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var result bool
+	if err := g.server.Delete(NewDeleteArgs(key, context), &result); err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+	writeGatewayResult(w, key, result)
+}
+
+//Returns the context a request echoed back, or a fresh one if it sent none
+func requestContext(r *http.Request) (Context, error) {
+	token := r.Header.Get(CONTEXT_HEADER)
+	if token == "" {
+		return NewContext(NewVectorClock()), nil
+	}
+	return DecodeContextToken(token)
+}
+
+func writeGatewayResult(w http.ResponseWriter, key string, result bool) {
+	if !result {
+		http.Error(w, "write of "+key+" was rejected", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//Reports err with the status code that matches its kind: 409 for a stale
+//context, 503 when the node is offline or fewer than W replicas answered, and
+//502 for anything else that went wrong on the way to the replicas
+func writeGatewayError(w http.ResponseWriter, err error) {
+	// errors of a request forwarded to a replica only carry their message
+	err = decodeError(err)
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrStaleContext):
+		status = http.StatusConflict
+	case errors.Is(err, ErrNodeOffline), errors.Is(err, ErrQuorumNotMet):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
+
+//Encodes context as an opaque token for CONTEXT_HEADER
+func EncodeContextToken(context Context) string {
+	return base64.RawURLEncoding.EncodeToString(MarshalContext(context))
+}
+
+//Decodes a token made by EncodeContextToken
+func DecodeContextToken(token string) (Context, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Context{}, fmt.Errorf("malformed context token: %v", err)
+	}
+	context, err := UnmarshalContext(data)
+	if err != nil {
+		return Context{}, fmt.Errorf("malformed context token: %v", err)
+	}
+	return context, nil
+}
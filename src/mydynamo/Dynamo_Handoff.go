@@ -0,0 +1,248 @@
+package mydynamo
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sync/atomic"
+)
+
+//Returns the current members of the cluster as this node sees them
+// As this method takes no arguments, we must use the Empty placeholder
+func (s *DynamoServer) Members(_ Empty, nodes *[]DynamoNode) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	*nodes = append([]DynamoNode{}, s.view().preferenceList...)
+	return nil
+}
+
+//Returns the members of the cluster, their status and N, used by ClusterClient
+//to route requests
+func (s *DynamoServer) ClusterInfo(_ Empty, info *ClusterInfo) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	v := s.view()
+	info.Members = append([]DynamoNode{}, v.preferenceList...)
+	info.Status = make([]MemberStatus, len(v.preferenceList))
+	for i, node := range v.preferenceList {
+		info.Status[i] = s.membership.Status(node)
+	}
+	info.NValue = v.nValue
+	return nil
+}
+
+//Replaces the members of the cluster, used when a node joins or leaves
+func (s *DynamoServer) UpdateMembers(nodes []DynamoNode, _ *Empty) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	s.setMembers(nodes)
+	return nil
+}
+
+//Returns every version this node stores of the keys args.Node replicates in a
+//cluster made of args.Members, encoded by MarshalPutArgsList
+func (s *DynamoServer) TransferKeys(args TransferArgs, reply *[]byte) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	ring := NewRing(args.Members, VIRTUAL_NODES)
+	owned := make([]PutArgs, 0)
+	for _, key := range s.store.Keys() {
+		for _, node := range ring.PreferenceList(key, s.nValue) {
+			if node.Equals(args.Node) {
+				owned = append(owned, s.storedVersions(key)...)
+				break
+			}
+		}
+	}
+	*reply = MarshalPutArgsList(owned)
+	return nil
+}
+
+//Adds this node to the cluster seed belongs to. The node first copies the key
+//ranges it will own from the current members while they still serve them,
+//then announces itself, and finally copies again to pick up the writes that
+//raced with the announcement. Until then Get reads every replica, so reads
+//through this node see writes it has not received yet
+func (s *DynamoServer) Join(seed DynamoNode, _ *Empty) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	var members []DynamoNode
+	if err := s.view().pool.call(seed, "MyDynamo.Members", Empty{}, &members); err != nil {
+		return err
+	}
+	for _, node := range members {
+		if node.Equals(s.selfNode) {
+			return fmt.Errorf("server %v is already a member", s.nodeID)
+		}
+	}
+
+	atomic.StoreInt32(&s.transferring, 1)
+	defer atomic.StoreInt32(&s.transferring, 0)
+
+	members = append(members, s.selfNode)
+	s.setMembers(members)
+	v := s.view()
+	if err := s.pullRanges(v, members); err != nil {
+		return err
+	}
+	s.announceMembers(v, members)
+	return s.pullRanges(v, members)
+}
+
+//Makes this node a member again of the cluster seed belongs to, used when the
+//process of a member restarts. The node takes the members seed knows and an
+//incarnation newer than any seed has seen of it, so the failure detectors mark
+//it alive again, then copies its key ranges back from the other replicas.
+//A failed copy is only logged, anti-entropy repairs what it missed
+func (s *DynamoServer) Rejoin(seed DynamoNode, _ *Empty) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	pool := s.view().pool
+	var members []DynamoNode
+	if err := pool.call(seed, "MyDynamo.Members", Empty{}, &members); err != nil {
+		return err
+	}
+	var view []Member
+	if err := pool.call(seed, "MyDynamo.Membership", Empty{}, &view); err != nil {
+		return err
+	}
+	if !containsNode(members, s.selfNode) {
+		return fmt.Errorf("server %v is not a member", s.nodeID)
+	}
+
+	atomic.StoreInt32(&s.transferring, 1)
+	defer atomic.StoreInt32(&s.transferring, 0)
+
+	s.setMembers(members)
+	s.membership.Outrank(view)
+	if err := s.pullRanges(s.view(), members); err != nil {
+		log.Println(DYNAMO_SERVER, "server", s.nodeID, "rejoined without all of its keys:", err)
+	}
+	return nil
+}
+
+//Removes this node from the cluster. The node pushes every key it stores, and
+//every hint it holds, to the nodes that replicate the key once it is gone,
+//announces the new membership, pushes again to cover the writes that raced
+//with the announcement, and then goes offline for good
+func (s *DynamoServer) Leave(_ Empty, _ *Empty) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	v := s.view()
+	remaining := make([]DynamoNode, 0, len(v.preferenceList))
+	for i, node := range v.preferenceList {
+		if !skipNode(v.pListLoc, i) {
+			remaining = append(remaining, node)
+		}
+	}
+	// a server whose N covers every member keeps replicating every key to the
+	// members that remain, however few
+	replicas := s.nValue
+	if replicas >= len(v.preferenceList) {
+		replicas = 1
+	}
+	if len(remaining) < replicas {
+		return fmt.Errorf("server %v can not leave, %v nodes can not hold %v replicas", s.nodeID, len(remaining), replicas)
+	}
+
+	s.pushRanges(v, remaining)
+	s.announceMembers(v, remaining)
+	s.pushRanges(v, remaining)
+
+	// offline for good
+	atomic.StoreInt64(&s.crashUntil, math.MaxInt64)
+	v.pool.Close()
+	return nil
+}
+
+//Returns the versions stored at key as PutArgs
+func (s *DynamoServer) storedVersions(key string) []PutArgs {
+	entries, _ := s.store.Get(key)
+	values := make([]PutArgs, 0, len(entries))
+	for _, entry := range entries {
+		value := putArgsFromEntry(key, entry)
+		values = append(values, value)
+	}
+	return values
+}
+
+//Copies the keys this node replicates in members from every other node
+func (s *DynamoServer) pullRanges(v *clusterView, members []DynamoNode) error {
+	args := TransferArgs{Node: s.selfNode, Members: members}
+	for i := range v.preferenceList {
+		if skipNode(v.pListLoc, i) || s.isDead(v, i) {
+			continue
+		}
+		var reply []byte
+		if err := v.call(i, "MyDynamo.TransferKeys", args, &reply); err != nil {
+			return fmt.Errorf("failed to copy keys from %v: %v", v.preferenceList[i], err)
+		}
+		values, err := UnmarshalPutArgsList(reply)
+		if err != nil {
+			return fmt.Errorf("failed to copy keys from %v: %v", v.preferenceList[i], err)
+		}
+		for _, value := range values {
+			var result bool
+			if err := s.PutOnce(value, &result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Pushes every key this node stores to its replicas in members, and every
+//pending gossip entry to the node it is meant for
+func (s *DynamoServer) pushRanges(v *clusterView, members []DynamoNode) {
+	ring := NewRing(members, VIRTUAL_NODES)
+	for _, key := range s.store.Keys() {
+		values := s.storedVersions(key)
+		for _, node := range ring.PreferenceList(key, s.nValue) {
+			s.pushTo(v, node, values)
+		}
+	}
+	for i, g := range v.gossiper {
+		for _, key := range g.Keys() {
+			values := make([]PutArgs, 0)
+			for _, entry := range g.GetGossipList(key) {
+				value := putArgsFromEntry(key, entry)
+				values = append(values, value)
+			}
+			s.pushTo(v, v.preferenceList[i], values)
+		}
+	}
+}
+
+//Writes values to node with PutOnce, logging the ones that fail
+func (s *DynamoServer) pushTo(v *clusterView, node DynamoNode, values []PutArgs) {
+	i := v.indexOf(node)
+	if i < 0 || skipNode(v.pListLoc, i) {
+		return
+	}
+	for _, value := range values {
+		var result bool
+		if err := v.putOnce(i, value, &result); err != nil {
+			log.Println(DYNAMO_SERVER, "failed to hand", value.Key, "to", node, err)
+		}
+	}
+}
+
+//Sends the new membership to every node in members other than this one
+func (s *DynamoServer) announceMembers(v *clusterView, members []DynamoNode) {
+	for _, node := range members {
+		i := v.indexOf(node)
+		if i < 0 || skipNode(v.pListLoc, i) {
+			continue
+		}
+		if err := v.call(i, "MyDynamo.UpdateMembers", members, &Empty{}); err != nil {
+			log.Println(DYNAMO_SERVER, "failed to announce membership to", node, err)
+		}
+	}
+}
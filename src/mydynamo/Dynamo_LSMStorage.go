@@ -0,0 +1,394 @@
+package mydynamo
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const sstablePrefix string = "sst-"
+const sstableSuffix string = ".sst"
+const compactionSuffix string = ".compact"
+
+//Log-structured merge tree storage engine. Writes go to a write-ahead log and
+//an in-memory memtable, which is flushed to an immutable SSTable once it holds
+//MEMTABLE_SIZE keys. When COMPACTION_THRESHOLD tables have piled up they are
+//merged into one in the background.
+//
+//A key may appear in the memtable and in several tables. Reads and compaction
+//merge every copy with MergeSiblings, so versions that are causally older than
+//another copy are dropped. The server only ever stores a sibling list that
+//supersedes the previous one, so this returns exactly the list last Put.
+//Deletes are recorded as reset markers that hide every older copy of the key
+type LSMStorage struct {
+	dir        string
+	memtable   map[string]walRecord
+	wal        *os.File
+	tables     []*sstable // ordered oldest first
+	nextSeq    int
+	compacting bool
+	closing    bool // set by Close, no compaction starts after it
+	wg         sync.WaitGroup
+	m          sync.RWMutex
+}
+
+//Opens the LSMStorage kept in dir, creating dir if needed and recovering the
+//tables and memtable left by a previous run
+func NewLSMStorage(dir string) (*LSMStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	ls := &LSMStorage{
+		dir:      dir,
+		memtable: make(map[string]walRecord),
+		tables:   make([]*sstable, 0),
+		nextSeq:  1,
+	}
+	if err := ls.loadTables(); err != nil {
+		return nil, err
+	}
+	wal, err := openLog(filepath.Join(dir, walFileName), ls.applyToMemtable)
+	if err != nil {
+		return nil, err
+	}
+	ls.wal = wal
+	return ls, nil
+}
+
+func (ls *LSMStorage) Get(key string) ([]ObjectEntry, bool) {
+	ls.m.RLock()
+	defer ls.m.RUnlock()
+
+	return ls.get(key)
+}
+
+//Looks up key in the memtable and every table. Must be called with ls.m held
+func (ls *LSMStorage) get(key string) ([]ObjectEntry, bool) {
+	// walk from the newest copy to the oldest, stopping at a reset marker
+	var merged []ObjectEntry
+	if record, ok := ls.memtable[key]; ok {
+		merged = copyEntries(record.Entries)
+		if record.Reset {
+			return merged, len(merged) > 0
+		}
+	}
+	for i := len(ls.tables) - 1; i >= 0; i-- {
+		record, ok, err := ls.tables[i].get(key)
+		if err != nil {
+			log.Println(DYNAMO_SERVER, "failed to read", ls.tables[i].path, err)
+			continue
+		}
+		if ok {
+			merged = MergeSiblings(merged, record.Entries)
+			if record.Reset {
+				break
+			}
+		}
+	}
+	return merged, len(merged) > 0
+}
+
+func (ls *LSMStorage) Put(key string, entries []ObjectEntry) error {
+	return ls.write(walRecord{Key: key, Entries: copyEntries(entries)})
+}
+
+func (ls *LSMStorage) Delete(key string) error {
+	return ls.write(walRecord{Key: key, Reset: true})
+}
+
+//Logs a record and applies it to the memtable, flushing the memtable once it is full
+func (ls *LSMStorage) write(record walRecord) error {
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	if err := appendLogRecord(ls.wal, record); err != nil {
+		return err
+	}
+	ls.applyToMemtable(record)
+
+	if len(ls.memtable) >= MEMTABLE_SIZE {
+		return ls.flush()
+	}
+	return nil
+}
+
+//A Put following a delete in the same memtable keeps the reset marker, so the
+//older copies stay hidden once the memtable is flushed
+func (ls *LSMStorage) applyToMemtable(record walRecord) {
+	if previous, ok := ls.memtable[record.Key]; ok && previous.Reset {
+		record.Reset = true
+	}
+	ls.memtable[record.Key] = record
+}
+
+func (ls *LSMStorage) Keys() []string {
+	ls.m.RLock()
+	defer ls.m.RUnlock()
+
+	seen := make(map[string]bool)
+	for key := range ls.memtable {
+		seen[key] = true
+	}
+	for _, table := range ls.tables {
+		for _, key := range table.index.Keys {
+			seen[key] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		// skip keys whose newest copy is a delete
+		if _, ok := ls.get(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Waits for any running compaction, flushes the memtable and closes all files.
+//No compaction starts once Close is called, so none runs on the closed files
+func (ls *LSMStorage) Close() error {
+	ls.m.Lock()
+	ls.closing = true
+	ls.m.Unlock()
+	ls.wg.Wait()
+
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	if len(ls.memtable) > 0 {
+		if err := ls.flush(); err != nil {
+			return err
+		}
+	}
+	for _, table := range ls.tables {
+		table.close()
+	}
+	return ls.wal.Close()
+}
+
+//Returns the number of SSTables currently on disk
+func (ls *LSMStorage) TableCount() int {
+	ls.m.RLock()
+	defer ls.m.RUnlock()
+
+	return len(ls.tables)
+}
+
+//Writes the memtable to a new SSTable and empties the log. Starts a background
+//compaction if enough tables have accumulated. Must be called with ls.m held
+func (ls *LSMStorage) flush() error {
+	seq := ls.nextSeq
+	path := ls.tablePath(seq)
+	if err := writeSSTable(path, ls.memtable); err != nil {
+		return err
+	}
+	// the table must be durable before the log it replaces is emptied
+	if err := syncDir(ls.dir); err != nil {
+		return err
+	}
+	table, err := openSSTable(path, seq)
+	if err != nil {
+		return err
+	}
+	ls.nextSeq++
+	ls.tables = append(ls.tables, table)
+	ls.memtable = make(map[string]walRecord)
+
+	// every record in the log is now covered by the table
+	if err := ls.wal.Truncate(0); err != nil {
+		return err
+	}
+
+	if len(ls.tables) >= COMPACTION_THRESHOLD && !ls.compacting && !ls.closing {
+		ls.compacting = true
+		ls.wg.Add(1)
+		go ls.compact()
+	}
+	return nil
+}
+
+//Merges every table that existed when compaction started into one. The merged
+//table takes the place of the newest input, so tables flushed while compaction
+//runs stay newer than it.
+//
+//The merged table drops reset markers and deleted keys, so it must never be
+//read alongside the older inputs, whose data those markers hid. It is first
+//written as a .compact file, which commits the compaction. The older inputs are
+//then removed and the .compact file renamed over the newest input. A crash in
+//between leaves the .compact file behind, and loadTables finishes the swap
+func (ls *LSMStorage) compact() {
+	defer ls.wg.Done()
+
+	ls.m.RLock()
+	inputs := make([]*sstable, len(ls.tables))
+	copy(inputs, ls.tables)
+	ls.m.RUnlock()
+
+	// every table from the oldest on is compacted, so reset markers have nothing
+	// older left to hide and keys whose versions were all deleted are dropped
+	merged := make(map[string]walRecord)
+	for _, table := range inputs {
+		err := table.scan(func(record walRecord) {
+			if record.Reset {
+				merged[record.Key] = walRecord{Key: record.Key, Entries: record.Entries}
+			} else {
+				merged[record.Key] = walRecord{Key: record.Key, Entries: MergeSiblings(merged[record.Key].Entries, record.Entries)}
+			}
+			if len(merged[record.Key].Entries) == 0 {
+				delete(merged, record.Key)
+			}
+		})
+		if err != nil {
+			log.Println(DYNAMO_SERVER, "compaction failed reading", table.path, err)
+			ls.finishCompaction(nil, 0)
+			return
+		}
+	}
+
+	newest := inputs[len(inputs)-1]
+	compactPath := ls.compactionPath(newest.seq)
+	if err := writeSSTable(compactPath, merged); err != nil {
+		log.Println(DYNAMO_SERVER, "compaction failed writing", compactPath, err)
+		ls.finishCompaction(nil, 0)
+		return
+	}
+	if err := syncDir(ls.dir); err != nil {
+		log.Println(DYNAMO_SERVER, "compaction failed syncing", ls.dir, err)
+		ls.finishCompaction(nil, 0)
+		return
+	}
+	// the compaction is committed, from here on a failure is finished on reopen
+	if err := ls.replaceInputs(compactPath, newest.seq); err != nil {
+		log.Println(DYNAMO_SERVER, "compaction failed replacing its inputs", err)
+		ls.finishCompaction(nil, 0)
+		return
+	}
+	table, err := openSSTable(newest.path, newest.seq)
+	if err != nil {
+		log.Println(DYNAMO_SERVER, "compaction failed opening", newest.path, err)
+		ls.finishCompaction(nil, 0)
+		return
+	}
+	ls.finishCompaction(table, len(inputs))
+
+	for _, input := range inputs {
+		input.close()
+	}
+}
+
+//Removes every table up to seq and renames the committed compaction output at
+//compactPath to the table of seq. Readers keep the removed tables open until
+//the merged one is swapped in
+func (ls *LSMStorage) replaceInputs(compactPath string, seq int) error {
+	seqs, err := ls.tableSeqs()
+	if err != nil {
+		return err
+	}
+	for _, older := range seqs {
+		if older < seq {
+			if err := os.Remove(ls.tablePath(older)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(compactPath, ls.tablePath(seq)); err != nil {
+		return err
+	}
+	return syncDir(ls.dir)
+}
+
+//Swaps the merged table in for the oldest replaced tables
+func (ls *LSMStorage) finishCompaction(table *sstable, replaced int) {
+	ls.m.Lock()
+	defer ls.m.Unlock()
+
+	if table != nil {
+		ls.tables = append([]*sstable{table}, ls.tables[replaced:]...)
+	}
+	ls.compacting = false
+}
+
+//Opens every SSTable in the directory in sequence order, discards the
+//temporary files of any write that did not finish, and finishes any compaction
+//that was committed but not yet swapped in
+func (ls *LSMStorage) loadTables() error {
+	names, err := filepath.Glob(filepath.Join(ls.dir, "*.tmp"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		os.Remove(name)
+	}
+
+	names, err = filepath.Glob(filepath.Join(ls.dir, sstablePrefix+"*"+compactionSuffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		var seq int
+		base := strings.TrimSuffix(filepath.Base(name), compactionSuffix)
+		if _, err := fmt.Sscanf(base, sstablePrefix+"%d", &seq); err != nil {
+			continue
+		}
+		if err := ls.replaceInputs(name, seq); err != nil {
+			return err
+		}
+	}
+
+	seqs, err := ls.tableSeqs()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		table, err := openSSTable(ls.tablePath(seq), seq)
+		if err != nil {
+			return err
+		}
+		ls.tables = append(ls.tables, table)
+		ls.nextSeq = seq + 1
+	}
+	return nil
+}
+
+//Returns the sequence numbers of the SSTables in the directory, in order
+func (ls *LSMStorage) tableSeqs() ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(ls.dir, sstablePrefix+"*"+sstableSuffix))
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]int, 0, len(names))
+	for _, name := range names {
+		var seq int
+		base := strings.TrimSuffix(filepath.Base(name), sstableSuffix)
+		if _, err := fmt.Sscanf(base, sstablePrefix+"%d", &seq); err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+func (ls *LSMStorage) tablePath(seq int) string {
+	return filepath.Join(ls.dir, fmt.Sprintf("%v%06d%v", sstablePrefix, seq, sstableSuffix))
+}
+
+func (ls *LSMStorage) compactionPath(seq int) string {
+	return filepath.Join(ls.dir, fmt.Sprintf("%v%06d%v", sstablePrefix, seq, compactionSuffix))
+}
+
+//Syncs the directory at dir, so the files created, renamed and removed in it
+//survive a crash
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
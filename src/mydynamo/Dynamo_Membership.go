@@ -0,0 +1,274 @@
+package mydynamo
+
+import (
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var heartbeatInterval time.Duration = time.Duration(DEFAULT_HEARTBEAT_INTERVAL) * time.Millisecond
+var suspectTimeout time.Duration = time.Duration(DEFAULT_SUSPECT_TIMEOUT) * time.Millisecond
+var deadTimeout time.Duration = time.Duration(DEFAULT_DEAD_TIMEOUT) * time.Millisecond
+
+//Sets how often nodes gossip their membership view, and how long a peer's
+//heartbeat may go without increasing before the peer is suspected and then
+//declared dead
+func SetMembershipTimings(interval, suspect, dead time.Duration) {
+	heartbeatInterval = interval
+	suspectTimeout = suspect
+	deadTimeout = dead
+}
+
+//A peer as seen by a local failure detector
+type memberState struct {
+	Member
+	updated time.Time // when the peer's heartbeat last increased
+}
+
+//Gossip-style membership view with a heartbeat failure detector. Every node
+//increases its own heartbeat each round and sends its view to a few random
+//peers, which keep the newest (incarnation, heartbeat) they have seen for every
+//member. A member whose heartbeat stops increasing becomes suspect after
+//suspectTimeout and dead after deadTimeout. A node that recovers from a crash
+//takes a new incarnation, which overrides every older state about it
+type Membership struct {
+	self    string
+	members map[string]*memberState // keyed by address:port
+	m       sync.Mutex
+}
+
+//Returns the key a node is stored under in a Membership
+func memberKey(node DynamoNode) string {
+	return node.Address + ":" + node.Port
+}
+
+//Creates a view in which self and every node in nodes are alive
+func NewMembership(self DynamoNode, nodes []DynamoNode) *Membership {
+	ms := &Membership{
+		self:    memberKey(self),
+		members: make(map[string]*memberState),
+	}
+	now := time.Now()
+	for _, node := range nodes {
+		ms.members[memberKey(node)] = &memberState{
+			Member:  Member{Node: node, Status: MEMBER_ALIVE},
+			updated: now,
+		}
+	}
+	if _, ok := ms.members[ms.self]; !ok {
+		ms.members[ms.self] = &memberState{
+			Member:  Member{Node: self, Status: MEMBER_ALIVE},
+			updated: now,
+		}
+	}
+	return ms
+}
+
+//Increases this node's heartbeat
+func (ms *Membership) Beat() {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	self := ms.members[ms.self]
+	self.Heartbeat++
+	self.updated = time.Now()
+}
+
+//Starts a new incarnation of this node, used after it recovers from a crash
+func (ms *Membership) Reincarnate() {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	self := ms.members[ms.self]
+	self.Incarnation++
+	self.Heartbeat = 0
+	self.updated = time.Now()
+}
+
+//Starts an incarnation of this node newer than any state view holds about it,
+//used by a node whose process restarted and lost its own state
+func (ms *Membership) Outrank(view []Member) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	self := ms.members[ms.self]
+	for _, member := range view {
+		if memberKey(member.Node) == ms.self && member.Incarnation >= self.Incarnation {
+			self.Incarnation = member.Incarnation + 1
+			self.Heartbeat = 0
+			self.updated = time.Now()
+		}
+	}
+}
+
+//Merges a view received from a peer, keeping the newest state of every member.
+//States about this node are ignored, only the node itself advances them
+func (ms *Membership) Merge(view []Member) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	now := time.Now()
+	for _, member := range view {
+		key := memberKey(member.Node)
+		if key == ms.self {
+			continue
+		}
+		local, ok := ms.members[key]
+		if !ok {
+			// nodes only join or leave through SetNodes
+			continue
+		}
+		if member.Incarnation > local.Incarnation ||
+			(member.Incarnation == local.Incarnation && member.Heartbeat > local.Heartbeat) {
+			local.Incarnation = member.Incarnation
+			local.Heartbeat = member.Heartbeat
+			local.Status = MEMBER_ALIVE
+			local.updated = now
+		}
+	}
+}
+
+//Replaces the members of the view. Members that stay keep their state and
+//new members start out alive
+func (ms *Membership) SetNodes(nodes []DynamoNode) {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	members := make(map[string]*memberState)
+	for _, node := range nodes {
+		key := memberKey(node)
+		if member, ok := ms.members[key]; ok {
+			members[key] = member
+		} else {
+			members[key] = &memberState{
+				Member:  Member{Node: node, Status: MEMBER_ALIVE},
+				updated: time.Now(),
+			}
+		}
+	}
+	if self, ok := ms.members[ms.self]; ok {
+		members[ms.self] = self
+	}
+	ms.members = members
+}
+
+//Updates the status of every peer from how long ago its heartbeat last increased
+func (ms *Membership) Detect() {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	for key, member := range ms.members {
+		if key == ms.self {
+			continue
+		}
+		silent := time.Since(member.updated)
+		status := MEMBER_ALIVE
+		if silent >= deadTimeout {
+			status = MEMBER_DEAD
+		} else if silent >= suspectTimeout {
+			status = MEMBER_SUSPECT
+		}
+		if status != member.Status {
+			log.Println(DYNAMO_SERVER, "member", key, "is now", status)
+			member.Status = status
+		}
+	}
+}
+
+//Returns a copy of every member of the view
+func (ms *Membership) View() []Member {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	view := make([]Member, 0, len(ms.members))
+	for _, member := range ms.members {
+		view = append(view, member.Member)
+	}
+	return view
+}
+
+//Returns the status of node, or MEMBER_DEAD if it is not a member
+func (ms *Membership) Status(node DynamoNode) MemberStatus {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	if member, ok := ms.members[memberKey(node)]; ok {
+		return member.Status
+	}
+	return MEMBER_DEAD
+}
+
+//Returns MEMBERSHIP_FANOUT random members other than this node
+func (ms *Membership) randomPeers() []DynamoNode {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	peers := make([]DynamoNode, 0, len(ms.members))
+	for key, member := range ms.members {
+		if key != ms.self {
+			peers = append(peers, member.Node)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	if len(peers) > MEMBERSHIP_FANOUT {
+		peers = peers[:MEMBERSHIP_FANOUT]
+	}
+	return peers
+}
+
+//Returns true if the failure detector considers the node at preferenceList
+//index i dead. Such nodes are skipped instead of waiting on a failed call
+func (s *DynamoServer) isDead(v *clusterView, i int) bool {
+	if skipNode(v.pListLoc, i) {
+		return false
+	}
+	return s.membership.Status(v.preferenceList[i]) == MEMBER_DEAD
+}
+
+//Runs one membership round: beats, sends the view to random peers and merges
+//their views, then updates the failure detector
+func (s *DynamoServer) gossipMembership() {
+	v := s.view()
+	s.membership.Beat()
+	for _, peer := range s.membership.randomPeers() {
+		i := v.indexOf(peer)
+		if i < 0 || skipNode(v.pListLoc, i) {
+			continue
+		}
+		args := MembershipArgs{From: s.selfNode, Members: s.membership.View()}
+		var reply MembershipArgs
+		if err := v.call(i, "MyDynamo.ExchangeMembership", args, &reply); err == nil {
+			s.membership.Merge(reply.Members)
+		}
+	}
+	s.membership.Detect()
+}
+
+//Gossips membership every heartbeatInterval. A node stays silent while it is
+//crashed and takes a new incarnation once it recovers
+func (s *DynamoServer) runMembership() {
+	if heartbeatInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	crashed := false
+	for range ticker.C {
+		if s.view().pListLoc < 0 {
+			// the node has not been given its preference list yet
+			continue
+		}
+		if s.isCrashed() {
+			crashed = true
+			continue
+		}
+		if crashed {
+			s.membership.Reincarnate()
+			crashed = false
+		}
+		s.gossipMembership()
+	}
+}
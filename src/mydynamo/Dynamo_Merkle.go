@@ -0,0 +1,413 @@
+package mydynamo
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Binary hash tree over a set of keys. Keys are bucketed into 2^MERKLE_DEPTH
+//leaves by their position on the ring, and every inner node hashes its two
+//children, so two replicas can find the keys they disagree on by comparing
+//hashes from the root down. Nodes are stored heap-style: the children of node
+//i are 2i+1 and 2i+2, and the leaves are the last 2^MERKLE_DEPTH nodes
+type MerkleTree struct {
+	hashes [][]byte
+	leaves [][]string        // keys in every leaf, in sorted order
+	keys   map[string][]byte // hash of every key's siblings
+}
+
+//Returns the number of nodes in a tree of MERKLE_DEPTH
+func merkleSize() int {
+	return 1<<uint(MERKLE_DEPTH+1) - 1
+}
+
+//Returns the heap index of the first leaf
+func merkleFirstLeaf() int {
+	return 1<<uint(MERKLE_DEPTH) - 1
+}
+
+//Returns the heap index of the leaf key falls in
+func merkleLeafOf(key string) int {
+	return merkleFirstLeaf() + int(ringHash(key)>>uint(32-MERKLE_DEPTH))
+}
+
+//Builds a tree over entries, which maps each key to its sibling list
+func NewMerkleTree(entries map[string][]ObjectEntry) *MerkleTree {
+	tree := &MerkleTree{
+		hashes: make([][]byte, merkleSize()),
+		leaves: make([][]string, 1<<uint(MERKLE_DEPTH)),
+		keys:   make(map[string][]byte),
+	}
+	for _, key := range sortedKeys(entries) {
+		leaf := merkleLeafOf(key) - merkleFirstLeaf()
+		tree.leaves[leaf] = append(tree.leaves[leaf], key)
+		tree.keys[key] = hashKeyEntries(key, entries[key])
+	}
+	for node := merkleSize() - 1; node >= 0; node-- {
+		tree.rehash(node)
+	}
+	return tree
+}
+
+//Recomputes the hash of node from its keys if it is a leaf, or from its two
+//children otherwise
+func (t *MerkleTree) rehash(node int) {
+	if node >= merkleFirstLeaf() {
+		h := md5.New()
+		for _, key := range t.leaves[node-merkleFirstLeaf()] {
+			h.Write(t.keys[key])
+		}
+		t.hashes[node] = h.Sum(nil)
+		return
+	}
+	sum := md5.Sum(append(append([]byte{}, t.hashes[2*node+1]...), t.hashes[2*node+2]...))
+	t.hashes[node] = sum[:]
+}
+
+//Replaces the siblings of key with entries, or removes key if entries is empty,
+//and rehashes only the leaf key falls in and the nodes above it
+func (t *MerkleTree) Update(key string, entries []ObjectEntry) {
+	node := merkleLeafOf(key)
+	keys := t.leaves[node-merkleFirstLeaf()]
+	i := sort.SearchStrings(keys, key)
+	present := i < len(keys) && keys[i] == key
+	if len(entries) == 0 {
+		if !present {
+			return
+		}
+		delete(t.keys, key)
+		keys = append(keys[:i], keys[i+1:]...)
+	} else {
+		t.keys[key] = hashKeyEntries(key, entries)
+		if !present {
+			keys = append(keys, "")
+			copy(keys[i+1:], keys[i:])
+			keys[i] = key
+		}
+	}
+	t.leaves[node-merkleFirstLeaf()] = keys
+	t.rehash(node)
+	for node > 0 {
+		node = (node - 1) / 2
+		t.rehash(node)
+	}
+}
+
+//Returns the hash of the root, which summarizes every key in the tree
+func (t *MerkleTree) Root() []byte {
+	return t.hashes[0]
+}
+
+//Returns the hashes of the given nodes
+func (t *MerkleTree) Hashes(nodes []int) [][]byte {
+	hashes := make([][]byte, len(nodes))
+	for i, node := range nodes {
+		if node >= 0 && node < len(t.hashes) {
+			hashes[i] = t.hashes[node]
+		}
+	}
+	return hashes
+}
+
+//Returns the keys stored under the given leaves
+func (t *MerkleTree) LeafKeys(nodes []int) []string {
+	keys := make([]string, 0)
+	for _, node := range nodes {
+		leaf := node - merkleFirstLeaf()
+		if leaf >= 0 && leaf < len(t.leaves) {
+			keys = append(keys, t.leaves[leaf]...)
+		}
+	}
+	return keys
+}
+
+//Hashes a key and its siblings independently of the order the siblings were
+//stored in and of Go's map iteration order
+func hashKeyEntries(key string, entries []ObjectEntry) []byte {
+	encoded := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		var buf bytes.Buffer
+		ids := make([]string, 0, len(entry.Context.Clock.Elements))
+		for id := range entry.Context.Clock.Elements {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintf(&buf, "%v:%v,", id, entry.Context.Clock.Elements[id])
+		}
+		fmt.Fprintf(&buf, "%v:%v|", entry.Context.Clock.Dot.Node, entry.Context.Clock.Dot.Counter)
+		for _, marker := range entry.Context.Clock.Pruned {
+			fmt.Fprintf(&buf, "%v;", marker)
+		}
+		fmt.Fprintf(&buf, "|%v|", entry.Tombstone)
+		binary.Write(&buf, binary.BigEndian, uint32(len(entry.Value)))
+		buf.Write(entry.Value)
+		encoded = append(encoded, buf.Bytes())
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+
+	h := md5.New()
+	binary.Write(h, binary.BigEndian, uint32(len(key)))
+	h.Write([]byte(key))
+	for _, e := range encoded {
+		h.Write(e)
+	}
+	return h.Sum(nil)
+}
+
+//Merkle trees over the ranges this node replicates, one per range, keyed by the
+//token that ends the range. The trees are built from the store the first time
+//they are needed in a view, and every write after that only updates the leaf
+//of the key it wrote
+type merkleCache struct {
+	view  *clusterView // view the trees were built for, nil until they are needed
+	trees map[uint32]*MerkleTree
+	m     sync.Mutex
+}
+
+func newMerkleCache() *merkleCache {
+	return &merkleCache{}
+}
+
+//Drops every tree, so they are rebuilt for the next view that needs them
+func (c *merkleCache) Invalidate() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.view = nil
+	c.trees = nil
+}
+
+//Returns the trees of every range this node replicates in v, building them
+//from the store if they were built for another view. s.merkle.m must be held
+func (s *DynamoServer) merkleTrees(v *clusterView) map[uint32]*MerkleTree {
+	if s.merkle.view == v {
+		return s.merkle.trees
+	}
+	ranges := make(map[uint32]map[string][]ObjectEntry)
+	if v.ring != nil {
+		for _, token := range v.ring.Ranges() {
+			if contains(v.ring.RangeIndices(token, v.nValue), v.pListLoc) {
+				ranges[token] = make(map[string][]ObjectEntry)
+			}
+		}
+		for _, key := range s.store.Keys() {
+			if shared, ok := ranges[v.ring.RangeOf(key)]; ok {
+				if entries, ok := s.store.Get(key); ok {
+					shared[key] = entries
+				}
+			}
+		}
+	}
+	trees := make(map[uint32]*MerkleTree, len(ranges))
+	for token, entries := range ranges {
+		trees[token] = NewMerkleTree(entries)
+	}
+	s.merkle.view = v
+	s.merkle.trees = trees
+	return trees
+}
+
+//Updates the leaf of key in the tree of its range after key was written or
+//deleted. Trees that have not been built yet are left alone
+func (s *DynamoServer) updateMerkle(key string) {
+	s.merkle.m.Lock()
+	defer s.merkle.m.Unlock()
+
+	if s.merkle.view == nil || s.merkle.view.ring == nil {
+		return
+	}
+	if tree, ok := s.merkle.trees[s.merkle.view.ring.RangeOf(key)]; ok {
+		// read the store again so concurrent writes leave the tree holding the
+		// version that was written last
+		entries, _ := s.store.Get(key)
+		tree.Update(key, entries)
+	}
+}
+
+//Returns the root hashes of the trees of ranges in v, nil for a range this
+//node does not replicate
+func (s *DynamoServer) merkleRoots(v *clusterView, ranges []uint32) [][]byte {
+	s.merkle.m.Lock()
+	defer s.merkle.m.Unlock()
+
+	trees := s.merkleTrees(v)
+	hashes := make([][]byte, len(ranges))
+	for i, token := range ranges {
+		if tree, ok := trees[token]; ok {
+			hashes[i] = tree.Root()
+		}
+	}
+	return hashes
+}
+
+//Returns the hashes of the given nodes of the tree of the range ending at token
+func (s *DynamoServer) merkleHashes(v *clusterView, token uint32, nodes []int) [][]byte {
+	s.merkle.m.Lock()
+	defer s.merkle.m.Unlock()
+
+	if tree, ok := s.merkleTrees(v)[token]; ok {
+		return tree.Hashes(nodes)
+	}
+	return make([][]byte, len(nodes))
+}
+
+//Returns every version stored under the given leaves of the tree of the range
+//ending at token as PutArgs
+func (s *DynamoServer) merkleEntries(v *clusterView, token uint32, leaves []int) []PutArgs {
+	s.merkle.m.Lock()
+	keys := make([]string, 0)
+	if tree, ok := s.merkleTrees(v)[token]; ok {
+		keys = tree.LeafKeys(leaves)
+	}
+	s.merkle.m.Unlock()
+
+	values := make([]PutArgs, 0)
+	for _, key := range keys {
+		values = append(values, s.storedVersions(key)...)
+	}
+	return values
+}
+
+//Returns the ranges both this node and the peer at preferenceList index peer of
+//v replicate
+func (s *DynamoServer) sharedRanges(v *clusterView, peer int) []uint32 {
+	ranges := make([]uint32, 0)
+	if v.ring == nil {
+		return ranges
+	}
+	for _, token := range v.ring.Ranges() {
+		replicas := v.ring.RangeIndices(token, v.nValue)
+		if contains(replicas, v.pListLoc) && contains(replicas, peer) {
+			ranges = append(ranges, token)
+		}
+	}
+	return ranges
+}
+
+//Runs one anti-entropy round with every other node: compares Merkle trees from
+//the root down and reconciles the keys under every leaf that differs, in both
+//directions, with PutOnce
+func (s *DynamoServer) syncReplicas() {
+	v := s.view()
+	for peer := range v.preferenceList {
+		if skipNode(v.pListLoc, peer) || s.isDead(v, peer) {
+			continue
+		}
+		if err := s.syncWith(v, peer); err != nil {
+			log.Println(DYNAMO_SERVER, "anti-entropy with", v.preferenceList[peer], "failed:", err)
+		}
+	}
+}
+
+//Runs anti-entropy with the node at preferenceList index peer of v. The roots
+//of every range both nodes replicate are compared in one call, and only the
+//ranges whose roots differ are walked down
+func (s *DynamoServer) syncWith(v *clusterView, peer int) error {
+	ranges := s.sharedRanges(v, peer)
+	if len(ranges) == 0 {
+		return nil
+	}
+	var reply MerkleReply
+	if err := v.call(peer, "MyDynamo.MerkleRoots", MerkleArgs{Peer: s.selfNode, Ranges: ranges}, &reply); err != nil {
+		return err
+	}
+	local := s.merkleRoots(v, ranges)
+	for i, token := range ranges {
+		if i < len(reply.Hashes) && bytes.Equal(local[i], reply.Hashes[i]) {
+			continue
+		}
+		if err := s.syncRange(v, peer, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Reconciles the range ending at token with the node at preferenceList index
+//peer of v
+func (s *DynamoServer) syncRange(v *clusterView, peer int, token uint32) error {
+	// walk down one level at a time, only following nodes whose hashes differ
+	nodes := []int{0}
+	for len(nodes) > 0 && nodes[0] < merkleFirstLeaf() {
+		differing, err := s.differingNodes(v, peer, token, nodes)
+		if err != nil {
+			return err
+		}
+		nodes = make([]int, 0, 2*len(differing))
+		for _, node := range differing {
+			nodes = append(nodes, 2*node+1, 2*node+2)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+	leaves, err := s.differingNodes(v, peer, token, nodes)
+	if err != nil || len(leaves) == 0 {
+		return err
+	}
+
+	// pull the peer's versions of every key under the differing leaves
+	var reply MerkleReply
+	if err := v.call(peer, "MyDynamo.MerkleEntries", MerkleArgs{Peer: s.selfNode, Range: token, Nodes: leaves}, &reply); err != nil {
+		return err
+	}
+	values, err := UnmarshalPutArgsList(reply.Entries)
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		var result bool
+		if err := s.PutOnce(value, &result); err != nil {
+			return err
+		}
+	}
+
+	// and push ours
+	for _, value := range s.merkleEntries(v, token, leaves) {
+		var result bool
+		if err := v.putOnce(peer, value, &result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Asks the peer for the hashes of nodes in the tree of the range ending at token
+//and returns the nodes whose hashes differ from ours
+func (s *DynamoServer) differingNodes(v *clusterView, peer int, token uint32, nodes []int) ([]int, error) {
+	var reply MerkleReply
+	if err := v.call(peer, "MyDynamo.MerkleHashes", MerkleArgs{Peer: s.selfNode, Range: token, Nodes: nodes}, &reply); err != nil {
+		return nil, err
+	}
+	local := s.merkleHashes(v, token, nodes)
+	differing := make([]int, 0)
+	for i, node := range nodes {
+		if i >= len(reply.Hashes) || !bytes.Equal(local[i], reply.Hashes[i]) {
+			differing = append(differing, node)
+		}
+	}
+	return differing, nil
+}
+
+//Runs anti-entropy every antiEntropyInterval while the node is online
+func (s *DynamoServer) runAntiEntropy() {
+	if antiEntropyInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(antiEntropyInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !s.isCrashed() && s.view().ring != nil {
+			s.syncReplicas()
+		}
+	}
+}
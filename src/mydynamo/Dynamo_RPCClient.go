@@ -9,6 +9,7 @@ import (
 type RPCClient struct {
 	ServerAddr string
 	rpcConn    *rpc.Client
+	Retry      RetryPolicy // how the context-aware methods retry failed requests
 }
 
 //Removes the RPC connection associated with this client
@@ -86,6 +87,62 @@ func (dynamoClient *RPCClient) Get(key string) *DynamoResult {
 	return &result
 }
 
+//Deletes a key from the server. context should come from a prior Get of the key
+func (dynamoClient *RPCClient) Delete(key string, context Context) bool {
+	var result bool
+	if dynamoClient.rpcConn == nil {
+		return false
+	}
+	err := dynamoClient.rpcConn.Call("MyDynamo.Delete", NewDeleteArgs(key, context), &result)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return result
+}
+
+//Adds delta to the counter stored at key, creating a PN-Counter if there is none
+func (dynamoClient *RPCClient) Increment(key string, delta int64) bool {
+	var result bool
+	if dynamoClient.rpcConn == nil {
+		return false
+	}
+	err := dynamoClient.rpcConn.Call("MyDynamo.Increment", CounterArgs{Key: key, Delta: delta}, &result)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return result
+}
+
+//Adds element to the set stored at key, creating the set if there is none
+func (dynamoClient *RPCClient) AddToSet(key string, element string) bool {
+	var result bool
+	if dynamoClient.rpcConn == nil {
+		return false
+	}
+	err := dynamoClient.rpcConn.Call("MyDynamo.AddToSet", SetArgs{Key: key, Element: element}, &result)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return result
+}
+
+//Removes element from the set stored at key
+func (dynamoClient *RPCClient) RemoveFromSet(key string, element string) bool {
+	var result bool
+	if dynamoClient.rpcConn == nil {
+		return false
+	}
+	err := dynamoClient.rpcConn.Call("MyDynamo.RemoveFromSet", SetArgs{Key: key, Element: element}, &result)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return result
+}
+
 //Emulates a crash on the server this client is connected to
 func (dynamoClient *RPCClient) Crash(seconds int) bool {
 	if dynamoClient.rpcConn == nil {
@@ -118,5 +175,95 @@ func NewDynamoRPCClient(serverAddr string) *RPCClient {
 	return &RPCClient{
 		ServerAddr: serverAddr,
 		rpcConn:    nil,
+		Retry:      DefaultRetryPolicy(),
+	}
+}
+
+//Instructs the server this client is connected to run a round of anti-entropy
+func (dynamoClient *RPCClient) AntiEntropy() {
+	if dynamoClient.rpcConn == nil {
+		return
+	}
+	var v Empty
+	err := dynamoClient.rpcConn.Call("MyDynamo.AntiEntropy", v, &v)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+}
+
+//Returns the number of stale replicas the server this client is connected to
+//has repaired after a Get, or -1 if the server could not be reached
+func (dynamoClient *RPCClient) ReadRepairs() int64 {
+	if dynamoClient.rpcConn == nil {
+		return -1
+	}
+	var v Empty
+	var count int64
+	err := dynamoClient.rpcConn.Call("MyDynamo.ReadRepairs", v, &count)
+	if err != nil {
+		log.Println(err)
+		return -1
+	}
+	return count
+}
+
+//Returns the membership view of the server this client is connected to, or
+//nil if the server could not be reached
+func (dynamoClient *RPCClient) Membership() []Member {
+	if dynamoClient.rpcConn == nil {
+		return nil
+	}
+	var v Empty
+	var view []Member
+	err := dynamoClient.rpcConn.Call("MyDynamo.Membership", v, &view)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return view
+}
+
+//Returns the members of the cluster as the server this client is connected to
+//sees them, or nil if the server could not be reached
+func (dynamoClient *RPCClient) Members() []DynamoNode {
+	if dynamoClient.rpcConn == nil {
+		return nil
+	}
+	var v Empty
+	var nodes []DynamoNode
+	err := dynamoClient.rpcConn.Call("MyDynamo.Members", v, &nodes)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	return nodes
+}
+
+//Makes the server this client is connected to join the cluster seed belongs to
+func (dynamoClient *RPCClient) Join(seed DynamoNode) bool {
+	if dynamoClient.rpcConn == nil {
+		return false
+	}
+	var v Empty
+	err := dynamoClient.rpcConn.Call("MyDynamo.Join", seed, &v)
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+//Makes the server this client is connected to hand off its data and leave the cluster
+func (dynamoClient *RPCClient) Leave() bool {
+	if dynamoClient.rpcConn == nil {
+		return false
+	}
+	var v Empty
+	err := dynamoClient.rpcConn.Call("MyDynamo.Leave", v, &v)
+	if err != nil {
+		log.Println(err)
+		return false
 	}
+	return true
 }
@@ -0,0 +1,188 @@
+package mydynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"reflect"
+	"time"
+)
+
+//Controls how the context-aware RPCClient methods retry failed requests.
+//Requests are retried when the connection breaks or hangs, and when the server
+//is offline. Stale contexts and missed quorums are returned to the caller, since
+//sending the same write again can not change the outcome. A write whose
+//connection broke after the server stored it is rejected as stale when retried
+type RetryPolicy struct {
+	MaxAttempts    int           // total number of tries, 1 disables retries
+	InitialBackoff time.Duration // wait before the first retry
+	MaxBackoff     time.Duration // upper bound on the wait between two tries
+	Multiplier     float64       // factor the wait grows by after every retry
+	AttemptTimeout time.Duration // deadline of a single try, zero leaves it to the context
+}
+
+//Returns the policy new clients start with
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    DEFAULT_RETRY_ATTEMPTS,
+		InitialBackoff: time.Duration(DEFAULT_RETRY_BACKOFF) * time.Millisecond,
+		MaxBackoff:     time.Duration(DEFAULT_MAX_RETRY_BACKOFF) * time.Millisecond,
+		Multiplier:     2,
+	}
+}
+
+//Returns the wait that follows backoff
+func (p RetryPolicy) next(backoff time.Duration) time.Duration {
+	backoff = time.Duration(float64(backoff) * p.Multiplier)
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+//Returns true if a request that failed with err may succeed when sent again
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return !isServerError(err) || errors.Is(err, ErrNodeOffline)
+}
+
+//Puts a value to the server, retrying according to dynamoClient.Retry until ctx
+//is done. Returns ErrStaleContext or ErrQuorumNotMet, wrapped in a DynamoError,
+//when the server rejects the write
+func (dynamoClient *RPCClient) PutCtx(ctx context.Context, value PutArgs) error {
+	var result bool
+	if err := dynamoClient.callCtx(ctx, "MyDynamo.Put", value, &result); err != nil {
+		return err
+	}
+	if !result {
+		return &DynamoError{Kind: ErrStaleContext, Message: fmt.Sprintf("put of %v was rejected", value.Key)}
+	}
+	return nil
+}
+
+//Gets a value from the server, retrying according to dynamoClient.Retry until
+//ctx is done
+func (dynamoClient *RPCClient) GetCtx(ctx context.Context, key string) (*DynamoResult, error) {
+	var result DynamoResult
+	if err := dynamoClient.callCtx(ctx, "MyDynamo.Get", key, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+//Gets every version of a key from the server, tombstones included, retrying
+//according to dynamoClient.Retry until ctx is done
+func (dynamoClient *RPCClient) GetVersionsCtx(ctx context.Context, key string) (*DynamoResult, error) {
+	var result DynamoResult
+	if err := dynamoClient.callCtx(ctx, "MyDynamo.GetVersions", key, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+//Deletes a key from the server, retrying according to dynamoClient.Retry until
+//ctx is done. context should come from a prior Get of the key
+func (dynamoClient *RPCClient) DeleteCtx(ctx context.Context, key string, context Context) error {
+	var result bool
+	if err := dynamoClient.callCtx(ctx, "MyDynamo.Delete", NewDeleteArgs(key, context), &result); err != nil {
+		return err
+	}
+	if !result {
+		return &DynamoError{Kind: ErrStaleContext, Message: fmt.Sprintf("delete of %v was rejected", key)}
+	}
+	return nil
+}
+
+//Emulates a crash on the server this client is connected to
+func (dynamoClient *RPCClient) CrashCtx(ctx context.Context, seconds int) error {
+	var success bool
+	return dynamoClient.callCtx(ctx, "MyDynamo.Crash", seconds, &success)
+}
+
+//Instructs the server this client is connected to gossip
+func (dynamoClient *RPCClient) GossipCtx(ctx context.Context) error {
+	var v Empty
+	return dynamoClient.callCtx(ctx, "MyDynamo.Gossip", v, &v)
+}
+
+//Returns the membership view of the server this client is connected to
+func (dynamoClient *RPCClient) MembershipCtx(ctx context.Context) ([]Member, error) {
+	var view []Member
+	if err := dynamoClient.callCtx(ctx, "MyDynamo.Membership", Empty{}, &view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+//Calls method on the server, retrying with exponential backoff while the
+//request fails in a way retryable allows. Errors reported by the server are
+//returned as DynamoErrors
+func (dynamoClient *RPCClient) callCtx(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	policy := dynamoClient.Retry
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := dynamoClient.attempt(ctx, method, args, reply)
+		if err == nil || !retryable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = policy.next(backoff)
+	}
+}
+
+//Makes a single try at calling method, dialing the server first if the client
+//has no connection. The dial and the call share the deadline of the try. A
+//connection that breaks or hangs is closed so the next try dials a fresh one
+func (dynamoClient *RPCClient) attempt(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	attemptCtx := ctx
+	if dynamoClient.Retry.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, dynamoClient.Retry.AttemptTimeout)
+		defer cancel()
+	}
+	if dynamoClient.rpcConn == nil {
+		conn, err := dialRPC(attemptCtx, dynamoClient.ServerAddr)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			// not wrapped, so a try that timed out is retried
+			return fmt.Errorf("failed to connect to %v: %v", dynamoClient.ServerAddr, err)
+		}
+		dynamoClient.rpcConn = conn
+	}
+
+	// an abandoned call may still write its reply, so every try gets its own
+	fresh := reflect.New(reflect.TypeOf(reply).Elem())
+	call := dynamoClient.rpcConn.Go(method, args, fresh.Interface(), make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error == nil {
+			reflect.ValueOf(reply).Elem().Set(fresh.Elem())
+			return nil
+		}
+		if isServerError(call.Error) {
+			return decodeError(call.Error)
+		}
+		dynamoClient.CleanConn()
+		return call.Error
+	case <-attemptCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dynamoClient.CleanConn()
+		return fmt.Errorf("%v timed out after %v", method, dynamoClient.Retry.AttemptTimeout)
+	}
+}
@@ -0,0 +1,84 @@
+package mydynamo
+
+import (
+	"log"
+	"sync/atomic"
+)
+
+//Whether Get waits for read repair to finish before returning
+var syncReadRepair bool = false
+
+//Sets whether Get repairs stale replicas before returning (true) or in the
+//background (false)
+func SetSyncReadRepair(sync bool) {
+	syncReadRepair = sync
+}
+
+//Returns, for every replica in responses, the versions of reconciled its
+//response was missing. Replicas that returned everything are left out.
+//A replica that returned ancestors of reconciled versions is missing the
+//descendants, so it is repaired too
+func staleReplicas(key string, responses map[int][]ObjectEntry, reconciled []ObjectEntry) map[int][]PutArgs {
+	stale := make(map[int][]PutArgs)
+	for replica, entries := range responses {
+		for _, newest := range reconciled {
+			found := false
+			for _, entry := range entries {
+				if entry.Context.Clock.Equals(newest.Context.Clock) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				value := putArgsFromEntry(key, newest)
+				stale[replica] = append(stale[replica], value)
+			}
+		}
+	}
+	return stale
+}
+
+//Pushes the versions a Get found missing to the replicas that lacked them,
+//in the background unless syncReadRepair is set
+func (s *DynamoServer) repairReplicas(v *clusterView, key string, responses map[int][]ObjectEntry, reconciled []ObjectEntry) {
+	stale := staleReplicas(key, responses, reconciled)
+	if len(stale) == 0 {
+		return
+	}
+	if syncReadRepair {
+		s.readRepair(v, stale)
+	} else {
+		go s.readRepair(v, stale)
+	}
+}
+
+//Writes the missing versions to every stale replica with PutOnce, counting
+//every replica that accepted all of them
+func (s *DynamoServer) readRepair(v *clusterView, stale map[int][]PutArgs) {
+	for replica, values := range stale {
+		repaired := true
+		for _, value := range values {
+			var result bool
+			var err error
+			if skipNode(v.pListLoc, replica) {
+				err = s.PutOnce(value, &result)
+			} else {
+				err = v.putOnce(replica, value, &result)
+			}
+			if err != nil {
+				log.Println(DYNAMO_SERVER, "read repair of", value.Key, "on", v.preferenceList[replica], "failed:", err)
+				repaired = false
+				break
+			}
+		}
+		if repaired {
+			atomic.AddInt64(&s.readRepairs, 1)
+		}
+	}
+}
+
+//Returns the number of replicas this node has repaired after a Get
+func (s *DynamoServer) ReadRepairs(_ Empty, count *int64) error {
+	*count = atomic.LoadInt64(&s.readRepairs)
+	return nil
+}
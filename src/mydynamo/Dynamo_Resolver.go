@@ -0,0 +1,195 @@
+package mydynamo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Reconciles the sibling versions of a key into a single value. siblings holds
+//at least two entries, none of them a tombstone
+type ConflictResolver interface {
+	Resolve(key string, siblings []ObjectEntry) ([]byte, error)
+}
+
+//Adapts a function to a ConflictResolver, for application-specific merges
+type ResolverFunc func(key string, siblings []ObjectEntry) ([]byte, error)
+
+func (f ResolverFunc) Resolve(key string, siblings []ObjectEntry) ([]byte, error) {
+	return f(key, siblings)
+}
+
+//Keeps the sibling the coordinators accepted last. Ties go to the larger value
+//so every node picks the same one
+var LastWriterWins ConflictResolver = ResolverFunc(func(_ string, siblings []ObjectEntry) ([]byte, error) {
+	latest := siblings[0]
+	for _, entry := range siblings[1:] {
+		if entry.Timestamp > latest.Timestamp ||
+			(entry.Timestamp == latest.Timestamp && bytes.Compare(entry.Value, latest.Value) > 0) {
+			latest = entry
+		}
+	}
+	return latest.Value, nil
+})
+
+//Keeps the largest value. Values that all parse as numbers are compared as
+//numbers, anything else is compared byte by byte
+var MaxValue ConflictResolver = ResolverFunc(func(_ string, siblings []ObjectEntry) ([]byte, error) {
+	numeric := true
+	numbers := make([]float64, len(siblings))
+	for i, entry := range siblings {
+		n, err := strconv.ParseFloat(strings.TrimSpace(string(entry.Value)), 64)
+		if err != nil {
+			numeric = false
+			break
+		}
+		numbers[i] = n
+	}
+	max := 0
+	for i := range siblings {
+		if numeric && numbers[i] > numbers[max] ||
+			!numeric && bytes.Compare(siblings[i].Value, siblings[max].Value) > 0 {
+			max = i
+		}
+	}
+	return siblings[max].Value, nil
+})
+
+//Treats every sibling as a JSON array and returns the union of their elements,
+//each element once, in the order of their JSON encoding
+var JSONSetUnion ConflictResolver = ResolverFunc(func(key string, siblings []ObjectEntry) ([]byte, error) {
+	union := make(map[string]json.RawMessage)
+	for _, entry := range siblings {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(entry.Value, &elements); err != nil {
+			return nil, fmt.Errorf("sibling of %v is not a JSON array: %v", key, err)
+		}
+		for _, element := range elements {
+			// compact the element so equal values are stored once
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, element); err != nil {
+				return nil, err
+			}
+			union[buf.String()] = json.RawMessage(buf.Bytes())
+		}
+	}
+	encodings := make([]string, 0, len(union))
+	for encoding := range union {
+		encodings = append(encodings, encoding)
+	}
+	sort.Strings(encodings)
+	merged := make([]json.RawMessage, 0, len(encodings))
+	for _, encoding := range encodings {
+		merged = append(merged, union[encoding])
+	}
+	return json.Marshal(merged)
+})
+
+//Returns the built-in resolver called name, as used by the conflict_resolvers
+//configuration key: "lww", "max" or "set_union"
+func BuiltinResolver(name string) (ConflictResolver, error) {
+	switch name {
+	case "lww":
+		return LastWriterWins, nil
+	case "max":
+		return MaxValue, nil
+	case "set_union":
+		return JSONSetUnion, nil
+	}
+	return nil, fmt.Errorf("unknown conflict resolver %v", name)
+}
+
+//Resolves the siblings in result with resolver. Returns the PutArgs that writes
+//the merged value back under a context descended from every sibling, and false
+//if result holds fewer than two live siblings and needs no resolution
+func ResolveSiblings(key string, result DynamoResult, resolver ConflictResolver) (PutArgs, bool, error) {
+	live := make([]ObjectEntry, 0, len(result.EntryList))
+	clocks := make([]VectorClock, 0, len(result.EntryList))
+	for _, entry := range result.EntryList {
+		// tombstones take no part in the merge, but the merged write must
+		// supersede them too
+		clocks = append(clocks, entry.Context.Clock)
+		if !entry.Tombstone {
+			live = append(live, entry)
+		}
+	}
+	if len(live) < 2 {
+		return PutArgs{}, false, nil
+	}
+	value, err := resolver.Resolve(key, live)
+	if err != nil {
+		return PutArgs{}, false, err
+	}
+	clock := NewVectorClock()
+	clock.Combine(clocks)
+	return NewPutArgs(key, NewContext(clock), value), true, nil
+}
+
+//Resolvers a server applies to keys by prefix
+var resolvers = struct {
+	byPrefix map[string]ConflictResolver
+	m        sync.RWMutex
+}{byPrefix: make(map[string]ConflictResolver)}
+
+//Makes every Get coordinated by this process resolve the siblings of keys
+//starting with prefix with resolver, and write the merged value back. The
+//empty prefix matches every key. A nil resolver removes the prefix
+func RegisterResolver(prefix string, resolver ConflictResolver) {
+	resolvers.m.Lock()
+	defer resolvers.m.Unlock()
+
+	if resolver == nil {
+		delete(resolvers.byPrefix, prefix)
+	} else {
+		resolvers.byPrefix[prefix] = resolver
+	}
+}
+
+//Returns the resolver registered for the longest prefix of key, or nil
+func resolverFor(key string) ConflictResolver {
+	resolvers.m.RLock()
+	defer resolvers.m.RUnlock()
+
+	var found ConflictResolver
+	longest := -1
+	for prefix, resolver := range resolvers.byPrefix {
+		if strings.HasPrefix(key, prefix) && len(prefix) > longest {
+			found = resolver
+			longest = len(prefix)
+		}
+	}
+	return found
+}
+
+//Writes back the resolution of the siblings in result if a resolver is
+//registered for key, and replaces them with the merged version. result is left
+//as it is when the write-back fails, so the caller still sees every sibling
+func (s *DynamoServer) resolveConflicts(v *clusterView, replicas []int, key string, result *DynamoResult) {
+	resolver := resolverFor(key)
+	if resolver == nil {
+		return
+	}
+	merged, ok, err := ResolveSiblings(key, *result, resolver)
+	if err != nil {
+		log.Println(DYNAMO_SERVER, "failed to resolve siblings of", key, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	var written bool
+	if err := s.replicatePut(v, replicas, merged, &written); err != nil {
+		log.Println(DYNAMO_SERVER, "failed to write back resolved", key, err)
+		return
+	}
+	var local DynamoResult
+	if err := s.GetOnce(key, &local); err == nil {
+		RemoveResultAncestors(&local)
+		result.EntryList = local.EntryList
+	}
+}
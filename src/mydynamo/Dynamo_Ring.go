@@ -0,0 +1,122 @@
+package mydynamo
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+//A single virtual node: a position on the ring and the index of the physical
+//node in the membership list that owns it
+type vnode struct {
+	token uint32
+	owner int
+}
+
+//Consistent-hashing ring. Every physical node is placed on the ring
+//VIRTUAL_NODES times so that keys are spread evenly across the cluster
+type Ring struct {
+	nodes  []DynamoNode
+	vnodes []vnode
+}
+
+//Hashes a string to a position on the ring. As in the Dynamo paper, MD5 is used
+//so every node computes the same ring no matter what order it learned the
+//membership list in
+func ringHash(s string) uint32 {
+	sum := md5.Sum([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+//Creates a new Ring with each of the given nodes placed at vnodeCount positions
+func NewRing(nodes []DynamoNode, vnodeCount int) *Ring {
+	ring := &Ring{
+		nodes:  nodes,
+		vnodes: make([]vnode, 0, len(nodes)*vnodeCount),
+	}
+	for idx, node := range nodes {
+		for v := 0; v < vnodeCount; v++ {
+			token := ringHash(node.Address + ":" + node.Port + "#" + strconv.Itoa(v))
+			ring.vnodes = append(ring.vnodes, vnode{token: token, owner: idx})
+		}
+	}
+	sort.Slice(ring.vnodes, func(i, j int) bool {
+		if ring.vnodes[i].token == ring.vnodes[j].token {
+			return ring.vnodes[i].owner < ring.vnodes[j].owner
+		}
+		return ring.vnodes[i].token < ring.vnodes[j].token
+	})
+	return ring
+}
+
+//Returns the indices (into the membership list the ring was built from) of the
+//first n distinct physical nodes found walking clockwise from the key's position
+func (r *Ring) PreferenceIndices(key string, n int) []int {
+	return r.RangeIndices(r.RangeOf(key), n)
+}
+
+//Returns the position in vnodes of the first vnode at or after token
+func (r *Ring) search(token uint32) int {
+	return sort.Search(len(r.vnodes), func(i int) bool {
+		return r.vnodes[i].token >= token
+	}) % len(r.vnodes)
+}
+
+//Returns the owners of the first n distinct physical nodes found walking
+//clockwise from the vnode at position start
+func (r *Ring) indicesFrom(start int, n int) []int {
+	indices := make([]int, 0, n)
+	seen := make(map[int]bool)
+	for i := 0; i < len(r.vnodes) && len(indices) < n; i++ {
+		owner := r.vnodes[(start+i)%len(r.vnodes)].owner
+		if !seen[owner] {
+			seen[owner] = true
+			indices = append(indices, owner)
+		}
+	}
+	return indices
+}
+
+//Returns the token of the vnode that ends the range key falls in. Every key in
+//a range has the same preference list, so ranges are the unit that replicas
+//compare during anti-entropy
+func (r *Ring) RangeOf(key string) uint32 {
+	if len(r.vnodes) == 0 {
+		return 0
+	}
+	return r.vnodes[r.search(ringHash(key))].token
+}
+
+//Returns the tokens of every range on the ring, in ring order
+func (r *Ring) Ranges() []uint32 {
+	tokens := make([]uint32, 0, len(r.vnodes))
+	for i, vn := range r.vnodes {
+		if i == 0 || vn.token != r.vnodes[i-1].token {
+			tokens = append(tokens, vn.token)
+		}
+	}
+	return tokens
+}
+
+//Returns the indices of the first n distinct physical nodes responsible for the
+//range ending at token
+func (r *Ring) RangeIndices(token uint32, n int) []int {
+	if n > len(r.nodes) {
+		n = len(r.nodes)
+	}
+	if n <= 0 || len(r.vnodes) == 0 {
+		return make([]int, 0)
+	}
+	return r.indicesFrom(r.search(token), n)
+}
+
+//Returns the first n distinct physical nodes responsible for key
+func (r *Ring) PreferenceList(key string, n int) []DynamoNode {
+	indices := r.PreferenceIndices(key, n)
+	nodes := make([]DynamoNode, 0, len(indices))
+	for _, idx := range indices {
+		nodes = append(nodes, r.nodes[idx])
+	}
+	return nodes
+}
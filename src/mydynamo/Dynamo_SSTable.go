@@ -0,0 +1,205 @@
+package mydynamo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+)
+
+//Number of bloom filter bits allotted to every key in an SSTable
+const bloomBitsPerKey int = 10
+
+//Number of bit positions each key sets in a bloom filter
+const bloomHashes int = 7
+
+//Bloom filter used to skip SSTables that can not contain a key
+type bloomFilter struct {
+	Bits []uint64
+}
+
+//Creates a bloom filter sized for keyCount keys
+func newBloomFilter(keyCount int) bloomFilter {
+	words := (keyCount*bloomBitsPerKey + 63) / 64
+	if words == 0 {
+		words = 1
+	}
+	return bloomFilter{Bits: make([]uint64, words)}
+}
+
+//Derives bloomHashes bit positions from two halves of a 64-bit FNV hash
+func (b bloomFilter) positions(key string) []uint {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	size := uint(len(b.Bits) * 64)
+
+	positions := make([]uint, bloomHashes)
+	for i := range positions {
+		positions[i] = uint(h1+uint32(i)*h2) % size
+	}
+	return positions
+}
+
+func (b bloomFilter) add(key string) {
+	for _, pos := range b.positions(key) {
+		b.Bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+//Returns false only if key was never added to the filter
+func (b bloomFilter) mayContain(key string) bool {
+	for _, pos := range b.positions(key) {
+		if b.Bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//Index block stored at the end of every SSTable
+type sstableIndex struct {
+	Keys    []string
+	Offsets []int64
+	Bloom   bloomFilter
+}
+
+//An immutable, sorted run of keys on disk. The file holds one framed record
+//per key in key order, followed by the gob-encoded index block and an 8 byte
+//footer holding the index offset
+type sstable struct {
+	seq   int
+	path  string
+	file  *os.File
+	index sstableIndex
+}
+
+//Writes records to a new SSTable at path. The table is written to a temporary
+//file first and renamed into place, so a table either exists whole or not at all
+func writeSSTable(path string, records map[string]walRecord) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(f)
+
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	index := sstableIndex{
+		Keys:    keys,
+		Offsets: make([]int64, 0, len(keys)),
+		Bloom:   newBloomFilter(len(keys)),
+	}
+	var offset int64
+	for _, key := range keys {
+		frame, err := encodeRecord(records[key])
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := writer.Write(frame); err != nil {
+			f.Close()
+			return err
+		}
+		index.Offsets = append(index.Offsets, offset)
+		index.Bloom.add(key)
+		offset += int64(len(frame))
+	}
+
+	var indexBlock bytes.Buffer
+	if err := gob.NewEncoder(&indexBlock).Encode(index); err != nil {
+		f.Close()
+		return err
+	}
+	footer := make([]byte, 8)
+	binary.BigEndian.PutUint64(footer, uint64(offset))
+	writer.Write(indexBlock.Bytes())
+	writer.Write(footer)
+	if err := writer.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+//Opens the SSTable at path and loads its index into memory
+func openSSTable(path string, seq int) (*sstable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.Size() < 8 {
+		f.Close()
+		return nil, fmt.Errorf("sstable %v is truncated", path)
+	}
+	footer := make([]byte, 8)
+	if _, err := f.ReadAt(footer, info.Size()-8); err != nil {
+		f.Close()
+		return nil, err
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(footer))
+	indexReader := io.NewSectionReader(f, indexOffset, info.Size()-8-indexOffset)
+
+	table := &sstable{seq: seq, path: path, file: f}
+	if err := gob.NewDecoder(indexReader).Decode(&table.index); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return table, nil
+}
+
+//Looks up key, consulting the bloom filter before touching the file
+func (t *sstable) get(key string) (walRecord, bool, error) {
+	var record walRecord
+	if !t.index.Bloom.mayContain(key) {
+		return record, false, nil
+	}
+	i := sort.SearchStrings(t.index.Keys, key)
+	if i == len(t.index.Keys) || t.index.Keys[i] != key {
+		return record, false, nil
+	}
+	record, err := readRecord(io.NewSectionReader(t.file, t.index.Offsets[i], 1<<62))
+	if err != nil {
+		return record, false, err
+	}
+	return record, true, nil
+}
+
+//Calls apply with every key in the table in sorted order
+func (t *sstable) scan(apply func(walRecord)) error {
+	reader := bufio.NewReader(io.NewSectionReader(t.file, 0, 1<<62))
+	for range t.index.Keys {
+		record, err := readRecord(reader)
+		if err != nil {
+			return err
+		}
+		apply(record)
+	}
+	return nil
+}
+
+func (t *sstable) close() error {
+	return t.file.Close()
+}
@@ -2,9 +2,11 @@ package mydynamo
 
 import (
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/rpc"
+	"sync/atomic"
 	"time"
 	"fmt"
 )
@@ -13,27 +15,25 @@ type DynamoServer struct {
 	/*------------Dynamo-specific-------------*/
 	wValue         int          //Number of nodes to write to on each Put
 	rValue         int          //Number of nodes to read from on each Get
-	preferenceList []DynamoNode //Ordered list of other Dynamo nodes to perform operations o
+	nValue         int          //Number of nodes each key is replicated to
+	views          *viewHolder  //Preference list, ring, connection pool and gossipers, see clusterView
 	selfNode       DynamoNode   //This node's address and port info
 	nodeID         string       //ID of this node
-	store 			map[string][]ObjectEntry	 // The key/value store for this node
-	crashUntil		time.Time // simulate node being offline until this moment in time
-	gossiper			map[int]Gossiper // map node index from preferenceList to a Gossiper struct
-	pListLoc			int // location of this node inside its own preferenceList
-	connections		[]*rpc.Client
+	store 			Storage	 // The key/value store for this node
+	locks			*keyLocks // serializes read-modify-write cycles on the same key
+	crdtLocks		*keyLocks // serializes the CRDT updates this node coordinates, so none is lost
+	stampLocks		*keyLocks // serializes stamping a write with storing it locally
+	crashUntil		int64 // simulate node being offline until this moment in time, in unix nanoseconds, accessed atomically
+	tombstones		*TombstoneTracker // tombstones this node coordinated that have not been purged
+	merkle			*merkleCache // Merkle trees over every replicated range, updated on every write
+	readRepairs		int64 // number of stale replicas repaired after a Get, updated atomically
+	membership		*Membership // gossiped membership view and failure detector
+	transferring	int32 // set while this node is joining and copying its key ranges, accessed atomically
 
 }
 
 func (s *DynamoServer) SendPreferenceList(incomingList []DynamoNode, _ *Empty) error {
-	s.preferenceList = incomingList
-	for i, node := range s.preferenceList {
-		if node.Equals(s.selfNode) {
-			s.pListLoc	= i
-			break
-		}
-	}
-	s.newGossiperMap()
-	s.connections	= s.connectToPreferenceNodes()
+	s.setMembers(incomingList)
 	return nil
 }
 
@@ -41,46 +41,153 @@ func (s *DynamoServer) SendPreferenceList(incomingList []DynamoNode, _ *Empty) e
 // As this method takes no arguments, we must use the Empty placeholder
 func (s *DynamoServer) Gossip(_ Empty, _ *Empty) error {
 	if s.isCrashed() {
-		return fmt.Errorf("server %v is currently offline", s.nodeID)
-	}
-
-
-	//conns	:= s.connectToPreferenceNodes()
-	for key, _ := range s.store {
-		idx	:= 0 // track index for lists of nodes excluding self
-		for i, _ := range s.preferenceList {
-			// check if current node in preferenceList is self
-			if !skipNode(s.pListLoc, i) {
-				// ckeck if node needs replications
-				if g, ok := s.gossiper[i]; ok {
-					// check if need to replicate entries at key
-					if entries, ok := g.gossipMap[key]; ok {
-						// go through list of entries that need to replicate
-						for _, entry := range entries {
-							var result *bool
-							args	:= NewPutArgs(key, entry.Context, entry.Value)
-							if err	:= s.connections[idx].Call("MyDynamo.PutOnce", args, result); err != nil {
-								// There are still some entries to be consumed
-								break
-							} else {
-								g.ConsumeEntry(key)
-							}
-						}
+		return s.offlineError()
+	}
+
+
+	// every gossiper holds the writes one node missed, either because this node
+	// coordinated them or because it accepted them as a hint for that node
+	v	:= s.view()
+	for i, g := range v.gossiper {
+		// skip self, and nodes the failure detector says are down
+		if skipNode(v.pListLoc, i) || s.isDead(v, i) {
+			continue
+		}
+		for _, key := range g.Keys() {
+			// go through list of entries that need to replicate
+			for _, entry := range g.GetGossipList(key) {
+				var result bool
+				args	:= putArgsFromEntry(key, entry)
+				if err	:= v.putOnce(i, args, &result); err != nil {
+					// There are still some entries to be consumed
+					break
+				} else {
+					g.ConsumeVersion(key, entry.Context.Clock)
+					if entry.Tombstone {
+						s.tombstones.Ack(key, entry.Context.Clock, memberKey(v.preferenceList[i]))
 					}
 				}
-				idx++
 			}
 		}
 	}
+	s.collectTombstones()
+	return nil
+}
+
+//Removes the tombstone with the given context from this node's copy of the key.
+//Called by the node that coordinated the Delete once every replica holds the tombstone
+func (s *DynamoServer) PurgeTombstone(args DeleteArgs, result *bool) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	s.locks.Lock(args.Key)
+	defer s.locks.Unlock(args.Key)
+
+	storedEntries, ok	:= s.store.Get(args.Key)
+	if !ok {
+		*result	= false
+		return nil
+	}
+	remaining	:= make([]ObjectEntry, 0)
+	for _, entry := range storedEntries {
+		if !entry.Tombstone || !entry.Context.Clock.Equals(args.Context.Clock) {
+			remaining	= append(remaining, entry)
+		}
+	}
+	if len(remaining) == len(storedEntries) {
+		*result	= false
+		return nil
+	}
+	// delete first so engines that merge versions drop the tombstone for good
+	if err := s.deleteKey(args.Key); err != nil {
+		return err
+	}
+	if len(remaining) > 0 {
+		if err := s.putEntries(args.Key, remaining); err != nil {
+			return err
+		}
+	}
+	*result	= true
+	return nil
+}
+
+//Returns the roots of the Merkle trees over args.Ranges, nil for a range this
+//node does not replicate
+func (s *DynamoServer) MerkleRoots(args MerkleArgs, reply *MerkleReply) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	v	:= s.view()
+	peer	:= v.indexOf(args.Peer)
+	if peer < 0 || skipNode(v.pListLoc, peer) {
+		return fmt.Errorf("server %v does not share keys with %v", s.nodeID, args.Peer)
+	}
+	reply.Hashes	= s.merkleRoots(v, args.Ranges)
+	return nil
+}
+
+//Returns the hashes of the requested nodes of the Merkle tree over args.Range
+func (s *DynamoServer) MerkleHashes(args MerkleArgs, reply *MerkleReply) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	v	:= s.view()
+	peer	:= v.indexOf(args.Peer)
+	if peer < 0 || skipNode(v.pListLoc, peer) {
+		return fmt.Errorf("server %v does not share keys with %v", s.nodeID, args.Peer)
+	}
+	reply.Hashes	= s.merkleHashes(v, args.Range, args.Nodes)
+	return nil
+}
+
+//Returns every version of the keys under the requested leaves of the Merkle
+//tree over args.Range
+func (s *DynamoServer) MerkleEntries(args MerkleArgs, reply *MerkleReply) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	v	:= s.view()
+	peer	:= v.indexOf(args.Peer)
+	if peer < 0 || skipNode(v.pListLoc, peer) {
+		return fmt.Errorf("server %v does not share keys with %v", s.nodeID, args.Peer)
+	}
+	reply.Entries	= MarshalPutArgsList(s.merkleEntries(v, args.Range, args.Nodes))
+	return nil
+}
+
+// Merges a peer's membership view and replies with this node's view
+func (s *DynamoServer) ExchangeMembership(args MembershipArgs, reply *MembershipArgs) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	s.membership.Merge(args.Members)
+	*reply	= MembershipArgs{From: s.selfNode, Members: s.membership.View()}
+	return nil
+}
+
+// Returns this node's current membership view
+// As this method takes no arguments, we must use the Empty placeholder
+func (s *DynamoServer) Membership(_ Empty, view *[]Member) error {
+	*view	= s.membership.View()
+	return nil
+}
+
+// Forces server to run a round of anti-entropy with every other node
+// As this method takes no arguments, we must use the Empty placeholder
+func (s *DynamoServer) AntiEntropy(_ Empty, _ *Empty) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	s.syncReplicas()
 	return nil
 }
 
 //Makes server unavailable for some seconds
 func (s *DynamoServer) Crash(seconds int, success *bool) error {
 	if s.isCrashed() {
-		return fmt.Errorf("server %v is currently offline\n", s.nodeID)
+		return s.offlineError()
 	}
-	s.crashUntil	= time.Now().Add(time.Second * time.Duration(seconds))
+	atomic.StoreInt64(&s.crashUntil, time.Now().Add(time.Second * time.Duration(seconds)).UnixNano())
 	*success	= true
 	return nil
 }
@@ -89,93 +196,253 @@ func (s *DynamoServer) Crash(seconds int, success *bool) error {
 func (s *DynamoServer) Put(value PutArgs, result *bool) error {
 
 	if s.isCrashed() {
-		return fmt.Errorf("server %v is currently offline", s.nodeID)
+		return s.offlineError()
+	}
+
+	v	:= s.view()
+	replicas	:= v.replicasFor(value.Key)
+	if !contains(replicas, v.pListLoc) {
+		// this node does not hold the key, hand the request to one of its replicas
+		return s.forward(v, "MyDynamo.Put", replicas, value, result)
+	}
+
+	// tombstones can only be written through Delete
+	value.Tombstone	= false
+	if len(value.Context.Clock.Elements) == 0 {
+		// a fresh context means the client saw no value, so it must also
+		// supersede any tombstone left by a Delete
+		s.foldTombstones(&value)
+	}
+	return s.replicatePut(v, replicas, value, result)
+}
+
+// Delete a key from this server and W other servers by writing a tombstone
+func (s *DynamoServer) Delete(args DeleteArgs, result *bool) error {
+
+	if s.isCrashed() {
+		return s.offlineError()
 	}
 
-	value.Context.Clock.Increment(s.nodeID)
+	v	:= s.view()
+	replicas	:= v.replicasFor(args.Key)
+	if !contains(replicas, v.pListLoc) {
+		// this node does not hold the key, hand the request to one of its replicas
+		return s.forward(v, "MyDynamo.Delete", replicas, args, result)
+	}
+
+	value	:= NewPutArgs(args.Key, args.Context, nil)
+	value.Tombstone	= true
+	return s.replicatePut(v, replicas, value, result)
+}
+
+// Write value locally with this node's clock incremented, then to every other
+// replica at once, returning as soon as W writes succeeded. Replicas that have
+// not stored the write by then are left to the Gossiper, and taken off it again
+// if they store it in the background. If a replica can not be reached, the write is handed to the next
+// healthy node past the top N as a hint for it, and that hint counts toward W.
+// Returns ErrStaleContext if this node rejects the write and ErrQuorumNotMet if
+// fewer than W nodes stored it
+func (s *DynamoServer) replicatePut(v *clusterView, replicas []int, value PutArgs, result *bool) error {
+	// the clock is stamped and stored locally as one step, so two writes
+	// through this node never draw the same dot
+	s.stampLocks.Lock(value.Key)
+	stored, _	:= s.store.Get(value.Key)
+	value.Context.Clock	= StampClock(GetCausality(), s.nodeID, value.Context.Clock, stored)
+	value.Timestamp	= time.Now().UnixNano()
 	err	:= s.PutOnce(value, result)
+	s.stampLocks.Unlock(value.Key)
 	if err != nil {
 		return err
 	}
-	//conns	:= s.connectToPreferenceNodes()
+	if !*result {
+		return fmt.Errorf("server %v: %w for key %v", s.nodeID, ErrStaleContext, value.Key)
+	}
+
+	// send the write to every live replica at once and wait for the first W
+	live, unreachable	:= s.liveReplicas(v, replicas)
+	responses	:= v.fanOut(live, "MyDynamo.ReplicatePut", MarshalPutArgs(value), func() interface{} { return new(bool) })
+	acked	:= make(map[int]bool) // replicas that stored the value before the Put returned
+	outstanding	:= len(live)
 	w	:= 1 // number of writes to nodes (inlcudes local write)
-	idx	:= 0
-	for i, _ := range s.preferenceList {
-		if !skipNode(s.pListLoc, i) {
-			if w < s.wValue {
-				var q_result *bool
-				if err := s.connections[idx].Call("MyDynamo.PutOnce", value, q_result); err != nil {
-					// node is currently down, add to gossip list
-					s.gossiper[i].Append(value.Key, NewObjectEntry(value.Context, value.Value))
-				} else {
-					// successfully sent request to node (i.e. node online, does not guarantee that request itself was a success)
-					w++
-				}
-			} else {
-				// finished writing to wValue nodes, add to gossip list for remaining nodes
-				s.gossiper[i].Append(value.Key, NewObjectEntry(value.Context, value.Value))
+	for w < s.wValue && outstanding > 0 {
+		response	:= <-responses
+		outstanding--
+		if response.err == nil {
+			// successfully sent request to node (i.e. node online, does not guarantee that request itself was a success)
+			acked[response.replica]	= true
+			w++
+		} else {
+			unreachable	= append(unreachable, response.replica)
+		}
+	}
+	// every replica that has not stored the write yet gets it through gossip,
+	// unless it answers in the background first
+	for _, i := range replicas {
+		if !skipNode(v.pListLoc, i) && !acked[i] {
+			v.gossiper[i].Append(value.Key, entryFromPutArgs(value))
+		}
+	}
+
+	// sloppy quorum: stand in for each unreachable replica with the next healthy node
+	fallbacks	:= v.fallbacksFor(value.Key)
+	for _, owner := range unreachable {
+		for w < s.wValue && len(fallbacks) > 0 {
+			holder	:= fallbacks[0]
+			fallbacks	= fallbacks[1:]
+			if s.isDead(v, holder) {
+				continue
+			}
+			var h_result bool
+			hint	:= NewHintArgs(v.preferenceList[owner], value)
+			if err := v.call(holder, "MyDynamo.PutHint", hint, &h_result); err == nil {
+				w++
+				break
 			}
-			idx++
 		}
 	}
-	//s.gossiper.Append(value.Key, NewObjectEntry(value.Context, value.Value))
+	if value.Tombstone {
+		pending	:= make(map[string]bool) // replicas that have not stored the value yet
+		for _, i := range replicas {
+			if !skipNode(v.pListLoc, i) && !acked[i] {
+				pending[memberKey(v.preferenceList[i])]	= true
+			}
+		}
+		s.tombstones.Track(value.Key, value.Context.Clock, pending)
+	}
+	// the replicas that have not answered yet finish in the background
+	if outstanding > 0 {
+		go s.finishPut(v, value, responses, outstanding)
+	}
 
+	// the write only succeeds once W nodes have it
+	if w < s.wValue {
+		*result	= false
+		return fmt.Errorf("server %v: %w for key %v, %v of %v writes succeeded", s.nodeID, ErrQuorumNotMet, value.Key, w, s.wValue)
+	}
 	return nil
 
 }
+func (s *DynamoServer) PutHint(hint HintArgs, result *bool) error {
+	if s.isCrashed() {
+		return s.offlineError()
+	}
+	value, err	:= UnmarshalPutArgs(hint.Value)
+	if err != nil {
+		return err
+	}
+	v	:= s.view()
+	owner	:= v.indexOf(hint.Owner)
+	if skipNode(v.pListLoc, owner) || owner < 0 {
+		return fmt.Errorf("server %v can not hold a hint for %v", s.nodeID, hint.Owner)
+	}
+	v.gossiper[owner].Append(value.Key, entryFromPutArgs(value))
+	*result	= true
+	return nil
+}
 
-//Get a file from this server, matched with R other servers
+//Get a file from this server, matched with the first R replicas to answer
 func (s *DynamoServer) Get(key string, result *DynamoResult) error {
+	if err := s.read(key, "MyDynamo.Get", result); err != nil {
+		return err
+	}
+	RemoveTombstones(result)
+	return nil
+}
+
+//Like Get, but keeps the tombstones of deleted versions in the result, so a
+//client that writes back a merged value can make it supersede them too
+func (s *DynamoServer) GetVersions(key string, result *DynamoResult) error {
+	return s.read(key, "MyDynamo.GetVersions", result)
+}
+
+//Reads key from the first R replicas to answer, tombstones included. A node
+//that does not hold the key forwards the read to a replica with method
+func (s *DynamoServer) read(key string, method string, result *DynamoResult) error {
 
 	if s.isCrashed() {
-		return fmt.Errorf("server %v is currently offline\n", s.nodeID)
+		return s.offlineError()
 	}
 
-	if err := s.GetOnce(key, result); err != nil {
+	v	:= s.view()
+	replicas	:= v.replicasFor(key)
+	if !contains(replicas, v.pListLoc) {
+		// this node does not hold the key, hand the request to one of its replicas
+		return s.forward(v, method, replicas, key, result)
+	}
+
+	// keep every replica's response so the stale ones can be repaired
+	responses	:= make(map[int][]ObjectEntry)
+	var local DynamoResult
+	if err := s.GetOnce(key, &local); err != nil {
 		return err
 	}
+	responses[v.pListLoc]	= local.EntryList
+	lists	:= [][]ObjectEntry{local.EntryList}
 
+	// ask every live replica at once and wait for the first R. A joining node
+	// may not have the key yet, and sync read repair must see every replica
+	// before it returns, so both wait for all of them
+	live, _	:= s.liveReplicas(v, replicas)
+	remaining	:= v.fanOut(live, "MyDynamo.ReplicateGet", key, func() interface{} { return new([]byte) })
+	waitAll	:= atomic.LoadInt32(&s.transferring) == 1 || syncReadRepair
+	outstanding	:= len(live)
 	r	:= 1 // number of reads from nodes (inlcudes local read)
-	idx	:= 0
-	for i, _ := range s.preferenceList {
-		if !skipNode(s.pListLoc, i) {
-			if r < s.rValue {
-				if err := s.connections[idx].Call("MyDynamo.GetOnce", key, result); err == nil {
-					r++
-				}
-			}
-			idx++
+	for outstanding > 0 && (r < s.rValue || waitAll) {
+		response	:= <-remaining
+		outstanding--
+		if entries, err := response.entries(); err == nil {
+			responses[response.replica]	= entries
+			lists	= append(lists, entries)
+			r++
 		}
 	}
+	result.EntryList	= mergeCRDTEntries(MergeSiblings(lists...))
 	RemoveResultAncestors(result)
+	if outstanding > 0 {
+		// repair once the slower replicas have answered too
+		go s.finishGet(v, key, responses, remaining, outstanding)
+	} else {
+		s.repairReplicas(v, key, responses, result.EntryList)
+	}
+	s.resolveConflicts(v, replicas, key, result)
 	return nil
 }
 
 func (s *DynamoServer) PutOnce(value PutArgs, result *bool) error {
 	if s.isCrashed() {
-		return fmt.Errorf("server %v is currently offline\n", s.nodeID)
+		return s.offlineError()
 	}
+	// the entries are read, merged and written back as one step
+	s.locks.Lock(value.Key)
+	defer s.locks.Unlock(value.Key)
+
 	// Get the list of stored object entries associated with the given key
-	storedEntries, ok	:= s.store[value.Key]
+	storedEntries, ok	:= s.store.Get(value.Key)
 	// Check if the key was already present in the store
 	if !ok {
 		// create new list of object entries and add the passed in entry to the list
 		entries	:= make([]ObjectEntry, 0)
-		entries	= append(entries, ObjectEntry{
-			Context: value.Context,
-			Value:	value.Value,
-		})
+		entries	= append(entries, entryFromPutArgs(value))
 		// associated the newly created list of object entries with the passed in key
-		s.store[value.Key]	= entries
+		if err := s.putEntries(value.Key, entries); err != nil {
+			return err
+		}
 		// indicate success
 		*result	= true
 		return nil
 	}
 
 	// new object entry constructed from the given arguments
-	newEntry	:= ObjectEntry {
-		Context: value.Context,
-		Value: value.Value,
+	newEntry	:= entryFromPutArgs(value)
+	// CRDT states are merged into the stored state instead of kept as siblings
+	if merged, ok, err := mergeCRDTInto(storedEntries, newEntry); err != nil {
+		return err
+	} else if ok {
+		if err := s.putEntries(value.Key, merged); err != nil {
+			return err
+		}
+		*result	= true
+		return nil
 	}
 	added	:= false	// flag to check if new entry has already been added to list
 	concurrent	:= false// flag to check if new entry was concurrent with any concurrent entries
@@ -185,13 +452,17 @@ func (s *DynamoServer) PutOnce(value PutArgs, result *bool) error {
 	}
 
 	if added {
-		s.store[value.Key]	= storedEntries
+		if err := s.putEntries(value.Key, storedEntries); err != nil {
+			return err
+		}
 		*result	= true
 		return nil
 	}
 
 	if concurrent {
-		s.store[value.Key]	= append(s.store[value.Key], newEntry)
+		if err := s.putEntries(value.Key, append(storedEntries, newEntry)); err != nil {
+			return err
+		}
 		*result	= true
 	} else {
 		*result	= false
@@ -202,11 +473,11 @@ func (s *DynamoServer) PutOnce(value PutArgs, result *bool) error {
 
 func (s *DynamoServer) GetOnce(key string, result *DynamoResult) error {
 	if s.isCrashed() {
-		return fmt.Errorf("server %v is currently offline\n", s.nodeID)
+		return s.offlineError()
 	}
 	r := DynamoResult{EntryList: result.EntryList,}
 //	entryList	:= result.Entry
-	if entries, ok	:= s.store[key]; ok {
+	if entries, ok	:= s.store.Get(key); ok {
 		//r.EntryList	= entries
 		for _, entry := range entries {
 			r.EntryList	= append(r.EntryList, entry)
@@ -217,31 +488,64 @@ func (s *DynamoServer) GetOnce(key string, result *DynamoResult) error {
 	return nil
 }
 
+// PutOnce for a value in the binary encoding, used by nodes replicating writes
+// to each other
+func (s *DynamoServer) ReplicatePut(data []byte, result *bool) error {
+	value, err	:= UnmarshalPutArgs(data)
+	if err != nil {
+		return err
+	}
+	return s.PutOnce(value, result)
+}
+
+// GetOnce with the result in the binary encoding, used by nodes reading from
+// each other
+func (s *DynamoServer) ReplicateGet(key string, reply *[]byte) error {
+	var result DynamoResult
+	if err := s.GetOnce(key, &result); err != nil {
+		return err
+	}
+	*reply	= MarshalDynamoResult(result)
+	return nil
+}
+
 func (s *DynamoServer) isCrashed() bool {
-	return !time.Now().After(s.crashUntil)
+	return time.Now().UnixNano() <= atomic.LoadInt64(&s.crashUntil)
 }
 
 /* Belows are functions that implement server boot up and initialization */
+//Creates a server that keeps its keys in memory and replicates every key to
+//every node of a cluster of the size set by SetClusterSize
 func NewDynamoServer(w int, r int, hostAddr string, hostPort string, id string) DynamoServer {
-	preferenceList := make([]DynamoNode, 0)
-	connectionsList	:= make([]*rpc.Client, 0)
+	n	:= GetClusterSize()
+	if n < 1 {
+		// no cluster size was set, every member replicates every key
+		n	= math.MaxInt32
+	}
+	return NewDynamoServerWithStorage(w, r, n, hostAddr, hostPort, id, NewMemoryStorage())
+}
+
+//Creates a server that replicates each key to n nodes and keeps its keys in store
+func NewDynamoServerWithStorage(w int, r int, n int, hostAddr string, hostPort string, id string, store Storage) DynamoServer {
 	selfNodeInfo := DynamoNode{
 		Address: hostAddr,
 		Port:    hostPort,
 	}
-	selfStore	:= make(map[string][]ObjectEntry)
-	gossiper	:= make(map[int]Gossiper)
 	return DynamoServer{
 		wValue:         w,
 		rValue:         r,
-		preferenceList: preferenceList,
+		nValue:         n,
+		views:          newViewHolder(n, newConnPool()),
 		selfNode:       selfNodeInfo,
 		nodeID:         id,
-		store:			 selfStore,
-		crashUntil:		 time.Time{},
-		gossiper:		 gossiper,
-		pListLoc:		 -1,
-		connections:	 connectionsList,
+		store:			 store,
+		locks:			 newKeyLocks(KEY_LOCK_STRIPES),
+		crdtLocks:		 newKeyLocks(KEY_LOCK_STRIPES),
+		stampLocks:		 newKeyLocks(KEY_LOCK_STRIPES),
+		crashUntil:		 0,
+		tombstones:		 NewTombstoneTracker(),
+		merkle:			 newMerkleCache(),
+		membership:		 NewMembership(selfNodeInfo, nil),
 	}
 }
 
@@ -264,5 +568,20 @@ func ServeDynamoServer(dynamoServer DynamoServer) error {
 	log.Println(DYNAMO_SERVER, "Successfully Listening to Target Port ", dynamoServer.selfNode.Address+":"+dynamoServer.selfNode.Port)
 	log.Println(DYNAMO_SERVER, "Serving Server Now")
 
-	return http.Serve(l, rpcServer)
+	go dynamoServer.runAntiEntropy()
+	go dynamoServer.runMembership()
+
+	// the REST gateway and the DynamoDB API share the port with the RPC
+	// interface. DynamoDB clients post to /, which takes every other path
+	mux := http.NewServeMux()
+	mux.Handle(rpc.DefaultRPCPath, rpcServer)
+	mux.Handle(GATEWAY_PATH, NewGateway(&dynamoServer))
+	mux.Handle("/", NewDynamoDBAPI(&dynamoServer))
+
+	// gRPC clients connect over HTTP/2 without TLS on the same port
+	httpServer := &http.Server{Handler: withGRPC(NewGRPCServer(&dynamoServer), mux)}
+	httpServer.Protocols = new(http.Protocols)
+	httpServer.Protocols.SetHTTP1(true)
+	httpServer.Protocols.SetUnencryptedHTTP2(true)
+	return httpServer.Serve(l)
 }
@@ -0,0 +1,135 @@
+package mydynamo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+//A storage engine holds the sibling list of every key stored on a node
+type Storage interface {
+	//Returns a copy of the sibling list stored at key, and whether key exists
+	Get(key string) ([]ObjectEntry, bool)
+	//Stores a new sibling list at key, superseding the list stored before
+	Put(key string, entries []ObjectEntry) error
+	//Removes key and every version stored at it
+	Delete(key string) error
+	//Returns every key in the store in sorted order
+	Keys() []string
+	//Flushes any buffered state and releases the engine's resources
+	Close() error
+}
+
+//Creates the storage engine named by engine. Engines that persist data keep
+//their files inside dataDir
+func NewStorage(engine string, dataDir string) (Storage, error) {
+	switch engine {
+	case STORAGE_MEMORY, "":
+		return NewMemoryStorage(), nil
+	case STORAGE_DISK:
+		return NewDiskStorage(dataDir)
+	case STORAGE_LSM:
+		return NewLSMStorage(dataDir)
+	default:
+		return nil, fmt.Errorf("unknown storage engine %q", engine)
+	}
+}
+
+//Storage engine that keeps every key in a map. Data is lost when the node exits
+type MemoryStorage struct {
+	entries map[string][]ObjectEntry
+	m       sync.RWMutex
+}
+
+//Creates an empty MemoryStorage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		entries: make(map[string][]ObjectEntry),
+	}
+}
+
+func (ms *MemoryStorage) Get(key string) ([]ObjectEntry, bool) {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+
+	entries, ok := ms.entries[key]
+	return copyEntries(entries), ok
+}
+
+func (ms *MemoryStorage) Put(key string, entries []ObjectEntry) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	ms.entries[key] = copyEntries(entries)
+	return nil
+}
+
+func (ms *MemoryStorage) Delete(key string) error {
+	ms.m.Lock()
+	defer ms.m.Unlock()
+
+	delete(ms.entries, key)
+	return nil
+}
+
+func (ms *MemoryStorage) Keys() []string {
+	ms.m.RLock()
+	defer ms.m.RUnlock()
+
+	return sortedKeys(ms.entries)
+}
+
+func (ms *MemoryStorage) Close() error {
+	return nil
+}
+
+//Copies a sibling list so callers can not modify the stored slice in place
+func copyEntries(entries []ObjectEntry) []ObjectEntry {
+	if entries == nil {
+		return nil
+	}
+	c := make([]ObjectEntry, len(entries))
+	copy(c, entries)
+	return c
+}
+
+//Returns the keys of a sibling map in sorted order
+func sortedKeys(entries map[string][]ObjectEntry) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Serializes the read-modify-write cycles a server runs on the same key. Keys
+//are hashed onto a fixed set of mutexes, so writes to unrelated keys rarely
+//wait on each other
+type keyLocks struct {
+	stripes []sync.Mutex
+}
+
+//Creates keyLocks with the given number of stripes
+func newKeyLocks(stripes int) *keyLocks {
+	return &keyLocks{
+		stripes: make([]sync.Mutex, stripes),
+	}
+}
+
+func (l *keyLocks) stripe(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &l.stripes[h.Sum32()%uint32(len(l.stripes))]
+}
+
+//Locks the stripe key falls in
+func (l *keyLocks) Lock(key string) {
+	l.stripe(key).Lock()
+}
+
+//Unlocks the stripe key falls in
+func (l *keyLocks) Unlock(key string) {
+	l.stripe(key).Unlock()
+}
@@ -0,0 +1,130 @@
+package mydynamo
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+//A tombstone written by this node, waiting for every replica to store it
+type tombstoneState struct {
+	clock   VectorClock
+	created time.Time
+	pending map[string]bool // addresses of replicas that have not stored it
+}
+
+//Keeps track of the tombstones a node coordinated so that they can be purged
+//once every replica has stored them and the grace period has passed.
+//The state is only kept in memory, so tombstones whose coordinator restarts
+//are never purged, which is safe but leaves them on disk
+type TombstoneTracker struct {
+	states map[string]*tombstoneState
+	m      sync.Mutex
+}
+
+func NewTombstoneTracker() *TombstoneTracker {
+	return &TombstoneTracker{
+		states: make(map[string]*tombstoneState),
+	}
+}
+
+//Starts tracking the tombstone written at key with the given clock. pending
+//holds the replicas that did not acknowledge the write
+func (t *TombstoneTracker) Track(key string, clock VectorClock, pending map[string]bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.states[key] = &tombstoneState{
+		clock:   clock,
+		created: time.Now(),
+		pending: pending,
+	}
+}
+
+//Records that the replica at address replica now stores the tombstone at key
+//with the given clock
+func (t *TombstoneTracker) Ack(key string, clock VectorClock, replica string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if state, ok := t.states[key]; ok && state.clock.Equals(clock) {
+		delete(state.pending, replica)
+	}
+}
+
+//Returns the clock of every tombstone that all replicas store and that is
+//older than grace, keyed by key
+func (t *TombstoneTracker) Ready(grace time.Duration) map[string]VectorClock {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	ready := make(map[string]VectorClock)
+	for key, state := range t.states {
+		if len(state.pending) == 0 && time.Since(state.created) >= grace {
+			ready[key] = state.clock
+		}
+	}
+	return ready
+}
+
+//Stops tracking the tombstone at key if it still has the given clock
+func (t *TombstoneTracker) Forget(key string, clock VectorClock) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if state, ok := t.states[key]; ok && state.clock.Equals(clock) {
+		delete(t.states, key)
+	}
+}
+
+//Returns the number of tombstones waiting to be purged
+func (t *TombstoneTracker) Len() int {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return len(t.states)
+}
+
+//Makes value causally descended from every tombstone stored at its key, if
+//the key holds nothing but tombstones
+func (s *DynamoServer) foldTombstones(value *PutArgs) {
+	storedEntries, ok := s.store.Get(value.Key)
+	if !ok {
+		return
+	}
+	clocks := make([]VectorClock, 0, len(storedEntries))
+	for _, entry := range storedEntries {
+		if !entry.Tombstone {
+			return
+		}
+		clocks = append(clocks, entry.Context.Clock)
+	}
+	value.Context.Clock.Combine(clocks)
+}
+
+//Purges every tombstone that all replicas have stored for at least the grace
+//period. Tombstones that could not be purged from every replica are retried
+//on the next round
+func (s *DynamoServer) collectTombstones() {
+	v := s.view()
+	for key, clock := range s.tombstones.Ready(GetTombstoneGrace()) {
+		args := DeleteArgs{Key: key, Context: NewContext(clock)}
+		purged := true
+		for _, i := range v.replicasFor(key) {
+			var result bool
+			var err error
+			if skipNode(v.pListLoc, i) {
+				err = s.PurgeTombstone(args, &result)
+			} else {
+				err = v.call(i, "MyDynamo.PurgeTombstone", args, &result)
+			}
+			if err != nil {
+				log.Println(DYNAMO_SERVER, "failed to purge tombstone for", key, err)
+				purged = false
+			}
+		}
+		if purged {
+			s.tombstones.Forget(key, clock)
+		}
+	}
+}
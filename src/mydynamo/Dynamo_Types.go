@@ -18,9 +18,15 @@ type DynamoNode struct {
 }
 
 //A single value, as well as the Context associated with it
+//Tombstone marks an entry written by Delete, which hides the key from Get
+//Timestamp is when the coordinator accepted the write, in unix nanoseconds
+//CRDT is set when Value holds an encoded CRDT of that type
 type ObjectEntry struct {
-	Context Context
-	Value   []byte
+	Context   Context
+	Value     []byte
+	Tombstone bool
+	Timestamp int64
+	CRDT      CRDTType
 }
 
 //Result of a Get operation, a list of ObjectEntry structs
@@ -29,10 +35,110 @@ type DynamoResult struct {
 }
 
 //Arguments required for a Put operation: the key, the context, and the value
+//Tombstone is set when the Put replicates a Delete, and Timestamp is set by
+//the coordinator. CRDT is set when Value holds an encoded CRDT of that type
 type PutArgs struct {
+	Key       string
+	Context   Context
+	Value     []byte
+	Tombstone bool
+	Timestamp int64
+	CRDT      CRDTType
+}
+
+//Arguments required for a Delete operation: the key and the context from a prior Get
+type DeleteArgs struct {
 	Key     string
 	Context Context
-	Value   []byte
+}
+
+//Arguments for Increment: the counter to change and by how much. Kind picks
+//CRDT_G_COUNTER or CRDT_PN_COUNTER for a new counter, and defaults to the latter
+type CounterArgs struct {
+	Key   string
+	Delta int64
+	Kind  CRDTType
+}
+
+//Arguments for AddToSet and RemoveFromSet
+type SetArgs struct {
+	Key     string
+	Element string
+}
+
+//Arguments required to hand a write to a node standing in for an unreachable replica
+type HintArgs struct {
+	Owner DynamoNode
+	Value []byte // the write, encoded by MarshalPutArgs
+}
+
+//Arguments for the Merkle tree RPCs: the node asking, the ranges whose roots it
+//is asking about, or the range and heap indices of the tree nodes it is asking
+//about
+type MerkleArgs struct {
+	Peer   DynamoNode
+	Ranges []uint32
+	Range  uint32
+	Nodes  []int
+}
+
+//Result of the Merkle tree RPCs: the hashes of the requested roots or tree
+//nodes, or the versions of every key under the requested leaves, encoded by
+//MarshalPutArgsList
+type MerkleReply struct {
+	Hashes  [][]byte
+	Entries []byte
+}
+
+//State of a member as seen by a node's failure detector
+type MemberStatus int
+
+const (
+	MEMBER_ALIVE MemberStatus = iota
+	MEMBER_SUSPECT
+	MEMBER_DEAD
+)
+
+func (status MemberStatus) String() string {
+	switch status {
+	case MEMBER_ALIVE:
+		return "alive"
+	case MEMBER_SUSPECT:
+		return "suspect"
+	default:
+		return "dead"
+	}
+}
+
+//A node in a membership view. Incarnation grows every time the node recovers
+//from a crash and Heartbeat grows every membership round within an incarnation
+type Member struct {
+	Node        DynamoNode
+	Incarnation int
+	Heartbeat   uint64
+	Status      MemberStatus
+}
+
+//A membership view exchanged between two nodes
+type MembershipArgs struct {
+	From    DynamoNode
+	Members []Member
+}
+
+//Arguments for TransferKeys: the node asking for the keys it replicates, and
+//the members of the cluster it replicates them in
+type TransferArgs struct {
+	Node    DynamoNode
+	Members []DynamoNode
+}
+
+//What a client needs to route requests: the members of the cluster, the status
+//the answering node's failure detector gives each of them, and the number of
+//replicas of every key
+type ClusterInfo struct {
+	Members []DynamoNode
+	Status  []MemberStatus // Status[i] is the status of Members[i]
+	NValue  int
 }
 
 type Gossiper struct {
@@ -1,12 +1,17 @@
 package mydynamo
 
 import (
+	"errors"
 	"fmt"
-	"sync"
 	"net/rpc"
+	"sort"
+	"strings"
+	"time"
 )
 
 var numServers	int
+var tombstoneGrace	time.Duration	= time.Duration(DEFAULT_TOMBSTONE_GRACE) * time.Second
+var antiEntropyInterval	time.Duration	= time.Duration(DEFAULT_ANTI_ENTROPY_INTERVAL) * time.Second
 //Removes an element at the specified index from a list of ObjectEntry structs
 func remove(list []ObjectEntry, index int) []ObjectEntry {
 	return append(list[:index], list[index+1:]...)
@@ -58,35 +63,114 @@ func NewObjectEntry(context Context, value []byte) ObjectEntry {
 	}
 }
 
+//Creates the ObjectEntry stored for a PutArgs, carrying over the tombstone flag,
+//timestamp and CRDT type
+func entryFromPutArgs(value PutArgs) ObjectEntry {
+	entry	:= NewObjectEntry(value.Context, value.Value)
+	entry.Tombstone	= value.Tombstone
+	entry.Timestamp	= value.Timestamp
+	entry.CRDT	= value.CRDT
+	return entry
+}
+
+//Creates the PutArgs that writes entry to key, the inverse of entryFromPutArgs
+func putArgsFromEntry(key string, entry ObjectEntry) PutArgs {
+	value	:= NewPutArgs(key, entry.Context, entry.Value)
+	value.Tombstone	= entry.Tombstone
+	value.Timestamp	= entry.Timestamp
+	value.CRDT	= entry.CRDT
+	return value
+}
+
+//Creates a new DeleteArgs struct with the specified members
+func NewDeleteArgs(key string, context Context) DeleteArgs {
+	return DeleteArgs{
+		Key:     key,
+		Context: context,
+	}
+}
+
+//Creates a new HintArgs struct for a write meant for owner
+func NewHintArgs(owner DynamoNode, value PutArgs) HintArgs {
+	return HintArgs{
+		Owner: owner,
+		Value: MarshalPutArgs(value),
+	}
+}
+
 func NewGossiper() Gossiper {
 	g	:= make(map[string][]ObjectEntry)
-	var m sync.Mutex
 	return Gossiper{
 		gossipMap:	g,
-		m:				m,
 	}
 }
 
+//Checks that the quorum sizes can be satisfied by N replicas in a cluster of
+//clusterSize nodes. Returns an error describing the first violated constraint
+func ValidateQuorum(r, w, n, clusterSize int) error {
+	if n < 1 || n > clusterSize {
+		return fmt.Errorf("n_value %v must be between 1 and cluster_size %v", n, clusterSize)
+	}
+	if r < 1 || r > n {
+		return fmt.Errorf("r_value %v must be between 1 and n_value %v", r, n)
+	}
+	if w < 1 || w > n {
+		return fmt.Errorf("w_value %v must be between 1 and n_value %v", w, n)
+	}
+	return nil
+}
+
+//Returns true if every read quorum overlaps every write quorum
+func IsStrictQuorum(r, w, n int) bool {
+	return r+w > n
+}
+
 func SetClusterSize(size int) {
 	numServers	= size
 }
 func GetClusterSize() int {
 	return numServers
 }
+
+//Sets how long a tombstone is kept after every replica has stored it
+func SetTombstoneGrace(grace time.Duration) {
+	tombstoneGrace	= grace
+}
+func GetTombstoneGrace() time.Duration {
+	return tombstoneGrace
+}
+
+//Sets how often nodes run anti-entropy in the background. Zero disables it
+func SetAntiEntropyInterval(interval time.Duration) {
+	antiEntropyInterval	= interval
+}
+
+//Formats clock as [(id 0: ver 2),(id 1: ver 1)], with the elements sorted by
+//node id so equal clocks print the same
 func PrintFormatVectorClock(clock VectorClock) string {
-	format	:= "["
-	for i, ver	:= range clock.Elements {
-		format	+= fmt.Sprintf("(id %v: ver %v),", i, ver)
+	ids	:= make([]string, 0, len(clock.Elements))
+	for id	:= range clock.Elements {
+		ids	= append(ids, id)
+	}
+	sort.Strings(ids)
+	parts	:= make([]string, 0, len(ids)+1)
+	for _, id	:= range ids {
+		parts	= append(parts, fmt.Sprintf("(id %v: ver %v)", id, clock.Elements[id]))
+	}
+	if clock.Dot.Counter > 0 {
+		parts	= append(parts, fmt.Sprintf("(dot %v: %v)", clock.Dot.Node, clock.Dot.Counter))
 	}
-	format	= format[:len(format)-1] + "]"
-	return format
+	return "[" + strings.Join(parts, ",") + "]"
 }
 
-func (g Gossiper) Append(key string, newEntry ObjectEntry) {
+func (g *Gossiper) Append(key string, newEntry ObjectEntry) {
 	g.m.Lock()
 
 	if storedEntries, ok := g.gossipMap[key]; !ok {
 		g.gossipMap[key]	= []ObjectEntry{newEntry}
+	} else if merged, ok, err := mergeCRDTInto(storedEntries, newEntry); err == nil && ok {
+		// queue one merged state instead of every update
+		g.gossipMap[key]	= merged
 	} else {
 		added	:= false
 		concurrent	:= false
@@ -102,40 +186,43 @@ func (g Gossiper) Append(key string, newEntry ObjectEntry) {
 	g.m.Unlock()
 }
 
-func (g Gossiper) ConsumeEntry(key string)  {
+//Removes the first entry queued at key
+func (g *Gossiper) ConsumeEntry(key string) {
 	g.m.Lock()
 
-//	entry	= g.gossipMap[0]
-//	g.gossipMap	= remove(g.gossipMap, 0)
-	g.gossipMap[key]	= remove(g.gossipMap[key], 0)
+	if len(g.gossipMap[key]) > 0 {
+		g.gossipMap[key]	= remove(g.gossipMap[key], 0)
+	}
 	if len(g.gossipMap[key]) == 0 {
 		delete(g.gossipMap, key)
 	}
 
 	g.m.Unlock()
-//	return entry
-}
-
-/*
-	Opens RPC connections to the other nodes inside of this node's preferenceLIst
-*/
-func (s DynamoServer) connectToPreferenceNodes() []*rpc.Client {
-	conns	:= make([]*rpc.Client, 0)
-	for i, node	:= range s.preferenceList {
-		if !skipNode(s.pListLoc, i) {
-			conn, err	:= rpc.DialHTTP("tcp", node.Address + ":" + node.Port)
-			if err != nil {
-				fmt.Println(err)
-			} else {
-				conns	= append(conns, conn)
-			}
+}
+
+//Removes the entry with the given clock once it has been delivered. Entries are
+//matched by clock since Append may reorder the list while the entry is in flight
+func (g *Gossiper) ConsumeVersion(key string, clock VectorClock) {
+	g.m.Lock()
+
+	for i, entry := range g.gossipMap[key] {
+		if entry.Context.Clock.Equals(clock) {
+			g.gossipMap[key]	= remove(g.gossipMap[key], i)
+			break
 		}
 	}
-	return conns
+	if len(g.gossipMap[key]) == 0 {
+		delete(g.gossipMap, key)
+	}
+
+	g.m.Unlock()
 }
 
-func closeConnections(conns []rpc.Client) {
+func closeConnections(conns []*rpc.Client) {
 	for _, conn := range conns {
+		if conn == nil {
+			continue
+		}
 		if err := conn.Close(); err != nil {
 			fmt.Println(err)
 		}
@@ -147,15 +234,13 @@ func (s DynamoNode) Equals(otherNode DynamoNode) bool {
 				s.Port	== otherNode.Port
 }
 
-func (s *DynamoServer) newGossiperMap() {
-	for idx, _ := range s.preferenceList {
-		if !skipNode(s.pListLoc, idx) {
-			s.gossiper[idx]	= NewGossiper()
+func addToEntries(entries *[]ObjectEntry, newEntry ObjectEntry, add, concurrent *bool) error {
+	// the version is already stored, e.g. when anti-entropy sends it back
+	for _, entry := range *entries {
+		if newEntry.Context.Clock.Equals(entry.Context.Clock) {
+			return nil
 		}
 	}
-}
-
-func addToEntries(entries *[]ObjectEntry, newEntry ObjectEntry, add, concurrent *bool) error {
 	idx	:= 0
 	newEntries := *entries
 	for _, entry := range *entries {
@@ -183,13 +268,55 @@ func addToEntries(entries *[]ObjectEntry, newEntry ObjectEntry, add, concurrent
 	return nil
 }
 
+// Writes entries to the store and updates the Merkle leaf of key
+func (s *DynamoServer) putEntries(key string, entries []ObjectEntry) error {
+	defer s.updateMerkle(key)
+	return s.store.Put(key, entries)
+}
+
+// Deletes key from the store and updates the Merkle leaf of key
+func (s *DynamoServer) deleteKey(key string) error {
+	defer s.updateMerkle(key)
+	return s.store.Delete(key)
+}
+
+// Hand a client request to the first reachable node in replicas, used when
+// this node is not responsible for the requested key
+func (s *DynamoServer) forward(v *clusterView, method string, replicas []int, args interface{}, reply interface{}) error {
+	for _, i := range replicas {
+		if s.isDead(v, i) {
+			continue
+		}
+		err	:= v.call(i, method, args, reply)
+		if err == nil {
+			return nil
+		}
+		if isServerError(err) && !errors.Is(decodeError(err), ErrNodeOffline) {
+			// the replica handled the request and rejected it
+			return err
+		}
+	}
+	return fmt.Errorf("server %v could not reach any replica", s.nodeID)
+}
+
 // Determine whether the current node in a servers's preferenceList should be skipped
 func skipNode(selfNode, otherNode int) bool {
 	return otherNode == selfNode || selfNode == -1
 }
 
-func (g Gossiper) GetGossipList(key string) []ObjectEntry {
-	return g.gossipMap[key]
+func (g *Gossiper) GetGossipList(key string) []ObjectEntry {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	return copyEntries(g.gossipMap[key])
+}
+
+//Returns every key that has entries waiting to be gossiped
+func (g *Gossiper) Keys() []string {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	return sortedKeys(g.gossipMap)
 }
 
 func RemoveResultAncestors(result *DynamoResult) {
@@ -214,12 +341,48 @@ func RemoveResultAncestors(result *DynamoResult) {
 	result.EntryList	= entryList
 }
 
-func (s DynamoServer) printGossiper() {
+//Removes the tombstones left by Delete from a result, so deleted keys read as missing
+func RemoveTombstones(result *DynamoResult) {
+	entryList	:= make([]ObjectEntry, 0, len(result.EntryList))
+	for _, entry := range result.EntryList {
+		if !entry.Tombstone {
+			entryList	= append(entryList, entry)
+		}
+	}
+	result.EntryList	= entryList
+}
+
+//Merges sibling lists into one, keeping a single copy of every entry that is
+//not causally older than another entry in any of the lists
+func MergeSiblings(lists ...[]ObjectEntry) []ObjectEntry {
+	merged	:= make([]ObjectEntry, 0)
+	for _, list := range lists {
+		for _, entry := range list {
+			obsolete	:= false
+			kept	:= make([]ObjectEntry, 0, len(merged)+1)
+			for _, other := range merged {
+				if entry.Context.Clock.LessThan(other.Context.Clock) || entry.Context.Clock.Equals(other.Context.Clock) {
+					obsolete	= true
+				}
+				if !other.Context.Clock.LessThan(entry.Context.Clock) {
+					kept	= append(kept, other)
+				}
+			}
+			if !obsolete {
+				kept	= append(kept, entry)
+			}
+			merged	= kept
+		}
+	}
+	return merged
+}
+
+func (s *DynamoServer) printGossiper() {
 	fmt.Println("----------START GOSSIPER------------")
 
-	for id, gossiper := range s.gossiper {
+	for id, gossiper := range s.view().gossiper {
 		fmt.Printf("node %v: ", id)
-		fmt.Println(gossiper.gossipMap)
+		fmt.Println(gossiper.Keys())
 	}
 
 	fmt.Println("-----------END GOSSIPER-------------")
@@ -1,9 +1,20 @@
 package mydynamo
 
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
 
 type VectorClock struct {
 	//todo
 	Elements	map[string]int
+	Updated		map[string]int64	// unix nanoseconds each element was last incremented
+	Pruned		[]string		// sorted markers of the truncations in this clock's history
+	Dot		Dot			// the write this version is, only set with dotted version vectors
 }
 
 type Element struct {
@@ -46,6 +57,14 @@ func (s VectorClock) LessThan(otherClock VectorClock) bool {
 			return false
 		}
 	}*/
+	// the elements s dropped are only covered by a clock that descends from
+	// the truncation that dropped them
+	if !s.prunedWithin(otherClock) {
+		return false
+	}
+	if s.hasDot() || otherClock.hasDot() {
+		return s.dottedLessThan(otherClock)
+	}
 	if len(s.Elements) != 0 {
 		if len(otherClock.Elements) == 0 {
 			return false
@@ -62,6 +81,13 @@ func (s VectorClock) LessThan(otherClock VectorClock) bool {
 
 //Returns true if neither VectorClock is causally descended from the other
 func (s VectorClock) Concurrent(otherClock VectorClock) bool {
+	if len(s.Pruned) > 0 || len(otherClock.Pruned) > 0 {
+		// truncated clocks are ordered through their markers too
+		return !s.Equals(otherClock) && !s.LessThan(otherClock) && !otherClock.LessThan(s)
+	}
+	if s.hasDot() || otherClock.hasDot() {
+		return s.dottedConcurrent(otherClock)
+	}
 
 	// Concurrent if a_i < b_i and a_j > b_j for some i,j
 	for i, a_i := range s.Elements {
@@ -98,8 +124,16 @@ func (s VectorClock) Concurrent(otherClock VectorClock) bool {
 
 //Increments this VectorClock at the element associated with nodeId
 func (s *VectorClock) Increment(nodeId string) {
+	if s.Elements == nil {
+		s.Elements	= make(map[string]int)
+	}
+	if s.Updated == nil {
+		s.Updated	= make(map[string]int64)
+	}
 	s.Elements[nodeId]++
+	s.Updated[nodeId]	= time.Now().UnixNano()
 	//s.Elements[idMap[nodeId]].Version++
+	s.truncate(int(atomic.LoadInt32(&maxClockSize)), nodeId)
 }
 
 //Changes this VectorClock to be causally descended from all VectorClocks in clocks
@@ -124,6 +158,9 @@ func (s *VectorClock) Combine(clocks []VectorClock) {
 	copy(newClock.Elements, elements)*/
 	elements	:= newClock.Elements
 
+	newClock.Updated	= make(map[string]int64)
+	pruned	:= make(map[string]bool)
+
 	clocks	= append(clocks, *s)
 	for _, clock := range clocks {
 		for id, ver := range clock.Elements {
@@ -131,15 +168,122 @@ func (s *VectorClock) Combine(clocks []VectorClock) {
 				elements[id]	= ver
 			}
 		}
+		// a dot joins the rest of the writes
+		if clock.hasDot() && elements[clock.Dot.Node] < clock.Dot.Counter {
+			elements[clock.Dot.Node]	= clock.Dot.Counter
+		}
+		for id, updated := range clock.Updated {
+			if updated > newClock.Updated[id] {
+				newClock.Updated[id]	= updated
+			}
+		}
+		for _, marker := range clock.Pruned {
+			pruned[marker]	= true
+		}
+	}
+	for marker := range pruned {
+		newClock.Pruned	= append(newClock.Pruned, marker)
 	}
+	sort.Strings(newClock.Pruned)
+	newClock.truncate(int(atomic.LoadInt32(&maxClockSize)), "")
 	*s	= newClock
 }
 
+//Maximum number of elements a VectorClock keeps, 0 for no limit
+var maxClockSize int32	= int32(DEFAULT_MAX_CLOCK_SIZE)
+
+//Sets the number of elements after which Increment and Combine truncate a
+//VectorClock, dropping the elements updated longest ago. 0 never truncates
+func SetMaxClockSize(size int) {
+	atomic.StoreInt32(&maxClockSize, int32(size))
+}
+
+//Drops the least recently updated elements other than keep until at most max
+//remain. The clock then can no longer show that it descends from the versions
+//that held the dropped elements, so it records a marker naming the
+//truncation, and only clocks carrying that marker can descend from it. This
+//may turn an ancestor into a sibling, but never a newer version into an ancestor
+func (s *VectorClock) truncate(max int, keep string) {
+	if max <= 0 || len(s.Elements) <= max {
+		return
+	}
+	// the marker is a digest of the clock, so replicas that truncate the
+	// same clock agree on it
+	digest	:= sha1.New()
+	ids	:= make([]string, 0, len(s.Elements))
+	for id := range s.Elements {
+		ids	= append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(digest, "%v:%v,", id, s.Elements[id])
+	}
+	for _, marker := range s.Pruned {
+		fmt.Fprintf(digest, "%v;", marker)
+	}
+
+	// oldest first, ties broken by id so every replica drops the same ones
+	sort.SliceStable(ids, func(i, j int) bool {
+		return s.Updated[ids[i]] < s.Updated[ids[j]]
+	})
+	elements	:= make(map[string]int, max)
+	updated	:= make(map[string]int64, max)
+	if _, ok := s.Elements[keep]; ok {
+		elements[keep]	= s.Elements[keep]
+		updated[keep]	= s.Updated[keep]
+	}
+	for i := len(ids) - 1; i >= 0 && len(elements) < max; i-- {
+		elements[ids[i]]	= s.Elements[ids[i]]
+		if t, ok := s.Updated[ids[i]]; ok {
+			updated[ids[i]]	= t
+		}
+	}
+
+	// a descendant of this truncation also descends from the ones before
+	// it, so the older markers can be replaced once there are too many
+	marker	:= hex.EncodeToString(digest.Sum(nil))[:16]
+	if len(s.Pruned) >= max {
+		s.Pruned	= []string{marker}
+	} else {
+		s.Pruned	= insertMarker(s.Pruned, marker)
+	}
+	s.Elements	= elements
+	s.Updated	= updated
+}
+
+//Adds marker to the sorted markers, unless it is already there
+func insertMarker(markers []string, marker string) []string {
+	i	:= sort.SearchStrings(markers, marker)
+	if i < len(markers) && markers[i] == marker {
+		return markers
+	}
+	inserted	:= make([]string, 0, len(markers)+1)
+	inserted	= append(inserted, markers[:i]...)
+	inserted	= append(inserted, marker)
+	return append(inserted, markers[i:]...)
+}
+
+//Returns true if other carries every truncation marker of s
+func (s VectorClock) prunedWithin(other VectorClock) bool {
+	for _, marker := range s.Pruned {
+		i	:= sort.SearchStrings(other.Pruned, marker)
+		if i == len(other.Pruned) || other.Pruned[i] != marker {
+			return false
+		}
+	}
+	return true
+}
+
 //Tests if two VectorClocks are equal
 func (s *VectorClock) Equals(otherClock VectorClock) bool {
-	if len(s.Elements) != len(otherClock.Elements) {
+	if len(s.Elements) != len(otherClock.Elements) || len(s.Pruned) != len(otherClock.Pruned) || s.Dot != otherClock.Dot {
 		return false
 	}
+	for i, marker := range s.Pruned {
+		if marker != otherClock.Pruned[i] {
+			return false
+		}
+	}
 /*
 	for i, elem := range s.Elements {
 		if !elem.equals(otherClock.Elements[i]) {
@@ -0,0 +1,131 @@
+package mydynamo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+//The cluster as one node sees it: the members, the ring built from them, and a
+//Gossiper for every other member. A view is never modified once it is
+//published, a membership change builds a new one and swaps it in, so RPC
+//handlers load the view once and work on a consistent snapshot without locking
+type clusterView struct {
+	preferenceList []DynamoNode        // Ordered list of the nodes in the cluster
+	pListLoc       int                 // location of this node inside preferenceList
+	ring           *Ring               // consistent-hashing ring built from preferenceList
+	pool           *connPool           // connections to the members, shared by every view
+	gossiper       map[int]*Gossiper   // map node index from preferenceList to its Gossiper
+	nValue         int                 // Number of nodes each key is replicated to
+}
+
+//Holds the published view of a server, shared by every copy of the server
+type viewHolder struct {
+	current atomic.Value // *clusterView
+	m       sync.Mutex   // serializes membership changes
+}
+
+func newViewHolder(n int, pool *connPool) *viewHolder {
+	h := &viewHolder{}
+	h.current.Store(&clusterView{
+		preferenceList: make([]DynamoNode, 0),
+		pListLoc:       -1,
+		pool:           pool,
+		gossiper:       make(map[int]*Gossiper),
+		nValue:         n,
+	})
+	return h
+}
+
+//Returns the view this node currently works with
+func (s *DynamoServer) view() *clusterView {
+	return s.views.current.Load().(*clusterView)
+}
+
+// Returns the preferenceList indices of the N nodes that replicate key
+func (v *clusterView) replicasFor(key string) []int {
+	if v.ring == nil {
+		return []int{}
+	}
+	return v.ring.PreferenceIndices(key, v.nValue)
+}
+
+// Returns the preferenceList indices of the nodes past the top N for key, in the
+// order they stand in for replicas that can not be reached
+func (v *clusterView) fallbacksFor(key string) []int {
+	if v.ring == nil {
+		return []int{}
+	}
+	return v.ring.PreferenceIndices(key, len(v.preferenceList))[len(v.replicasFor(key)):]
+}
+
+// Returns the preferenceList index of node, or -1 if it is not a member
+func (v *clusterView) indexOf(node DynamoNode) int {
+	for i, other := range v.preferenceList {
+		if other.Equals(node) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Calls method on the node at preferenceList index i through the connection
+// pool, giving up after requestTimeout
+func (v *clusterView) call(i int, method string, args interface{}, reply interface{}) error {
+	if skipNode(v.pListLoc, i) || i < 0 || i >= len(v.preferenceList) {
+		return fmt.Errorf("no connection to node %v", i)
+	}
+	return v.pool.call(v.preferenceList[i], method, args, reply)
+}
+
+// Writes value to the node at preferenceList index i with PutOnce, sent in the
+// binary encoding
+func (v *clusterView) putOnce(i int, value PutArgs, result *bool) error {
+	return v.call(i, "MyDynamo.ReplicatePut", MarshalPutArgs(value), result)
+}
+
+//Builds and publishes a view for a new set of members. Pending gossip for nodes
+//that stay is carried over to the new view, and the connections to nodes that
+//left are closed
+func (s *DynamoServer) setMembers(nodes []DynamoNode) {
+	s.views.m.Lock()
+	defer s.views.m.Unlock()
+
+	old := s.view()
+	gossipers := make(map[string]*Gossiper)
+	for i, node := range old.preferenceList {
+		if g, ok := old.gossiper[i]; ok && !skipNode(old.pListLoc, i) {
+			gossipers[memberKey(node)] = g
+		}
+	}
+
+	v := &clusterView{
+		preferenceList: append([]DynamoNode{}, nodes...),
+		pListLoc:       -1,
+		ring:           NewRing(nodes, VIRTUAL_NODES),
+		pool:           old.pool,
+		gossiper:       make(map[int]*Gossiper),
+		nValue:         old.nValue,
+	}
+	for i, node := range nodes {
+		if node.Equals(s.selfNode) {
+			v.pListLoc = i
+			break
+		}
+	}
+	for i, node := range nodes {
+		if skipNode(v.pListLoc, i) {
+			continue
+		}
+		if g, ok := gossipers[memberKey(node)]; ok {
+			v.gossiper[i] = g
+		} else {
+			g := NewGossiper()
+			v.gossiper[i] = &g
+		}
+	}
+	s.membership.SetNodes(nodes)
+	s.views.current.Store(v)
+	s.merkle.Invalidate()
+	v.pool.Retain(nodes)
+}
@@ -1,18 +1,55 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"mydynamo"
-	"strconv"
+	"os"
+	"time"
 )
 
-func main() {
-	//Spin up a client for some testing
-	//Expects server to be started, starting at port 8080
-	serverPort := 8080
+const usage = `usage: DynamoClient [-node host:port] [-timeout duration] <command> [arguments]
+
+commands:
+  get <key>                          print the value of key, or all its siblings
+  put [-context token] <key> <value> store value under key
+  delete [-context token] <key>      delete key
+  crash <seconds>                    take the node offline for some seconds
+  gossip                             make the node push its pending writes
+  status                             print the node's view of the cluster
+  repl                               read commands from stdin, remembering the
+                                     last context read for every key
+`
 
-	//this client connects to the server on port 8080
-	clientInstance := mydynamo.NewDynamoRPCClient("localhost:" + strconv.Itoa(serverPort+0))
-	clientInstance.RpcConnect()
+func main() {
+	flags := flag.NewFlagSet("DynamoClient", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	node := flags.String("node", "localhost:8080", "address of the node to connect to")
+	timeout := flags.Duration("timeout", 5*time.Second, "deadline of every request")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(mydynamo.EX_USAGE)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(mydynamo.EX_USAGE)
+	}
 
-	//You can use the space below to write some operations that you want your client to do
+	s := &mydynamo.ClientSession{Client: mydynamo.NewDynamoRPCClient(*node), Timeout: *timeout, Out: os.Stdout}
+	defer s.Client.CleanConn()
+	var err error
+	if flags.Arg(0) == "repl" && flags.NArg() == 1 {
+		s.Contexts = make(map[string]mydynamo.Context)
+		err = s.Repl(os.Stdin)
+	} else {
+		err = s.Run(flags.Args())
+	}
+	if errors.Is(err, mydynamo.ErrUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(mydynamo.EX_USAGE)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
-	"github.com/go-ini/ini"
 	"log"
 	"mydynamo"
 	"net/rpc"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -23,30 +25,22 @@ func main() {
 
 	// Load the configuration file
 	configFilePath := os.Args[mydynamo.CONFIG_FILE_INDEX]
-	configContent, err := ini.Load(configFilePath)
+	config, err := mydynamo.LoadConfig(configFilePath)
 	if err != nil {
 		log.Println(err)
 		log.Println("Failed to load config file:", configFilePath)
 		log.Println(mydynamo.USAGE_STRING)
 		os.Exit(mydynamo.EX_CONFIG)
 	}
-
-	// Load the detailed configuration from section "mydynamo"
-	dynamoConfigs := configContent.Section(mydynamo.MYDYNAMO)
-
-	serverPort, err := dynamoConfigs.Key(mydynamo.SERVER_PORT).Int()
-	r_value, err := dynamoConfigs.Key(mydynamo.R_VALUE).Int()
-	w_value, err := dynamoConfigs.Key(mydynamo.W_VALUE).Int()
-	cluster_size, err := dynamoConfigs.Key(mydynamo.CLUSTER_SIZE).Int()
-	if err != nil {
-		log.Println(err)
-		log.Println("Failed to load config file, field is wrong type:", configFilePath)
-		log.Println(mydynamo.USAGE_STRING)
+	if config.StartingPort == 0 {
+		log.Println("Missing", mydynamo.SERVER_PORT, "in config file:", configFilePath)
 		os.Exit(mydynamo.EX_CONFIG)
 	}
+	if !mydynamo.IsStrictQuorum(config.RValue, config.WValue, config.NValue) {
+		log.Printf("r_value + w_value <= n_value (%v + %v <= %v), reads may not see the latest write\n", config.RValue, config.WValue, config.NValue)
+	}
 	fmt.Println("Done loading configurations")
-
-	mydynamo.SetClusterSize(cluster_size)
+	config.Apply()
 
 	//keep a list of servers so we can communicate with them
 	serverList := make([]mydynamo.DynamoServer, 0)
@@ -56,47 +50,160 @@ func main() {
 
 	//Use a waitgroup to ensure that we don't exit this goroutine until all servers have exited
 	wg := new(sync.WaitGroup)
-	wg.Add(cluster_size)
-	for idx := 0; idx < cluster_size; idx++ {
+
+	//With node_processes every node runs in its own DynamoNode process instead
+	//of in this one, and finds the other nodes through its seeds
+	var processes *supervisor
+	if config.NodeProcesses {
+		processes = newSupervisor(config.NodeBinary, configFilePath, config.NodeRestartDelay, wg)
+	}
+
+	//Starts the server for node idx and returns its address
+	startNode := func(idx int, seeds []mydynamo.DynamoNode) mydynamo.DynamoNode {
+		node := mydynamo.DynamoNode{
+			Address: "localhost",
+			Port:    strconv.Itoa(config.StartingPort + idx),
+		}
+		if processes != nil {
+			if err := processes.start(strconv.Itoa(idx), node, seeds); err != nil {
+				log.Println(err)
+				log.Println("Failed to start the process of node", idx)
+				os.Exit(mydynamo.EX_CONFIG)
+			}
+			return node
+		}
+
+		//Open this node's storage, each node keeps its files in its own directory
+		store, err := mydynamo.NewStorage(config.StorageEngine, filepath.Join(config.DataDir, "node"+strconv.Itoa(idx)))
+		if err != nil {
+			log.Println(err)
+			log.Println("Failed to open storage for node", idx)
+			os.Exit(mydynamo.EX_CONFIG)
+		}
 
 		//Create a server instance
-		serverInstance := mydynamo.NewDynamoServer(w_value, r_value, "localhost", strconv.Itoa(serverPort+idx), strconv.Itoa(idx))
+		serverInstance := mydynamo.NewDynamoServerWithStorage(config.WValue, config.RValue, config.NValue, node.Address, node.Port, strconv.Itoa(idx), store)
 		serverList = append(serverList, serverInstance)
 
 		//Create an anonymous function in a goroutine that starts the server
+		wg.Add(1)
 		go func() {
 			log.Fatal(mydynamo.ServeDynamoServer(serverInstance))
 			wg.Done()
 		}()
-		nodeInfo := mydynamo.DynamoNode{
+		return node
+	}
+	for idx := 0; idx < config.ClusterSize; idx++ {
+		dynamoNodeList = append(dynamoNodeList, mydynamo.DynamoNode{
 			Address: "localhost",
-			Port:    strconv.Itoa(serverPort + idx),
-		}
-		dynamoNodeList = append(dynamoNodeList, nodeInfo)
+			Port:    strconv.Itoa(config.StartingPort + idx),
+		})
+	}
+	for idx := range dynamoNodeList {
+		startNode(idx, dynamoNodeList)
 	}
 
-	//Create a duplicate of dynamoNodeList that we can rotate
-	//so that each node has a distinct preference list
-	nodePreferenceList := dynamoNodeList
+	//Node processes agree on the members on their own. Other nodes are sent
+	//the preference list
+	if processes == nil {
+		//Create a duplicate of dynamoNodeList that we can rotate so that each node
+		//finds itself at the front of its list. Which nodes actually replicate a key
+		//is decided by each server's consistent-hashing ring
+		nodePreferenceList := dynamoNodeList
 
-	time.Sleep(2 * time.Second)
+		time.Sleep(2 * time.Second)
 
-	//Send the preference list to all servers
-	for _, info := range dynamoNodeList {
-		var empty mydynamo.Empty
-		c, _ := rpc.DialHTTP("tcp", info.Address+":"+info.Port)
-		if err != nil {
-			log.Println("Failed to send preference list")
-		} else {
-			err2 := c.Call("MyDynamo.SendPreferenceList", nodePreferenceList, &empty)
-			if err2 != nil {
+		//Send the preference list to all servers
+		for _, info := range dynamoNodeList {
+			var empty mydynamo.Empty
+			c, err := rpc.DialHTTP("tcp", info.Address+":"+info.Port)
+			if err != nil {
 				log.Println("Failed to send preference list")
+			} else {
+				err2 := c.Call("MyDynamo.SendPreferenceList", nodePreferenceList, &empty)
+				if err2 != nil {
+					log.Println("Failed to send preference list")
+				}
 			}
+			nodePreferenceList = mydynamo.RotateServerList(nodePreferenceList)
 		}
-		nodePreferenceList = mydynamo.RotateServerList(nodePreferenceList)
 	}
 	/*---------------------------------------------*/
 
+	//Read membership commands from stdin: "join" starts a new node and adds it
+	//to the cluster, "leave <port>" hands off the data of a node and removes it,
+	//and "kill <port>" kills the process of a node
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			switch {
+			case fields[0] == "join" && len(fields) == 1:
+				node := startNode(len(dynamoNodeList), dynamoNodeList)
+				dynamoNodeList = append(dynamoNodeList, node)
+				if joinNode(node, dynamoNodeList[0], processes != nil) {
+					fmt.Println("Node", node.Port, "joined")
+				} else {
+					fmt.Println("Node", node.Port, "failed to join")
+				}
+			case fields[0] == "leave" && len(fields) == 2:
+				client := mydynamo.NewDynamoRPCClient("localhost:" + fields[1])
+				client.RpcConnect()
+				if client.Leave() {
+					fmt.Println("Node", fields[1], "left")
+					if processes != nil {
+						processes.stop(fields[1])
+					}
+				} else {
+					fmt.Println("Node", fields[1], "failed to leave")
+				}
+				client.CleanConn()
+			case fields[0] == "kill" && len(fields) == 2 && processes != nil:
+				if err := processes.kill(fields[1]); err != nil {
+					fmt.Println("Failed to kill node", fields[1], err)
+				} else {
+					fmt.Println("Node", fields[1], "killed")
+				}
+			default:
+				if processes != nil {
+					fmt.Println("usage: join | leave <port> | kill <port>")
+				} else {
+					fmt.Println("usage: join | leave <port>")
+				}
+			}
+		}
+	}()
+
 	//wait for all servers to finish
 	wg.Wait()
 }
+
+//Makes a newly started node join the cluster seed belongs to. A node process
+//joins through its seeds on its own, so for one this only waits until it is a
+//member
+func joinNode(node mydynamo.DynamoNode, seed mydynamo.DynamoNode, process bool) bool {
+	client := mydynamo.NewDynamoRPCClient(node.Address + ":" + node.Port)
+	defer client.CleanConn()
+	if !process {
+		time.Sleep(time.Second)
+		client.RpcConnect()
+		return client.Join(seed)
+	}
+	deadline := time.Now().Add(2 * time.Duration(mydynamo.BOOTSTRAP_TIMEOUT) * time.Millisecond)
+	for time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+		if client.RpcConnect() != nil {
+			continue
+		}
+		for _, info := range client.Members() {
+			if info.Equals(node) {
+				return true
+			}
+		}
+		client.CleanConn()
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mydynamo"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Runs every node in its own DynamoNode process and restarts the processes that
+//exit, unless they were stopped through the supervisor
+type supervisor struct {
+	binary       string
+	configPath   string
+	restartDelay time.Duration
+	wg           *sync.WaitGroup         // done once per node that will not run again
+	nodes        map[string]*nodeProcess // keyed by port
+	m            sync.Mutex
+}
+
+//A node process and the arguments it is started with
+type nodeProcess struct {
+	id      string
+	node    mydynamo.DynamoNode
+	seeds   []mydynamo.DynamoNode
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser // held open so the node exits with the coordinator
+	stopped bool
+}
+
+func newSupervisor(binary string, configPath string, restartDelay time.Duration, wg *sync.WaitGroup) *supervisor {
+	return &supervisor{
+		binary:       binary,
+		configPath:   configPath,
+		restartDelay: restartDelay,
+		wg:           wg,
+		nodes:        make(map[string]*nodeProcess),
+	}
+}
+
+//Starts a process for node id serving on node, which joins the cluster seeds
+//belong to
+func (sv *supervisor) start(id string, node mydynamo.DynamoNode, seeds []mydynamo.DynamoNode) error {
+	sv.m.Lock()
+	defer sv.m.Unlock()
+
+	p := &nodeProcess{id: id, node: node, seeds: append([]mydynamo.DynamoNode{}, seeds...)}
+	if err := sv.spawn(p); err != nil {
+		return err
+	}
+	sv.nodes[node.Port] = p
+	sv.wg.Add(1)
+	return nil
+}
+
+//Kills the process of the node on port with SIGKILL, as a machine failure
+//would. The process is restarted after the restart delay
+func (sv *supervisor) kill(port string) error {
+	sv.m.Lock()
+	defer sv.m.Unlock()
+
+	p, ok := sv.nodes[port]
+	if !ok || p.stopped {
+		return fmt.Errorf("no node runs on port %v", port)
+	}
+	return p.cmd.Process.Kill()
+}
+
+//Kills the process of the node on port for good
+func (sv *supervisor) stop(port string) error {
+	sv.m.Lock()
+	defer sv.m.Unlock()
+
+	p, ok := sv.nodes[port]
+	if !ok || p.stopped {
+		return fmt.Errorf("no node runs on port %v", port)
+	}
+	p.stopped = true
+	return p.cmd.Process.Kill()
+}
+
+//Starts the process of p and watches it. Called with sv.m held
+func (sv *supervisor) spawn(p *nodeProcess) error {
+	seeds := make([]string, 0, len(p.seeds))
+	for _, seed := range p.seeds {
+		seeds = append(seeds, seed.Address+":"+seed.Port)
+	}
+	cmd := exec.Command(sv.binary, "-id", p.id, "-listen", p.node.Address+":"+p.node.Port,
+		"-seeds", strings.Join(seeds, ","), "-supervised", sv.configPath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.cmd, p.stdin = cmd, stdin
+	log.Println("Started node", p.id, "on port", p.node.Port, "as process", cmd.Process.Pid)
+	go sv.watch(p, cmd)
+	return nil
+}
+
+//Waits for cmd, the process of p, to exit and restarts it after the restart
+//delay unless p was stopped
+func (sv *supervisor) watch(p *nodeProcess, cmd *exec.Cmd) {
+	err := cmd.Wait()
+	sv.m.Lock()
+	stopped := p.stopped
+	sv.m.Unlock()
+	if stopped {
+		sv.wg.Done()
+		return
+	}
+	log.Println("Node", p.id, "on port", p.node.Port, "exited:", err)
+	if sv.restartDelay <= 0 {
+		sv.wg.Done()
+		return
+	}
+
+	time.Sleep(sv.restartDelay)
+	sv.m.Lock()
+	defer sv.m.Unlock()
+	if p.stopped {
+		sv.wg.Done()
+		return
+	}
+	if err := sv.spawn(p); err != nil {
+		log.Println("Failed to restart node", p.id, err)
+		sv.wg.Done()
+	}
+}
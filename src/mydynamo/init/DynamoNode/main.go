@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mydynamo"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	flags := flag.NewFlagSet("DynamoNode", flag.ContinueOnError)
+	flags.Usage = func() { log.Println(mydynamo.NODE_USAGE_STRING) }
+	id := flags.String("id", "", "node id, overrides "+mydynamo.NODE_ID)
+	listen := flags.String("listen", "", "host:port to serve on, overrides "+mydynamo.LISTEN_ADDRESS)
+	seeds := flags.String("seeds", "", "comma separated host:port of the seed nodes, overrides "+mydynamo.SEEDS)
+	supervised := flags.Bool("supervised", false, "exit when standard input is closed, as when the coordinator exits")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(mydynamo.EX_USAGE)
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(mydynamo.EX_USAGE)
+	}
+
+	// Load the configuration file, the flags override its node keys
+	configFilePath := flags.Arg(0)
+	config, err := mydynamo.LoadConfig(configFilePath)
+	if err != nil {
+		log.Println(err)
+		log.Println("Failed to load config file:", configFilePath)
+		log.Println(mydynamo.NODE_USAGE_STRING)
+		os.Exit(mydynamo.EX_CONFIG)
+	}
+	if *id != "" {
+		config.NodeID = *id
+	}
+	if *listen != "" {
+		config.ListenAddress = *listen
+	}
+	if *seeds != "" {
+		if config.Seeds, err = mydynamo.ParseNodeList(*seeds); err != nil {
+			log.Println("Invalid seeds:", err)
+			os.Exit(mydynamo.EX_USAGE)
+		}
+	}
+	host, port, err := net.SplitHostPort(config.ListenAddress)
+	if err != nil || config.NodeID == "" {
+		log.Println("A node needs a", mydynamo.NODE_ID, "and a", mydynamo.LISTEN_ADDRESS, "of the form host:port")
+		os.Exit(mydynamo.EX_CONFIG)
+	}
+	if !mydynamo.IsStrictQuorum(config.RValue, config.WValue, config.NValue) {
+		log.Printf("r_value + w_value <= n_value (%v + %v <= %v), reads may not see the latest write\n", config.RValue, config.WValue, config.NValue)
+	}
+	config.Apply()
+	fmt.Println("Done loading configurations")
+
+	//Open this node's storage, in the same directory the coordinator would use
+	store, err := mydynamo.NewStorage(config.StorageEngine, filepath.Join(config.DataDir, "node"+config.NodeID))
+	if err != nil {
+		log.Println(err)
+		log.Println("Failed to open storage for node", config.NodeID)
+		os.Exit(mydynamo.EX_CONFIG)
+	}
+	serverInstance := mydynamo.NewDynamoServerWithStorage(config.WValue, config.RValue, config.NValue, host, port, config.NodeID, store)
+	go func() {
+		log.Fatal(mydynamo.ServeDynamoServer(serverInstance))
+	}()
+
+	//A supervised node has its standard input held open by the coordinator, so
+	//it does not outlive the coordinator even if that is killed
+	if *supervised {
+		go func() {
+			io.Copy(io.Discard, os.Stdin)
+			log.Println("Standard input closed, exiting")
+			os.Exit(0)
+		}()
+	}
+
+	if len(config.Seeds) == 0 {
+		config.Seeds = []mydynamo.DynamoNode{mydynamo.NewDynamoNode(host, port)}
+	}
+	if err := mydynamo.BootstrapNode(mydynamo.NewDynamoNode(host, port), config.Seeds); err != nil {
+		log.Fatal("Failed to join the cluster: ", err)
+	}
+	select {}
+}
@@ -0,0 +1,146 @@
+package mydynamotest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mydynamo"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientTypedErrors(t *testing.T) {
+	t.Logf("Starting client typed errors test")
+	startLocalCluster(t, 9096, 3, 3, 1, 3)
+
+	// the client dials on first use
+	clientInstance := mydynamo.NewDynamoRPCClient("localhost:9096")
+	defer clientInstance.CleanConn()
+	clientInstance.Retry.MaxAttempts = 1
+	ctx := context.Background()
+
+	if err := clientInstance.PutCtx(ctx, PutFreshContext("s1", []byte("abcde"))); err != nil {
+		t.Fatalf("TestClientTypedErrors: Put failed: %v", err)
+	}
+	err := clientInstance.PutCtx(ctx, PutFreshContext("s1", []byte("bcdef")))
+	if !errors.Is(err, mydynamo.ErrStaleContext) {
+		t.Errorf("TestClientTypedErrors: expected a stale context, got %v", err)
+	}
+
+	// with a replica down, W=3 can not be met
+	crashClient := MakeConnectedClient(9097)
+	defer crashClient.CleanConn()
+	if err := crashClient.CrashCtx(ctx, 2); err != nil {
+		t.Fatalf("TestClientTypedErrors: Crash failed: %v", err)
+	}
+	gotValue, err := clientInstance.GetCtx(ctx, "s1")
+	if err != nil || len(gotValue.EntryList) != 1 {
+		t.Fatalf("TestClientTypedErrors: Get failed: %v", err)
+	}
+	err = clientInstance.PutCtx(ctx, mydynamo.NewPutArgs("s1", gotValue.EntryList[0].Context, []byte("cdefg")))
+	if !errors.Is(err, mydynamo.ErrQuorumNotMet) {
+		t.Errorf("TestClientTypedErrors: expected a missed quorum, got %v", err)
+	}
+
+	err = crashClient.GossipCtx(ctx)
+	if !errors.Is(err, mydynamo.ErrNodeOffline) {
+		t.Errorf("TestClientTypedErrors: expected an offline node, got %v", err)
+	}
+}
+
+func TestClientRetriesOfflineNode(t *testing.T) {
+	t.Logf("Starting client retry test")
+	startLocalCluster(t, 9100, 3, 1, 1, 3)
+	clientInstance := MakeConnectedClient(9100)
+	defer clientInstance.CleanConn()
+	clientInstance.Retry.MaxAttempts = 5
+	clientInstance.Retry.InitialBackoff = 300 * time.Millisecond
+	ctx := context.Background()
+
+	if err := clientInstance.CrashCtx(ctx, 1); err != nil {
+		t.Fatalf("TestClientRetriesOfflineNode: Crash failed: %v", err)
+	}
+	// the node comes back while the client backs off
+	if err := clientInstance.PutCtx(ctx, PutFreshContext("s1", []byte("abcde"))); err != nil {
+		t.Errorf("TestClientRetriesOfflineNode: Put was not retried: %v", err)
+	}
+
+	// a deadline stops the retries
+	if err := clientInstance.CrashCtx(ctx, 2); err != nil {
+		t.Fatalf("TestClientRetriesOfflineNode: Crash failed: %v", err)
+	}
+	deadline, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	if _, err := clientInstance.GetCtx(deadline, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestClientRetriesOfflineNode: expected the deadline to pass, got %v", err)
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	t.Logf("Starting client deadline test")
+	startHungNode(t, 9099)
+	clientInstance := MakeConnectedClient(9099)
+	defer clientInstance.CleanConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := clientInstance.GetCtx(ctx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestClientDeadline: expected the deadline to pass, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestClientDeadline: Get blocked for %v", elapsed)
+	}
+
+	// a hung try is abandoned and retried on a fresh connection
+	clientInstance.Retry.AttemptTimeout = 100 * time.Millisecond
+	clientInstance.Retry.InitialBackoff = 10 * time.Millisecond
+	err := clientInstance.GossipCtx(context.Background())
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestClientDeadline: expected the tries to time out, got %v", err)
+	}
+}
+
+func TestClientDialDeadline(t *testing.T) {
+	t.Logf("Starting client dial deadline test")
+	// accepts connections but never answers the CONNECT that starts an RPC session
+	l, err := net.Listen("tcp", "localhost:9199")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+	clientInstance := mydynamo.NewDynamoRPCClient("localhost:9199")
+	defer clientInstance.CleanConn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := clientInstance.GetCtx(ctx, "s1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestClientDialDeadline: expected the deadline to pass, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestClientDialDeadline: dial blocked for %v", elapsed)
+	}
+
+	// a dial that hangs counts against the timeout of its try and is retried
+	clientInstance.Retry.AttemptTimeout = 100 * time.Millisecond
+	clientInstance.Retry.InitialBackoff = 10 * time.Millisecond
+	start = time.Now()
+	err = clientInstance.GossipCtx(context.Background())
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("TestClientDialDeadline: expected the tries to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("TestClientDialDeadline: tries blocked for %v", elapsed)
+	}
+}
@@ -0,0 +1,121 @@
+package mydynamotest
+
+import (
+	"bytes"
+	"errors"
+	"mydynamo"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientSplitArgs(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		args []string
+	}{
+		{"", []string{}},
+		{"  get   s1 ", []string{"get", "s1"}},
+		{"put\ts1\tabc", []string{"put", "s1", "abc"}},
+		{`put s1 "two words"`, []string{"put", "s1", "two words"}},
+		{`put s1 ""`, []string{"put", "s1", ""}},
+		{`put s1 a"b c"d`, []string{"put", "s1", "ab cd"}},
+		{`put s1 two\ words \"quoted\"`, []string{"put", "s1", "two words", `"quoted"`}},
+	} {
+		if args, err := mydynamo.SplitArgs(test.line); err != nil || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("TestClientSplitArgs: %q split into %q, %v", test.line, args, err)
+		}
+	}
+	for _, line := range []string{`put s1 "two words`, `put s1 abc\`} {
+		if args, err := mydynamo.SplitArgs(line); err == nil {
+			t.Errorf("TestClientSplitArgs: %q split into %q", line, args)
+		}
+	}
+}
+
+func TestClientFormatValue(t *testing.T) {
+	for value, formatted := range map[string]string{
+		"abcde":     "abcde",
+		"two words": "two words",
+		"":          "",
+		"a\x00b":    `"a\x00b"`,
+		"line\n":    `"line\n"`,
+		"\xff\xfe":  `"\xff\xfe"`,
+	} {
+		if got := mydynamo.FormatValue([]byte(value)); got != formatted {
+			t.Errorf("TestClientFormatValue: %q formatted as %v, expected %v", value, got, formatted)
+		}
+	}
+}
+
+//Returns the context token the last get printed to out
+func printedContext(t *testing.T, out string) string {
+	index := strings.LastIndex(out, "context: ")
+	if index < 0 {
+		t.Fatalf("no context in %q", out)
+	}
+	return strings.Fields(out[index+len("context: "):])[0]
+}
+
+func TestClientSessionContexts(t *testing.T) {
+	t.Logf("Starting client session context test")
+	startLocalCluster(t, 9200, 1, 1, 1, 1)
+	var out bytes.Buffer
+	s := &mydynamo.ClientSession{
+		Client:   mydynamo.NewDynamoRPCClient("localhost:9200"),
+		Timeout:  5 * time.Second,
+		Out:      &out,
+		Contexts: make(map[string]mydynamo.Context),
+	}
+	defer s.Client.CleanConn()
+	run := func(args ...string) string {
+		out.Reset()
+		if err := s.Run(args); err != nil {
+			t.Fatalf("TestClientSessionContexts: %v returned %v", args, err)
+		}
+		return out.String()
+	}
+
+	// a put after a get writes with the context the get read, replacing the value
+	run("put", "s1", "abcde")
+	if got := run("get", "s1"); !strings.HasPrefix(got, "abcde\n") {
+		t.Errorf("TestClientSessionContexts: get printed %q", got)
+	}
+	if _, ok := s.Contexts["s1"]; !ok {
+		t.Fatalf("TestClientSessionContexts: get did not remember the context")
+	}
+	run("put", "s1", "bcdef")
+	if _, ok := s.Contexts["s1"]; ok {
+		t.Errorf("TestClientSessionContexts: put kept the context it replaced")
+	}
+	got := run("get", "s1")
+	if !strings.HasPrefix(got, "bcdef\n") || strings.Contains(got, "siblings") {
+		t.Errorf("TestClientSessionContexts: get after put printed %q", got)
+	}
+
+	// a session that does not remember contexts writes with the printed token
+	token := printedContext(t, got)
+	s.Contexts = nil
+	run("put", "-context", token, "s1", "cdefg")
+	if got := run("get", "s1"); !strings.HasPrefix(got, "cdefg\n") || strings.Contains(got, "siblings") {
+		t.Errorf("TestClientSessionContexts: put with a token printed %q", got)
+	}
+
+	for _, args := range [][]string{{}, {"get"}, {"put", "s1"}, {"crash", "-1"}, {"unknown"}} {
+		if err := s.Run(args); !errors.Is(err, mydynamo.ErrUsage) {
+			t.Errorf("TestClientSessionContexts: %v returned %v", args, err)
+		}
+	}
+
+	// the REPL carries contexts from one command to the next
+	s.Contexts = make(map[string]mydynamo.Context)
+	out.Reset()
+	if err := s.Repl(strings.NewReader("get s1\nput s1 \"d e f g h\"\nbogus\nget s1\nquit\nget s1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.Contains(got, "dynamo> d e f g h\n") || strings.Contains(got, "siblings") ||
+		!strings.Contains(got, mydynamo.REPL_HELP_STRING) || strings.Count(got, "dynamo> ") != 5 {
+		t.Errorf("TestClientSessionContexts: REPL printed %q", got)
+	}
+}
@@ -0,0 +1,95 @@
+package mydynamotest
+
+import (
+	"context"
+	"mydynamo"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClusterClientFailover(t *testing.T) {
+	t.Logf("Starting cluster client failover test")
+	startLocalCluster(t, 9110, 5, 1, 1, 3)
+
+	// the first seed is not running, the client moves on to the next one
+	clusterClient := mydynamo.NewClusterClient([]mydynamo.DynamoNode{
+		mydynamo.NewDynamoNode("localhost", "9119"),
+		mydynamo.NewDynamoNode("localhost", "9110"),
+	})
+	defer clusterClient.Close()
+	ctx := context.Background()
+
+	if err := clusterClient.Put(ctx, PutFreshContext("s1", []byte("abcde"))); err != nil {
+		t.Fatalf("TestClusterClientFailover: Put failed: %v", err)
+	}
+	if len(clusterClient.Members()) != 5 {
+		t.Fatalf("TestClusterClientFailover: client sees %v members", len(clusterClient.Members()))
+	}
+	replicas := clusterClient.PreferenceList("s1")
+	if len(replicas) != 3 {
+		t.Fatalf("TestClusterClientFailover: expected 3 replicas, got %v", replicas)
+	}
+
+	// with W=1 only the coordinator has the write, so it went to the first replica
+	coordinator := MakeConnectedClient(portOf(t, replicas[0]))
+	defer coordinator.CleanConn()
+	gotValuePtr := coordinator.Get("s1")
+	if gotValuePtr == nil || !entriesContain(gotValuePtr.EntryList, []byte("abcde")) {
+		t.Errorf("TestClusterClientFailover: write was not routed to the first replica")
+	}
+
+	// the other replicas serve the key once the first one crashes
+	coordinator.Gossip()
+	coordinator.Crash(3)
+	gotValue, err := clusterClient.Get(ctx, "s1")
+	if err != nil || len(gotValue.EntryList) != 1 || !valuesEqual(gotValue.EntryList[0].Value, []byte("abcde")) {
+		t.Errorf("TestClusterClientFailover: Get did not fail over: %v", err)
+	}
+	if err := clusterClient.Put(ctx, mydynamo.NewPutArgs("s1", gotValue.EntryList[0].Context, []byte("bcdef"))); err != nil {
+		t.Errorf("TestClusterClientFailover: Put did not fail over: %v", err)
+	}
+}
+
+func TestClusterClientRefresh(t *testing.T) {
+	t.Logf("Starting cluster client refresh test")
+	startLocalCluster(t, 9120, 3, 1, 1, 2)
+	clusterClient := mydynamo.NewClusterClient([]mydynamo.DynamoNode{mydynamo.NewDynamoNode("localhost", "9120")})
+	defer clusterClient.Close()
+	clusterClient.RefreshInterval = 100 * time.Millisecond
+	ctx := context.Background()
+
+	if err := clusterClient.Refresh(ctx); err != nil || len(clusterClient.Members()) != 3 {
+		t.Fatalf("TestClusterClientRefresh: failed to fetch the membership: %v", err)
+	}
+
+	// a fourth node joins, and the client picks it up on its next request
+	server := mydynamo.NewDynamoServerWithStorage(1, 1, 2, "localhost", "9123", "3", mydynamo.NewMemoryStorage())
+	go mydynamo.ServeDynamoServer(server)
+	time.Sleep(500 * time.Millisecond)
+	joiner := MakeConnectedClient(9123)
+	defer joiner.CleanConn()
+	if !joiner.Join(mydynamo.NewDynamoNode("localhost", "9120")) {
+		t.Fatalf("TestClusterClientRefresh: join failed")
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		key := "s" + strconv.Itoa(i)
+		if err := clusterClient.Put(ctx, PutFreshContext(key, []byte("abcde"))); err != nil {
+			t.Errorf("TestClusterClientRefresh: Put of %v failed: %v", key, err)
+		}
+	}
+	if len(clusterClient.Members()) != 4 {
+		t.Errorf("TestClusterClientRefresh: client sees %v members after the join", len(clusterClient.Members()))
+	}
+}
+
+//Returns the port of node as an int
+func portOf(t *testing.T, node mydynamo.DynamoNode) int {
+	port, err := strconv.Atoi(node.Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port
+}
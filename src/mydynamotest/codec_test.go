@@ -0,0 +1,160 @@
+package mydynamotest
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"mydynamo"
+	"reflect"
+	"testing"
+)
+
+//Returns a result with siblings as a three node cluster stores them
+func sampleResult() mydynamo.DynamoResult {
+	result := mydynamo.DynamoResult{}
+	for i, id := range []string{"0", "1", "2"} {
+		clock := mydynamo.NewVectorClock()
+		incElementVersion(&clock, "0", 4)
+		incElementVersion(&clock, id, 3)
+		entry := mydynamo.NewObjectEntry(mydynamo.NewContext(clock), bytes.Repeat([]byte{byte('a' + i)}, 100))
+		entry.Timestamp = 1700000000000000000 + int64(i)
+		result.EntryList = append(result.EntryList, entry)
+	}
+	tombstone := mydynamo.NewObjectEntry(mydynamo.NewContext(mydynamo.NewVectorClock()), nil)
+	tombstone.Tombstone = true
+	tombstone.Context.Clock.Dot = mydynamo.Dot{Node: "node-a", Counter: 7}
+	tombstone.Context.Clock.Pruned = []string{"0123456789abcdef"}
+	result.EntryList = append(result.EntryList, tombstone)
+	return result
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	result := sampleResult()
+	decoded, err := mydynamo.UnmarshalDynamoResult(mydynamo.MarshalDynamoResult(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, result) {
+		t.Errorf("TestCodecRoundTrip: result changed:\n%v\n%v", result, decoded)
+	}
+
+	value := mydynamo.NewPutArgs("s1", result.EntryList[1].Context, []byte{})
+	value.CRDT = mydynamo.CRDT_OR_SET
+	if decoded, err := mydynamo.UnmarshalPutArgs(mydynamo.MarshalPutArgs(value)); err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Errorf("TestCodecRoundTrip: put args changed: %v, %v", decoded, err)
+	}
+	values := []mydynamo.PutArgs{value, mydynamo.NewPutArgs("s2", result.EntryList[0].Context, []byte("abcde"))}
+	if decoded, err := mydynamo.UnmarshalPutArgsList(mydynamo.MarshalPutArgsList(values)); err != nil || !reflect.DeepEqual(decoded, values) {
+		t.Errorf("TestCodecRoundTrip: put args list changed: %v, %v", decoded, err)
+	}
+	clock := result.EntryList[3].Context.Clock
+	if decoded, err := mydynamo.UnmarshalVectorClock(mydynamo.MarshalVectorClock(clock)); err != nil || !decoded.Equals(clock) {
+		t.Errorf("TestCodecRoundTrip: clock changed: %v, %v", decoded, err)
+	}
+
+	// equal clocks encode to equal bytes whatever their map order
+	if !bytes.Equal(mydynamo.MarshalObjectEntry(result.EntryList[0]), mydynamo.MarshalObjectEntry(result.EntryList[0])) {
+		t.Errorf("TestCodecRoundTrip: encoding is not deterministic")
+	}
+}
+
+func TestCodecRejectsMalformed(t *testing.T) {
+	encoded := mydynamo.MarshalDynamoResult(sampleResult())
+	for _, data := range [][]byte{
+		nil,
+		{mydynamo.CODEC_VERSION + 1},
+		encoded[:len(encoded)-1],
+		append(append([]byte{}, encoded...), 0),
+		{mydynamo.CODEC_VERSION, 0xff, 0xff, 0xff, 0xff, 0x0f},
+	} {
+		if _, err := mydynamo.UnmarshalDynamoResult(data); !errors.Is(err, mydynamo.ErrMalformed) {
+			t.Errorf("TestCodecRejectsMalformed: %v decoded with %v", data, err)
+		}
+	}
+}
+
+func TestCodecSmallerThanGob(t *testing.T) {
+	result := sampleResult()
+	if encoded, gobbed := len(mydynamo.MarshalDynamoResult(result)), gobSize(result); encoded >= gobbed {
+		t.Errorf("TestCodecSmallerThanGob: %v bytes against %v for gob", encoded, gobbed)
+	}
+}
+
+//Returns the size of result in a gob stream that has already sent its type
+func gobSize(result mydynamo.DynamoResult) int {
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	encoder.Encode(result)
+	buf.Reset()
+	encoder.Encode(result)
+	return buf.Len()
+}
+
+func FuzzUnmarshalDynamoResult(f *testing.F) {
+	f.Add(mydynamo.MarshalDynamoResult(sampleResult()))
+	f.Add(mydynamo.MarshalDynamoResult(mydynamo.DynamoResult{}))
+	f.Add([]byte{mydynamo.CODEC_VERSION, 1, 3})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		result, err := mydynamo.UnmarshalDynamoResult(data)
+		if err != nil {
+			return
+		}
+		// whatever decodes must survive another round trip unchanged
+		again, err := mydynamo.UnmarshalDynamoResult(mydynamo.MarshalDynamoResult(result))
+		if err != nil || !reflect.DeepEqual(again, result) {
+			t.Errorf("round trip changed %v into %v, %v", result, again, err)
+		}
+	})
+}
+
+func BenchmarkCodecEncode(b *testing.B) {
+	result := sampleResult()
+	b.ReportAllocs()
+	var size int
+	for i := 0; i < b.N; i++ {
+		size = len(mydynamo.MarshalDynamoResult(result))
+	}
+	b.ReportMetric(float64(size), "bytes/msg")
+}
+
+func BenchmarkGobEncode(b *testing.B) {
+	result := sampleResult()
+	var buf bytes.Buffer
+	encoder := gob.NewEncoder(&buf)
+	encoder.Encode(result)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		encoder.Encode(result)
+	}
+	b.ReportMetric(float64(buf.Len()), "bytes/msg")
+}
+
+func BenchmarkCodecDecode(b *testing.B) {
+	encoded := mydynamo.MarshalDynamoResult(sampleResult())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		mydynamo.UnmarshalDynamoResult(encoded)
+	}
+}
+
+func BenchmarkGobDecode(b *testing.B) {
+	// a stream holding the type once, then one message per iteration, as
+	// net/rpc sends them over a connection
+	result := sampleResult()
+	var stream bytes.Buffer
+	encoder := gob.NewEncoder(&stream)
+	for i := 0; i < b.N+1; i++ {
+		encoder.Encode(result)
+	}
+	decoder := gob.NewDecoder(&stream)
+	var decoded mydynamo.DynamoResult
+	decoder.Decode(&decoded)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoded = mydynamo.DynamoResult{}
+		decoder.Decode(&decoded)
+	}
+}
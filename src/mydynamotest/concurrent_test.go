@@ -0,0 +1,82 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"net/rpc"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Starts size servers inside the test process, on ports from basePort, and
+//sends them their preference lists the way DynamoCoordinator does. Unlike
+//InitDynamoServer this lets `go test -race` see the servers' goroutines
+func startLocalCluster(t *testing.T, basePort int, size int, w int, r int, n int) {
+	nodes := make([]mydynamo.DynamoNode, 0, size)
+	for idx := 0; idx < size; idx++ {
+		port := strconv.Itoa(basePort + idx)
+		server := mydynamo.NewDynamoServerWithStorage(w, r, n, "localhost", port, strconv.Itoa(idx), mydynamo.NewMemoryStorage())
+		go mydynamo.ServeDynamoServer(server)
+		nodes = append(nodes, mydynamo.NewDynamoNode("localhost", port))
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	preferenceList := append([]mydynamo.DynamoNode{}, nodes...)
+	for _, node := range nodes {
+		conn, err := rpc.DialHTTP("tcp", node.Address+":"+node.Port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var empty mydynamo.Empty
+		if err := conn.Call("MyDynamo.SendPreferenceList", preferenceList, &empty); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		preferenceList = mydynamo.RotateServerList(preferenceList)
+	}
+}
+
+func TestConcurrentLoad(t *testing.T) {
+	t.Logf("Starting concurrent load test")
+	startLocalCluster(t, 9080, 5, 2, 2, 3)
+
+	const clients = 16
+	const rounds = 50
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			clientInstance := MakeConnectedClient(9080 + c%5)
+			defer clientInstance.CleanConn()
+			for i := 0; i < rounds; i++ {
+				key := "s" + strconv.Itoa(i%8)
+				value := PutFreshContext(key, []byte(strconv.Itoa(c)))
+				if got := clientInstance.Get(key); got != nil && len(got.EntryList) > 0 {
+					value.Context = got.EntryList[0].Context
+				}
+				clientInstance.Put(value)
+				if i%10 == 0 {
+					clientInstance.Gossip()
+				}
+				if i%25 == 0 {
+					clientInstance.Delete(key, value.Context)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	// every node can still serve every key once the load stops
+	for port := 9080; port < 9085; port++ {
+		clientInstance := MakeConnectedClient(port)
+		clientInstance.Gossip()
+		for i := 0; i < 8; i++ {
+			if clientInstance.Get("s"+strconv.Itoa(i)) == nil {
+				t.Errorf("TestConcurrentLoad: Get of s%v through %v failed", i, port)
+			}
+		}
+		clientInstance.CleanConn()
+	}
+}
@@ -0,0 +1,171 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+//Returns the CRDT held by the single entry of result
+func decodeSingle(t *testing.T, result *mydynamo.DynamoResult) mydynamo.CRDT {
+	if result == nil || len(result.EntryList) != 1 {
+		t.Fatalf("expected a single merged entry, got %v", result)
+	}
+	state, err := mydynamo.DecodeCRDT(result.EntryList[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestCRDTMerge(t *testing.T) {
+	a := mydynamo.NewPNCounter()
+	a.Increment("0", 5)
+	b := mydynamo.NewPNCounter()
+	b.Increment("1", -2)
+	a.Merge(b)
+	a.Merge(b)
+	if a.Value() != 3 {
+		t.Errorf("TestCRDTMerge: counter is %v, expected 3", a.Value())
+	}
+	if err := a.Merge(mydynamo.NewGCounter()); err == nil {
+		t.Errorf("TestCRDTMerge: merged a g-counter into a pn-counter")
+	}
+
+	// an add concurrent with a remove survives it
+	left := mydynamo.NewORSet()
+	left.Add("x", "t1")
+	right := mydynamo.NewORSet()
+	right.Merge(left)
+	right.Remove("x")
+	left.Add("x", "t2")
+	left.Add("y", "t3")
+	right.Merge(left)
+	left.Merge(right)
+	if !reflect.DeepEqual(left.Elements(), []string{"x", "y"}) || !reflect.DeepEqual(right.Elements(), left.Elements()) {
+		t.Errorf("TestCRDTMerge: sets did not converge: %v, %v", left.Elements(), right.Elements())
+	}
+
+	first := mydynamo.NewLWWRegister([]byte("old"), 1, "1")
+	second := mydynamo.NewLWWRegister([]byte("new"), 2, "0")
+	first.Merge(second)
+	second.Merge(mydynamo.NewLWWRegister([]byte("old"), 1, "1"))
+	if string(first.Value) != "new" || string(second.Value) != "new" {
+		t.Errorf("TestCRDTMerge: registers kept %s and %s", first.Value, second.Value)
+	}
+
+	// a field set concurrently keeps both values until it is set again
+	m1 := mydynamo.NewCRDTMap()
+	m1.Set("color", []byte("red"), "t1")
+	m2 := mydynamo.NewCRDTMap()
+	m2.Set("color", []byte("blue"), "t2")
+	m1.Merge(m2)
+	if len(m1.Get("color")) != 2 {
+		t.Errorf("TestCRDTMerge: concurrent field holds %v", m1.Get("color"))
+	}
+	m1.Set("color", []byte("green"), "t3")
+	m2.Merge(m1)
+	if values := m2.Get("color"); len(values) != 1 || string(values[0]) != "green" {
+		t.Errorf("TestCRDTMerge: field holds %v after being set again", values)
+	}
+}
+
+func TestCRDTCounter(t *testing.T) {
+	t.Logf("Starting CRDT counter test")
+	startLocalCluster(t, 9150, 3, 1, 1, 3)
+	clients := make([]*mydynamo.RPCClient, 3)
+	for i := range clients {
+		clients[i] = MakeConnectedClient(9150 + i)
+		defer clients[i].CleanConn()
+	}
+
+	// every node coordinates increments at the same time
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(client *mydynamo.RPCClient) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if !client.Increment("hits", 1) {
+					t.Errorf("TestCRDTCounter: Increment failed")
+				}
+			}
+		}(clients[i])
+	}
+	wg.Wait()
+	clients[1].Increment("hits", -5)
+	for _, client := range clients {
+		client.Gossip()
+	}
+
+	for i, client := range clients {
+		counter, ok := decodeSingle(t, client.Get("hits")).(*mydynamo.PNCounter)
+		if !ok || counter.Value() != 25 {
+			t.Errorf("TestCRDTCounter: node %v reads %v, expected 25", i, counter)
+		}
+	}
+
+	clients[0].Put(PutFreshContext("plain", []byte("abcde")))
+	if clients[0].Increment("plain", 1) {
+		t.Errorf("TestCRDTCounter: incremented a plain value")
+	}
+}
+
+func TestCRDTSet(t *testing.T) {
+	t.Logf("Starting CRDT set test")
+	startLocalCluster(t, 9153, 3, 1, 1, 3)
+	clientInstance0 := MakeConnectedClient(9153)
+	defer clientInstance0.CleanConn()
+	clientInstance1 := MakeConnectedClient(9154)
+	defer clientInstance1.CleanConn()
+
+	clientInstance0.AddToSet("tags", "a")
+	clientInstance0.Gossip()
+	// the second node removes the add it has seen while the first adds again
+	clientInstance1.RemoveFromSet("tags", "a")
+	clientInstance0.AddToSet("tags", "a")
+	for i := 0; i < 5; i++ {
+		clientInstance1.AddToSet("tags", "b"+strconv.Itoa(i))
+	}
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+
+	expected := []string{"a", "b0", "b1", "b2", "b3", "b4"}
+	for _, client := range []*mydynamo.RPCClient{clientInstance0, clientInstance1} {
+		set, ok := decodeSingle(t, client.Get("tags")).(*mydynamo.ORSet)
+		if !ok || !reflect.DeepEqual(set.Elements(), expected) {
+			t.Errorf("TestCRDTSet: set holds %v, expected %v", set, expected)
+		}
+	}
+
+	clientInstance1.RemoveFromSet("tags", "a")
+	clientInstance1.Gossip()
+	set := decodeSingle(t, clientInstance0.Get("tags")).(*mydynamo.ORSet)
+	if set.Contains("a") {
+		t.Errorf("TestCRDTSet: removed element is still in the set")
+	}
+}
+
+func TestCRDTRegisterPut(t *testing.T) {
+	t.Logf("Starting CRDT register test")
+	startLocalCluster(t, 9156, 3, 1, 1, 3)
+	clientInstance0 := MakeConnectedClient(9156)
+	defer clientInstance0.CleanConn()
+	clientInstance1 := MakeConnectedClient(9157)
+	defer clientInstance1.CleanConn()
+
+	// two fresh writes of a register merge instead of becoming siblings
+	older, _ := mydynamo.NewCRDTPutArgs("reg", mydynamo.NewContext(mydynamo.NewVectorClock()), mydynamo.NewLWWRegister([]byte("abcde"), 1, "client0"))
+	newer, _ := mydynamo.NewCRDTPutArgs("reg", mydynamo.NewContext(mydynamo.NewVectorClock()), mydynamo.NewLWWRegister([]byte("bcdef"), 2, "client1"))
+	clientInstance1.Put(newer)
+	clientInstance0.Put(older)
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+
+	register, ok := decodeSingle(t, clientInstance0.Get("reg")).(*mydynamo.LWWRegister)
+	if !ok || !valuesEqual(register.Value, []byte("bcdef")) {
+		t.Errorf("TestCRDTRegisterPut: register holds %v", register)
+	}
+}
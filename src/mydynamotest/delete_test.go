@@ -0,0 +1,131 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//Returns the raw entries, including tombstones, that every node stores at key.
+//Nodes that are offline report no entries
+func getOnceAll(t *testing.T, key string, clusterSize int) [][]mydynamo.ObjectEntry {
+	stored := make([][]mydynamo.ObjectEntry, 0)
+	for port := 8080; port < 8080+clusterSize; port++ {
+		conn, err := rpc.DialHTTP("tcp", "localhost:"+strconv.Itoa(port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var local mydynamo.DynamoResult
+		conn.Call("MyDynamo.GetOnce", key, &local)
+		conn.Close()
+		stored = append(stored, local.EntryList)
+	}
+	return stored
+}
+
+func TestBasicDelete(t *testing.T) {
+	t.Logf("Starting basic Delete test")
+	cmd := InitDynamoServer("./twoserver.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	clientInstance0 := MakeConnectedClient(8080)
+	clientInstance1 := MakeConnectedClient(8081)
+	clientInstance0.Put(PutFreshContext("s1", []byte("abcde")))
+	gotValuePtr := clientInstance0.Get("s1")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 {
+		t.Fatalf("TestBasicDelete: Failed to get value before delete")
+	}
+
+	if !clientInstance0.Delete("s1", gotValuePtr.EntryList[0].Context) {
+		t.Errorf("TestBasicDelete: Delete returned false")
+	}
+	for _, clientInstance := range []*mydynamo.RPCClient{clientInstance0, clientInstance1} {
+		gotValuePtr = clientInstance.Get("s1")
+		if gotValuePtr == nil {
+			t.Fatalf("TestBasicDelete: Get of deleted key returned nil")
+		}
+		if len(gotValuePtr.EntryList) != 0 {
+			t.Errorf("TestBasicDelete: Get returned %v entries for deleted key", len(gotValuePtr.EntryList))
+		}
+	}
+
+	// the key can be written again with a fresh context
+	clientInstance0.Put(PutFreshContext("s1", []byte("efghi")))
+	gotValuePtr = clientInstance1.Get("s1")
+	if gotValuePtr == nil {
+		t.Fatalf("TestBasicDelete: Failed to get")
+	}
+	if len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("efghi")) {
+		t.Errorf("TestBasicDelete: Failed to get value written after delete")
+	}
+}
+
+func TestDeleteConcurrentPut(t *testing.T) {
+	t.Logf("Starting Delete with concurrent Put test")
+	cmd := InitDynamoServer("./myconfig.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	clientInstance0 := MakeConnectedClient(8080)
+	clientInstance1 := MakeConnectedClient(8081)
+	clientInstance0.Put(PutFreshContext("s1", []byte("abcde")))
+	clientInstance0.Gossip()
+	context := clientInstance0.Get("s1").EntryList[0].Context
+
+	// a delete and a write made from the same context are concurrent, the write survives
+	clientInstance0.Delete("s1", context)
+	clientInstance1.Put(mydynamo.NewPutArgs("s1", context, []byte("efghi")))
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+
+	gotValuePtr := clientInstance0.Get("s1")
+	if gotValuePtr == nil {
+		t.Fatalf("TestDeleteConcurrentPut: Failed to get")
+	}
+	if len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("efghi")) {
+		t.Errorf("TestDeleteConcurrentPut: concurrent write was hidden by delete")
+	}
+}
+
+func TestTombstonePurge(t *testing.T) {
+	t.Logf("Starting tombstone purge test")
+	cmd := InitDynamoServer("./tombstone.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	clientInstance0 := MakeConnectedClient(8080)
+	clientInstance0.Put(PutFreshContext("s1", []byte("abcde")))
+	clientInstance0.Gossip()
+	clientInstance0.Delete("s1", clientInstance0.Get("s1").EntryList[0].Context)
+
+	// gossip hands the tombstone to the other replicas, but the grace period has not passed
+	clientInstance0.Gossip()
+	for node, entries := range getOnceAll(t, "s1", 5) {
+		if len(entries) != 1 || !entries[0].Tombstone {
+			t.Errorf("TestTombstonePurge: node %v does not hold the tombstone", node)
+		}
+	}
+
+	time.Sleep(time.Second)
+	clientInstance0.Gossip()
+	for node, entries := range getOnceAll(t, "s1", 5) {
+		if len(entries) != 0 {
+			t.Errorf("TestTombstonePurge: node %v still holds %v entries after purge", node, len(entries))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package mydynamotest
+
+import (
+	"math/rand"
+	"mydynamo"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+//A version stored by the simulated replica, with the writes its client had seen
+type simVersion struct {
+	entry mydynamo.ObjectEntry
+	id    int
+	seen  map[int]bool
+}
+
+//Stores version the way PutOnce does: rejected if it equals or precedes a
+//stored version, otherwise it replaces the versions that precede it
+func storeVersion(stored []simVersion, version simVersion) ([]simVersion, bool) {
+	clock := version.entry.Context.Clock
+	kept := make([]simVersion, 0, len(stored)+1)
+	for _, other := range stored {
+		if clock.Equals(other.entry.Context.Clock) || clock.LessThan(other.entry.Context.Clock) {
+			return stored, false
+		}
+		if !other.entry.Context.Clock.LessThan(clock) {
+			kept = append(kept, other)
+		}
+	}
+	return append(kept, version), true
+}
+
+//Runs a random history of clients reading and writing one key through random
+//coordinators, and returns the ids of the versions left stored, the ids of the
+//writes no other write had seen, and the number of writes rejected
+func simulateWrites(mode string, seed int64, clients, nodes, ops int) ([]int, []int, int) {
+	rng := rand.New(rand.NewSource(seed))
+	stored := make([]simVersion, 0)
+	writes := make([]simVersion, 0)
+	contexts := make([]mydynamo.VectorClock, clients)
+	seen := make([]map[int]bool, clients)
+	for i := range contexts {
+		contexts[i] = mydynamo.NewVectorClock()
+		seen[i] = make(map[int]bool)
+	}
+
+	rejected := 0
+	for op := 0; op < ops; op++ {
+		client := rng.Intn(clients)
+		if rng.Intn(2) == 0 {
+			// read: the context descends from every stored version
+			clocks := make([]mydynamo.VectorClock, 0, len(stored))
+			seen[client] = make(map[int]bool)
+			for _, version := range stored {
+				clocks = append(clocks, version.entry.Context.Clock)
+				seen[client][version.id] = true
+				for id := range version.seen {
+					seen[client][id] = true
+				}
+			}
+			contexts[client] = mydynamo.NewVectorClock()
+			contexts[client].Combine(clocks)
+			continue
+		}
+
+		entries := make([]mydynamo.ObjectEntry, 0, len(stored))
+		for _, version := range stored {
+			entries = append(entries, version.entry)
+		}
+		node := strconv.Itoa(rng.Intn(nodes))
+		clock := mydynamo.StampClock(mode, node, contexts[client], entries)
+		version := simVersion{
+			entry: mydynamo.NewObjectEntry(mydynamo.NewContext(clock), []byte(strconv.Itoa(op))),
+			id:    op,
+			seen:  seen[client],
+		}
+		writes = append(writes, version)
+		var ok bool
+		if stored, ok = storeVersion(stored, version); !ok {
+			rejected++
+		}
+	}
+
+	siblings := make([]int, 0, len(stored))
+	for _, version := range stored {
+		siblings = append(siblings, version.id)
+	}
+	frontier := make([]int, 0)
+	for _, write := range writes {
+		superseded := false
+		for _, other := range writes {
+			if other.seen[write.id] {
+				superseded = true
+			}
+		}
+		if !superseded {
+			frontier = append(frontier, write.id)
+		}
+	}
+	sort.Ints(siblings)
+	return siblings, frontier, rejected
+}
+
+func TestDVVSiblingsProperty(t *testing.T) {
+	dvvSiblings, vcSiblings, vcRejected := 0, 0, 0
+	for seed := int64(0); seed < 500; seed++ {
+		clients := rand.New(rand.NewSource(seed)).Intn(4) + 1
+		dvv, frontier, rejected := simulateWrites(mydynamo.CAUSALITY_DVV, seed, clients, 3, 40)
+		vc, _, vcLost := simulateWrites(mydynamo.CAUSALITY_VECTOR_CLOCK, seed, clients, 3, 40)
+
+		// dotted version vectors keep exactly the writes no other write saw
+		if rejected != 0 || !intsEqual(dvv, frontier) {
+			t.Fatalf("seed %v: dvv kept %v and rejected %v writes, expected %v", seed, dvv, rejected, frontier)
+		}
+		// vector clocks never keep a write another one saw, but reject
+		// concurrent writes made through the same node
+		for _, id := range vc {
+			if !containsInt(frontier, id) {
+				t.Fatalf("seed %v: vector clocks kept %v, superseded in %v", seed, id, frontier)
+			}
+		}
+		dvvSiblings += len(dvv)
+		vcSiblings += len(vc)
+		vcRejected += vcLost
+	}
+	t.Logf("siblings kept: dvv %v, vector clocks %v (%v writes rejected)", dvvSiblings, vcSiblings, vcRejected)
+}
+
+func TestDVVCluster(t *testing.T) {
+	t.Logf("Starting dotted version vector test")
+	startLocalCluster(t, 9160, 3, 3, 3, 3)
+	clientInstance0 := MakeConnectedClient(9160)
+	defer clientInstance0.CleanConn()
+	clientInstance1 := MakeConnectedClient(9161)
+	defer clientInstance1.CleanConn()
+
+	// with vector clocks two fresh writes through one node collide
+	clientInstance0.Put(PutFreshContext("vc", []byte("abcde")))
+	if clientInstance0.Put(PutFreshContext("vc", []byte("bcdef"))) {
+		t.Errorf("TestDVVCluster: second fresh write through the same node was accepted")
+	}
+
+	mydynamo.SetCausality(mydynamo.CAUSALITY_DVV)
+	defer mydynamo.SetCausality(mydynamo.CAUSALITY_VECTOR_CLOCK)
+
+	// with dotted version vectors they are siblings
+	if !clientInstance0.Put(PutFreshContext("dvv", []byte("abcde"))) ||
+		!clientInstance0.Put(PutFreshContext("dvv", []byte("bcdef"))) {
+		t.Fatalf("TestDVVCluster: fresh writes through the same node were rejected")
+	}
+	gotValuePtr := clientInstance1.Get("dvv")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 2 {
+		t.Fatalf("TestDVVCluster: expected two siblings, got %v", gotValuePtr)
+	}
+
+	// a write that saw both replaces them, a stale one joins the survivor
+	clocks := []mydynamo.VectorClock{gotValuePtr.EntryList[0].Context.Clock, gotValuePtr.EntryList[1].Context.Clock}
+	context := mydynamo.NewVectorClock()
+	context.Combine(clocks)
+	clientInstance1.Put(mydynamo.NewPutArgs("dvv", mydynamo.NewContext(context), []byte("cdefg")))
+	gotValuePtr = clientInstance0.Get("dvv")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("cdefg")) {
+		t.Fatalf("TestDVVCluster: siblings were not replaced: %v", gotValuePtr)
+	}
+	clientInstance0.Put(mydynamo.NewPutArgs("dvv", mydynamo.NewContext(clocks[0]), []byte("defgh")))
+	if gotValuePtr = clientInstance0.Get("dvv"); gotValuePtr == nil || len(gotValuePtr.EntryList) != 2 {
+		t.Errorf("TestDVVCluster: stale write did not become a sibling: %v", gotValuePtr)
+	}
+}
+
+func intsEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsInt(list []int, item int) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
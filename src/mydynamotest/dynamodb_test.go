@@ -0,0 +1,248 @@
+package mydynamotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"mydynamo"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//The fields of the DynamoDB API responses the tests look at
+type dynamoDBResponse struct {
+	Type             string `json:"__type"`
+	Item             mydynamo.DynamoDBItem
+	Attributes       mydynamo.DynamoDBItem
+	Items            []mydynamo.DynamoDBItem
+	Count            int
+	LastEvaluatedKey mydynamo.DynamoDBItem
+}
+
+//Posts a request for operation to the DynamoDB API of the node on port, and
+//returns the status code and the decoded response
+func dynamoDBRequest(t *testing.T, port int, operation string, body string) (int, dynamoDBResponse) {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:"+strconv.Itoa(port)+"/", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Amz-Target", mydynamo.DYNAMODB_TARGET_PREFIX+operation)
+	req.Header.Set("Content-Type", mydynamo.DYNAMODB_CONTENT_TYPE)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var response dynamoDBResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("%v returned a malformed response: %v", operation, err)
+	}
+	return resp.StatusCode, response
+}
+
+//Returns the string or number attribute name of item, or "" if it has none
+func stringAttribute(item mydynamo.DynamoDBItem, name string) string {
+	if value, ok := item[name]; ok && value.S != nil {
+		return *value.S
+	}
+	if value, ok := item[name]; ok && value.N != nil {
+		return *value.N
+	}
+	return ""
+}
+
+func TestDynamoDBItems(t *testing.T) {
+	t.Logf("Starting DynamoDB API item test")
+	startLocalCluster(t, 9180, 3, 2, 2, 3)
+
+	table := `{"TableName": "Music",
+		"KeySchema": [{"AttributeName": "Artist", "KeyType": "HASH"}, {"AttributeName": "Song", "KeyType": "RANGE"}],
+		"AttributeDefinitions": [{"AttributeName": "Artist", "AttributeType": "S"}, {"AttributeName": "Song", "AttributeType": "S"}],
+		"BillingMode": "PAY_PER_REQUEST"}`
+	if status, response := dynamoDBRequest(t, 9180, "CreateTable", table); status != http.StatusOK {
+		t.Fatalf("TestDynamoDBItems: CreateTable returned %v %v", status, response.Type)
+	}
+	if _, response := dynamoDBRequest(t, 9181, "CreateTable", table); !strings.HasSuffix(response.Type, "#ResourceInUseException") {
+		t.Errorf("TestDynamoDBItems: second CreateTable returned %v", response.Type)
+	}
+	if status, _ := dynamoDBRequest(t, 9182, "DescribeTable", `{"TableName": "Music"}`); status != http.StatusOK {
+		t.Errorf("TestDynamoDBItems: DescribeTable returned %v", status)
+	}
+
+	item := `{"TableName": "Music", "Item": {"Artist": {"S": "No One You Know"}, "Song": {"S": "Call Me Today"}, "Year": {"N": "2015"}}}`
+	if status, response := dynamoDBRequest(t, 9180, "PutItem", item); status != http.StatusOK {
+		t.Fatalf("TestDynamoDBItems: PutItem returned %v %v", status, response.Type)
+	}
+	key := `"Key": {"Artist": {"S": "No One You Know"}, "Song": {"S": "Call Me Today"}}`
+	_, response := dynamoDBRequest(t, 9182, "GetItem", `{"TableName": "Music", `+key+`}`)
+	if stringAttribute(response.Item, "Year") != "2015" {
+		t.Fatalf("TestDynamoDBItems: GetItem returned %v", response.Item)
+	}
+	_, response = dynamoDBRequest(t, 9181, "GetItem", `{"TableName": "Music", `+key+`, "ProjectionExpression": "#y", "ExpressionAttributeNames": {"#y": "Year"}}`)
+	if len(response.Item) != 1 || stringAttribute(response.Item, "Year") != "2015" {
+		t.Errorf("TestDynamoDBItems: projected GetItem returned %v", response.Item)
+	}
+
+	update := `{"TableName": "Music", ` + key + `,
+		"UpdateExpression": "SET Plays = if_not_exists(Plays, :zero) + :one, Genre = :g ADD Tags :t REMOVE #y",
+		"ExpressionAttributeNames": {"#y": "Year"},
+		"ExpressionAttributeValues": {":zero": {"N": "0"}, ":one": {"N": "1"}, ":g": {"S": "Rock"}, ":t": {"SS": ["live"]}},
+		"ReturnValues": "ALL_NEW"}`
+	dynamoDBRequest(t, 9180, "UpdateItem", update)
+	status, response := dynamoDBRequest(t, 9181, "UpdateItem", update)
+	if status != http.StatusOK || stringAttribute(response.Attributes, "Plays") != "2" ||
+		stringAttribute(response.Attributes, "Genre") != "Rock" || len(response.Attributes["Tags"].SS) != 1 {
+		t.Fatalf("TestDynamoDBItems: UpdateItem returned %v %v", status, response.Attributes)
+	}
+	if _, ok := response.Attributes["Year"]; ok {
+		t.Errorf("TestDynamoDBItems: REMOVE left %v", response.Attributes)
+	}
+	_, response = dynamoDBRequest(t, 9180, "UpdateItem", `{"TableName": "Music", `+key+`, "UpdateExpression": "SET Song = :s",
+		"ExpressionAttributeValues": {":s": {"S": "Other"}}}`)
+	if !strings.HasSuffix(response.Type, "#ValidationException") {
+		t.Errorf("TestDynamoDBItems: update of a key attribute returned %v", response.Type)
+	}
+
+	_, response = dynamoDBRequest(t, 9182, "DeleteItem", `{"TableName": "Music", `+key+`, "ReturnValues": "ALL_OLD"}`)
+	if stringAttribute(response.Attributes, "Plays") != "2" {
+		t.Errorf("TestDynamoDBItems: DeleteItem returned %v", response.Attributes)
+	}
+	if _, response := dynamoDBRequest(t, 9180, "GetItem", `{"TableName": "Music", `+key+`}`); response.Item != nil {
+		t.Errorf("TestDynamoDBItems: deleted item returned %v", response.Item)
+	}
+
+	// every item has a key of its own, even when key values hold the separator
+	dynamoDBRequest(t, 9180, "PutItem", `{"TableName": "Music", "Item": {"Artist": {"S": "a/Sb"}, "Song": {"S": "c"}}}`)
+	dynamoDBRequest(t, 9180, "PutItem", `{"TableName": "Music", "Item": {"Artist": {"S": "a"}, "Song": {"S": "b/Sc"}}}`)
+	_, response = dynamoDBRequest(t, 9181, "Query", `{"TableName": "Music", "KeyConditionExpression": "Artist = :a",
+		"ExpressionAttributeValues": {":a": {"S": "a"}}}`)
+	if response.Count != 1 || stringAttribute(response.Items[0], "Song") != "b/Sc" {
+		t.Errorf("TestDynamoDBItems: Query returned %v", response.Items)
+	}
+	_, response = dynamoDBRequest(t, 9182, "GetItem", `{"TableName": "Music", "Key": {"Artist": {"S": "a/Sb"}, "Song": {"S": "c"}}}`)
+	if stringAttribute(response.Item, "Artist") != "a/Sb" {
+		t.Errorf("TestDynamoDBItems: GetItem returned %v", response.Item)
+	}
+
+	for _, request := range []struct{ operation, body, exception string }{
+		{"GetItem", `{"TableName": "Albums", ` + key + `}`, "ResourceNotFoundException"},
+		{"PutItem", `{"TableName": "Music", "Item": {"Artist": {"S": "a"}}}`, "ValidationException"},
+		{"PutItem", `{"TableName": "Music", "Item": {"Artist": {"N": "1"}, "Song": {"S": "b"}}}`, "ValidationException"},
+		{"PutItem", `{"TableName": "Music", "Item": {"Artist": {"S": "a"}, "Song": {"S": "b"}}, "ConditionExpression": "attribute_not_exists(Song)"}`, "ValidationException"},
+		{"Scan", `{"TableName": "Music"}`, "UnknownOperationException"},
+	} {
+		if _, response := dynamoDBRequest(t, 9181, request.operation, request.body); !strings.HasSuffix(response.Type, "#"+request.exception) {
+			t.Errorf("TestDynamoDBItems: %v %v returned %v", request.operation, request.body, response.Type)
+		}
+	}
+}
+
+func TestDynamoDBQuery(t *testing.T) {
+	t.Logf("Starting DynamoDB API query test")
+	startLocalCluster(t, 9183, 3, 2, 2, 3)
+
+	dynamoDBRequest(t, 9183, "CreateTable", `{"TableName": "Readings",
+		"KeySchema": [{"AttributeName": "Sensor", "KeyType": "HASH"}, {"AttributeName": "Time", "KeyType": "RANGE"}],
+		"AttributeDefinitions": [{"AttributeName": "Sensor", "AttributeType": "S"}, {"AttributeName": "Time", "AttributeType": "N"}]}`)
+	for _, sensor := range []string{"s1", "s2"} {
+		for _, time := range []string{"5", "10", "20", "100", "2.5"} {
+			item := `{"TableName": "Readings", "Item": {"Sensor": {"S": "` + sensor + `"}, "Time": {"N": "` + time + `"}}}`
+			if status, response := dynamoDBRequest(t, 9184, "PutItem", item); status != http.StatusOK {
+				t.Fatalf("TestDynamoDBQuery: PutItem returned %v %v", status, response.Type)
+			}
+		}
+	}
+
+	//Returns the times of the items a query returned
+	times := func(items []mydynamo.DynamoDBItem) string {
+		list := make([]string, 0, len(items))
+		for _, item := range items {
+			list = append(list, stringAttribute(item, "Time"))
+		}
+		return strings.Join(list, ",")
+	}
+	for _, query := range []struct{ condition, options, want string }{
+		{"Sensor = :s", "", "2.5,5,10,20,100"},
+		{"Sensor = :s AND #t BETWEEN :a AND :b", "", "5,10,20"},
+		{"#t > :a AND Sensor = :s", `, "ScanIndexForward": false`, "100,20,10"},
+		{"Sensor = :s AND #t <= :b", `, "Limit": 2`, "2.5,5"},
+		{"Sensor = :s AND #t < :b", `, "ExclusiveStartKey": {"Sensor": {"S": "s1"}, "Time": {"N": "5"}}`, "10"},
+	} {
+		body := `{"TableName": "Readings", "KeyConditionExpression": "` + query.condition + `",
+			"ExpressionAttributeValues": {":s": {"S": "s1"}, ":a": {"N": "5"}, ":b": {"N": "20.0"}}` + query.options
+		if strings.Contains(query.condition, "#t") {
+			body += `, "ExpressionAttributeNames": {"#t": "Time"}`
+		}
+		status, response := dynamoDBRequest(t, 9185, "Query", body+"}")
+		if status != http.StatusOK || times(response.Items) != query.want || response.Count != len(response.Items) {
+			t.Errorf("TestDynamoDBQuery: %v%v returned %v %v %v", query.condition, query.options, status, response.Type, times(response.Items))
+		}
+		if strings.Contains(query.options, "Limit") && stringAttribute(response.LastEvaluatedKey, "Time") != "5" {
+			t.Errorf("TestDynamoDBQuery: limited query returned LastEvaluatedKey %v", response.LastEvaluatedKey)
+		}
+	}
+
+	_, response := dynamoDBRequest(t, 9183, "Query", `{"TableName": "Readings", "KeyConditionExpression": "#t = :a",
+		"ExpressionAttributeNames": {"#t": "Time"}, "ExpressionAttributeValues": {":a": {"N": "5"}}}`)
+	if !strings.HasSuffix(response.Type, "#ValidationException") {
+		t.Errorf("TestDynamoDBQuery: query without the hash key returned %v", response.Type)
+	}
+}
+
+func TestDynamoDBConcurrentItems(t *testing.T) {
+	t.Logf("Starting DynamoDB API concurrent item test")
+	startLocalCluster(t, 9196, 3, 1, 1, 3)
+	clients := make([]*mydynamo.RPCClient, 0, 3)
+	for port := 9196; port < 9199; port++ {
+		client := MakeConnectedClient(port)
+		defer client.CleanConn()
+		clients = append(clients, client)
+	}
+	gossip := func() {
+		for _, client := range clients {
+			client.Gossip()
+		}
+	}
+
+	dynamoDBRequest(t, 9196, "CreateTable", `{"TableName": "Music",
+		"KeySchema": [{"AttributeName": "Artist", "KeyType": "HASH"}, {"AttributeName": "Song", "KeyType": "RANGE"}],
+		"AttributeDefinitions": [{"AttributeName": "Artist", "AttributeType": "S"}, {"AttributeName": "Song", "AttributeType": "S"}]}`)
+	gossip()
+
+	// with W and R of 1 and no gossip in between, writes of different songs
+	// through different nodes update the index of the hash key concurrently
+	put := func(port int, song string) {
+		item := `{"TableName": "Music", "Item": {"Artist": {"S": "Acme Band"}, "Song": {"S": "` + song + `"}}}`
+		if status, response := dynamoDBRequest(t, port, "PutItem", item); status != http.StatusOK {
+			t.Fatalf("TestDynamoDBConcurrentItems: PutItem returned %v %v", status, response.Type)
+		}
+	}
+	query := `{"TableName": "Music", "KeyConditionExpression": "Artist = :a",
+		"ExpressionAttributeValues": {":a": {"S": "Acme Band"}}}`
+	songs := func(port int) string {
+		_, response := dynamoDBRequest(t, port, "Query", query)
+		list := make([]string, 0, len(response.Items))
+		for _, item := range response.Items {
+			list = append(list, stringAttribute(item, "Song"))
+		}
+		return strings.Join(list, ",")
+	}
+	put(9196, "Happy Day")
+	put(9197, "Sad Night")
+	gossip()
+	if got := songs(9198); got != "Happy Day,Sad Night" {
+		t.Errorf("TestDynamoDBConcurrentItems: Query returned %v after concurrent writes", got)
+	}
+
+	// a delete concurrent with a write of another song stays deleted
+	key := `"Key": {"Artist": {"S": "Acme Band"}, "Song": {"S": "Happy Day"}}`
+	if status, response := dynamoDBRequest(t, 9196, "DeleteItem", `{"TableName": "Music", `+key+`}`); status != http.StatusOK {
+		t.Fatalf("TestDynamoDBConcurrentItems: DeleteItem returned %v %v", status, response.Type)
+	}
+	put(9197, "Blue Moon")
+	gossip()
+	if got := songs(9198); got != "Blue Moon,Sad Night" {
+		t.Errorf("TestDynamoDBConcurrentItems: Query returned %v after a concurrent delete", got)
+	}
+}
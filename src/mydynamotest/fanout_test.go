@@ -0,0 +1,124 @@
+package mydynamotest
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"mydynamo"
+	"net"
+	"net/http"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//Listens on port like a Dynamo node but never answers a request, so every
+//call to it hangs until the caller gives up
+func startHungNode(t *testing.T, port int) {
+	l, err := net.Listen("tcp", "localhost:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				// accept the CONNECT that rpc.DialHTTP sends, then swallow every call
+				if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+					conn.Close()
+					return
+				}
+				io.WriteString(conn, "HTTP/1.0 200 Connected to Go RPC\n\n")
+				io.Copy(ioutil.Discard, conn)
+			}(conn)
+		}
+	}()
+}
+
+//Starts two servers on basePort and basePort+1 and a hung node on basePort+2,
+//all three replicating every key
+func startClusterWithHungNode(t *testing.T, basePort int, w int, r int) {
+	nodes := make([]mydynamo.DynamoNode, 0, 3)
+	for idx := 0; idx < 2; idx++ {
+		port := strconv.Itoa(basePort + idx)
+		server := mydynamo.NewDynamoServerWithStorage(w, r, 3, "localhost", port, strconv.Itoa(idx), mydynamo.NewMemoryStorage())
+		go mydynamo.ServeDynamoServer(server)
+		nodes = append(nodes, mydynamo.NewDynamoNode("localhost", port))
+	}
+	startHungNode(t, basePort+2)
+	nodes = append(nodes, mydynamo.NewDynamoNode("localhost", strconv.Itoa(basePort+2)))
+	time.Sleep(500 * time.Millisecond)
+
+	preferenceList := append([]mydynamo.DynamoNode{}, nodes...)
+	for _, node := range nodes[:2] {
+		conn, err := rpc.DialHTTP("tcp", node.Address+":"+node.Port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var empty mydynamo.Empty
+		if err := conn.Call("MyDynamo.SendPreferenceList", preferenceList, &empty); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		preferenceList = mydynamo.RotateServerList(preferenceList)
+	}
+}
+
+func TestQuorumIgnoresHungReplica(t *testing.T) {
+	t.Logf("Starting hung replica quorum test")
+	startClusterWithHungNode(t, 9090, 2, 2)
+	clientInstance := MakeConnectedClient(9090)
+	defer clientInstance.CleanConn()
+
+	// W and R are met by the two healthy replicas without waiting on the hung one
+	start := time.Now()
+	if !clientInstance.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Errorf("TestQuorumIgnoresHungReplica: Put failed")
+	}
+	gotValuePtr := clientInstance.Get("s1")
+	if elapsed := time.Since(start); elapsed >= time.Duration(mydynamo.DEFAULT_REQUEST_TIMEOUT)*time.Millisecond {
+		t.Errorf("TestQuorumIgnoresHungReplica: Put and Get waited %v for the hung replica", elapsed)
+	}
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("abcde")) {
+		t.Errorf("TestQuorumIgnoresHungReplica: Failed to get value")
+	}
+
+	// the other healthy replica received the write without any gossip
+	otherClient := MakeConnectedClient(9091)
+	defer otherClient.CleanConn()
+	gotValuePtr = otherClient.Get("s1")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("abcde")) {
+		t.Errorf("TestQuorumIgnoresHungReplica: write did not reach the second replica")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	t.Logf("Starting request timeout test")
+	startClusterWithHungNode(t, 9093, 3, 3)
+	clientInstance := MakeConnectedClient(9093)
+	defer clientInstance.CleanConn()
+
+	// W needs the hung replica, so the Put fails once its request times out
+	timeout := time.Duration(mydynamo.DEFAULT_REQUEST_TIMEOUT) * time.Millisecond
+	start := time.Now()
+	if clientInstance.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Errorf("TestRequestTimeout: Put succeeded without W replicas")
+	}
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Errorf("TestRequestTimeout: Put blocked for %v", elapsed)
+	}
+
+	// the Get returns what the healthy replicas hold
+	start = time.Now()
+	gotValuePtr := clientInstance.Get("s1")
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Errorf("TestRequestTimeout: Get blocked for %v", elapsed)
+	}
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("abcde")) {
+		t.Errorf("TestRequestTimeout: Failed to get value")
+	}
+}
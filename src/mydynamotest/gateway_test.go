@@ -0,0 +1,101 @@
+package mydynamotest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mydynamo"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+//Sends a request for key to the gateway of the node on port, echoing context
+//if it is not empty, and returns the response with its body read
+func gatewayRequest(t *testing.T, method string, port int, key string, context string, body []byte) (*http.Response, []byte) {
+	url := "http://localhost:" + strconv.Itoa(port) + mydynamo.GATEWAY_PATH + key
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if context != "" {
+		req.Header.Set(mydynamo.CONTEXT_HEADER, context)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+func TestGateway(t *testing.T) {
+	t.Logf("Starting REST gateway test")
+	startLocalCluster(t, 9170, 3, 3, 3, 3)
+
+	if resp, _ := gatewayRequest(t, http.MethodGet, 9170, "s1", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("TestGateway: missing key returned %v", resp.Status)
+	}
+	if resp, _ := gatewayRequest(t, http.MethodPut, 9170, "s1", "", []byte("abcde")); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("TestGateway: PUT returned %v", resp.Status)
+	}
+	resp, body := gatewayRequest(t, http.MethodGet, 9171, "s1", "", nil)
+	context := resp.Header.Get(mydynamo.CONTEXT_HEADER)
+	if resp.StatusCode != http.StatusOK || string(body) != "abcde" || context == "" {
+		t.Fatalf("TestGateway: GET returned %v %s", resp.Status, body)
+	}
+
+	// the same stale context through the same node is rejected
+	if resp, _ := gatewayRequest(t, http.MethodPut, 9171, "s1", context, []byte("bcdef")); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("TestGateway: PUT with context returned %v", resp.Status)
+	}
+	if resp, _ := gatewayRequest(t, http.MethodPut, 9171, "s1", context, []byte("cdefg")); resp.StatusCode != http.StatusConflict {
+		t.Errorf("TestGateway: stale PUT returned %v", resp.Status)
+	}
+	if resp, _ := gatewayRequest(t, http.MethodPut, 9171, "s1", "not a context", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("TestGateway: malformed context returned %v", resp.Status)
+	}
+
+	// concurrent writes come back as siblings
+	gatewayRequest(t, http.MethodPut, 9170, "s2", "", []byte("abcde"))
+	gatewayRequest(t, http.MethodPut, 9172, "s2", "", []byte("bcdef"))
+	resp, body = gatewayRequest(t, http.MethodGet, 9170, "s2", "", nil)
+	var siblings []mydynamo.GatewaySibling
+	if resp.StatusCode != http.StatusMultipleChoices || json.Unmarshal(body, &siblings) != nil || len(siblings) != 2 {
+		t.Fatalf("TestGateway: GET of siblings returned %v %s", resp.Status, body)
+	}
+	gatewayRequest(t, http.MethodPut, 9170, "s2", resp.Header.Get(mydynamo.CONTEXT_HEADER), []byte("cdefg"))
+	if resp, body := gatewayRequest(t, http.MethodGet, 9171, "s2", "", nil); resp.StatusCode != http.StatusOK || string(body) != "cdefg" {
+		t.Errorf("TestGateway: siblings were not replaced: %v %s", resp.Status, body)
+	}
+
+	resp, _ = gatewayRequest(t, http.MethodGet, 9170, "s2", "", nil)
+	if resp, _ := gatewayRequest(t, http.MethodDelete, 9170, "s2", resp.Header.Get(mydynamo.CONTEXT_HEADER), nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("TestGateway: DELETE returned %v", resp.Status)
+	}
+	if resp, _ := gatewayRequest(t, http.MethodGet, 9170, "s2", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("TestGateway: deleted key returned %v", resp.Status)
+	}
+	if resp, _ := gatewayRequest(t, http.MethodPost, 9170, "s2", "", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("TestGateway: POST returned %v", resp.Status)
+	}
+}
+
+func TestGatewayQuorumFailure(t *testing.T) {
+	t.Logf("Starting REST gateway quorum test")
+	startLocalCluster(t, 9173, 3, 3, 3, 3)
+	clientInstance := MakeConnectedClient(9175)
+	defer clientInstance.CleanConn()
+	clientInstance.Crash(2)
+
+	if resp, _ := gatewayRequest(t, http.MethodPut, 9173, "s1", "", []byte("abcde")); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("TestGatewayQuorumFailure: PUT without a quorum returned %v", resp.Status)
+	}
+	if resp, _ := gatewayRequest(t, http.MethodGet, 9175, "s1", "", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("TestGatewayQuorumFailure: GET from a crashed node returned %v", resp.Status)
+	}
+}
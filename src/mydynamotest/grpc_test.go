@@ -0,0 +1,113 @@
+package mydynamotest
+
+import (
+	"context"
+	"errors"
+	"mydynamo"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//Returns a gRPC client connected to the node on port
+func makeGRPCClient(t *testing.T, port string) *mydynamo.GRPCClient {
+	client := mydynamo.NewGRPCClient("localhost:" + port)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGRPC(t *testing.T) {
+	t.Logf("Starting gRPC test")
+	startLocalCluster(t, 9190, 3, 2, 2, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client0 := makeGRPCClient(t, "9190")
+	client1 := makeGRPCClient(t, "9191")
+
+	if err := client0.Put(ctx, mydynamo.NewPutArgs("s1", mydynamo.NewContext(mydynamo.NewVectorClock()), []byte("abcde"))); err != nil {
+		t.Fatalf("TestGRPC: Put failed: %v", err)
+	}
+	result, err := client1.Get(ctx, "s1")
+	if err != nil || len(result.EntryList) != 1 || string(result.EntryList[0].Value) != "abcde" {
+		t.Fatalf("TestGRPC: Get returned %v, %v", result, err)
+	}
+	stale := result.EntryList[0].Context
+	client1.Put(ctx, mydynamo.NewPutArgs("s1", stale, []byte("bcdef")))
+	if err := client1.Put(ctx, mydynamo.NewPutArgs("s1", stale, []byte("cdefg"))); !errors.Is(err, mydynamo.ErrStaleContext) {
+		t.Errorf("TestGRPC: stale Put returned %v", err)
+	}
+
+	// every field of an entry survives the protobuf encoding
+	entries := sampleResult().EntryList
+	for i := range entries {
+		entries[i].Context.Clock.Elements["9"] = i + 1
+	}
+	entries[0].Value = []byte{}
+	for _, entry := range entries {
+		value := mydynamo.NewPutArgs("s2", entry.Context, entry.Value)
+		value.Tombstone, value.Timestamp, value.CRDT = entry.Tombstone, entry.Timestamp, entry.CRDT
+		if err := client0.PutOnce(ctx, value); err != nil {
+			t.Fatalf("TestGRPC: PutOnce failed: %v", err)
+		}
+	}
+	result, err = client0.GetOnce(ctx, "s2")
+	if err != nil || !reflect.DeepEqual(result.EntryList, entries) {
+		t.Errorf("TestGRPC: GetOnce returned %v, %v, want %v", result, err, entries)
+	}
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if _, err := client0.Get(expired, "s1"); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("TestGRPC: Get past its deadline returned %v", err)
+	}
+	if err := client0.Gossip(ctx); err != nil {
+		t.Errorf("TestGRPC: Gossip failed: %v", err)
+	}
+}
+
+func TestGRPCStreams(t *testing.T) {
+	t.Logf("Starting gRPC streaming test")
+	startLocalCluster(t, 9193, 3, 2, 2, 3)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := makeGRPCClient(t, "9193")
+
+	values := make([]mydynamo.PutArgs, 0)
+	keys := make([]string, 0)
+	for i := 0; i < 200; i++ {
+		clock := mydynamo.NewVectorClock()
+		clock.Increment("0")
+		key := "s" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		values = append(values, mydynamo.NewPutArgs(key, mydynamo.NewContext(clock), []byte(key)))
+		keys = append(keys, key)
+	}
+	if stored, rejected, err := client.PutOnceStream(ctx, values); err != nil || stored != len(values) || rejected != 0 {
+		t.Fatalf("TestGRPCStreams: PutOnceStream stored %v, rejected %v, %v", stored, rejected, err)
+	}
+	// the same versions again are stale
+	if stored, rejected, err := client.PutOnceStream(ctx, values[:10]); err != nil || stored != 0 || rejected != 10 {
+		t.Errorf("TestGRPCStreams: repeated PutOnceStream stored %v, rejected %v, %v", stored, rejected, err)
+	}
+	results, err := client.GetOnceStream(ctx, keys)
+	if err != nil || len(results) != len(keys) {
+		t.Fatalf("TestGRPCStreams: GetOnceStream returned %v results, %v", len(results), err)
+	}
+	for i, result := range results {
+		if len(result.EntryList) != 1 || string(result.EntryList[0].Value) != keys[i] {
+			t.Errorf("TestGRPCStreams: %v returned %v", keys[i], result)
+		}
+	}
+
+	if err := client.Crash(ctx, 1); err != nil {
+		t.Fatalf("TestGRPCStreams: Crash failed: %v", err)
+	}
+	if _, _, err := client.PutOnceStream(ctx, values[:1]); !errors.Is(err, mydynamo.ErrNodeOffline) {
+		t.Errorf("TestGRPCStreams: PutOnceStream to a crashed node returned %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package mydynamotest
+
+import (
+	"io"
+	"mydynamo"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//Returns the ports of the n nodes that replicate key in a cluster of the nodes on ports
+func replicaPorts(key string, ports []int, n int) []int {
+	nodes := make([]mydynamo.DynamoNode, 0, len(ports))
+	for _, port := range ports {
+		nodes = append(nodes, mydynamo.NewDynamoNode("localhost", strconv.Itoa(port)))
+	}
+	replicas := make([]int, 0, n)
+	for _, node := range mydynamo.NewRing(nodes, mydynamo.VIRTUAL_NODES).PreferenceList(key, n) {
+		port, _ := strconv.Atoi(node.Port)
+		replicas = append(replicas, port)
+	}
+	return replicas
+}
+
+//Checks that every key can be read through port and is stored on its replicas
+//among ports
+func checkPlacement(t *testing.T, keys []string, ports []int, port int) {
+	clientInstance := MakeConnectedClient(port)
+	for _, key := range keys {
+		gotValuePtr := clientInstance.Get(key)
+		if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte(key)) {
+			t.Errorf("checkPlacement: failed to get %v through %v", key, port)
+			continue
+		}
+		stored := getOnceAll(t, key, 4)
+		for _, replica := range replicaPorts(key, ports, 2) {
+			if len(stored[replica-8080]) != 1 {
+				t.Errorf("checkPlacement: replica %v does not hold %v", replica, key)
+			}
+		}
+	}
+}
+
+func TestJoinLeave(t *testing.T) {
+	t.Logf("Starting join and leave test")
+	cmd := InitDynamoServer("./join.ini")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	keys := make([]string, 0)
+	clientInstance := MakeConnectedClient(8080)
+	for i := 0; i < 20; i++ {
+		key := "s" + strconv.Itoa(i)
+		keys = append(keys, key)
+		if !clientInstance.Put(PutFreshContext(key, []byte(key))) {
+			t.Fatalf("TestJoinLeave: Put of %v failed", key)
+		}
+	}
+
+	// the new node on 8083 takes over part of the ring, while writes keep coming in
+	io.WriteString(stdin, "join\n")
+	for i := 0; i < 50; i++ {
+		key := "t" + strconv.Itoa(i)
+		keys = append(keys, key)
+		if !clientInstance.Put(PutFreshContext(key, []byte(key))) {
+			t.Errorf("TestJoinLeave: Put of %v during join failed", key)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+	checkPlacement(t, keys, []int{8080, 8081, 8082, 8083}, 8083)
+
+	// 8081 hands its keys to the nodes that replicate them without it
+	io.WriteString(stdin, "leave 8081\n")
+	time.Sleep(2 * time.Second)
+	checkPlacement(t, keys, []int{8080, 8082, 8083}, 8080)
+	if MakeConnectedClient(8081).Put(PutFreshContext("s0", []byte("abcde"))) {
+		t.Errorf("TestJoinLeave: node accepted a Put after leaving")
+	}
+}
+
+func TestLeaveLegacyServer(t *testing.T) {
+	t.Logf("Starting legacy server leave test")
+	// without a cluster size NewDynamoServer replicates every key to every node
+	size := mydynamo.GetClusterSize()
+	mydynamo.SetClusterSize(0)
+	defer mydynamo.SetClusterSize(size)
+	nodes := make([]mydynamo.DynamoNode, 0, 3)
+	for idx := 0; idx < 3; idx++ {
+		port := strconv.Itoa(9203 + idx)
+		go mydynamo.ServeDynamoServer(mydynamo.NewDynamoServer(1, 1, "localhost", port, strconv.Itoa(idx)))
+		nodes = append(nodes, mydynamo.NewDynamoNode("localhost", port))
+	}
+	time.Sleep(500 * time.Millisecond)
+	preferenceList := append([]mydynamo.DynamoNode{}, nodes...)
+	for _, node := range nodes {
+		conn, err := rpc.DialHTTP("tcp", node.Address+":"+node.Port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var empty mydynamo.Empty
+		if err := conn.Call("MyDynamo.SendPreferenceList", preferenceList, &empty); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		preferenceList = mydynamo.RotateServerList(preferenceList)
+	}
+
+	clientInstance := MakeConnectedClient(9205)
+	defer clientInstance.CleanConn()
+	if !clientInstance.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Fatalf("TestLeaveLegacyServer: Put failed")
+	}
+	if !clientInstance.Leave() {
+		t.Fatalf("TestLeaveLegacyServer: Leave failed")
+	}
+	otherClient := MakeConnectedClient(9203)
+	defer otherClient.CleanConn()
+	gotValuePtr := otherClient.Get("s1")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("abcde")) {
+		t.Errorf("TestLeaveLegacyServer: the key was lost when the node left")
+	}
+	if clientInstance.Put(PutFreshContext("s1", []byte("bcdef"))) {
+		t.Errorf("TestLeaveLegacyServer: node accepted a Put after leaving")
+	}
+}
@@ -0,0 +1,89 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//Returns the member of view listening on port
+func findMember(t *testing.T, view []mydynamo.Member, port int) mydynamo.Member {
+	for _, member := range view {
+		if member.Node.Port == strconv.Itoa(port) {
+			return member
+		}
+	}
+	t.Fatalf("findMember: %v is not in the view", port)
+	return mydynamo.Member{}
+}
+
+func TestMembershipMerge(t *testing.T) {
+	t.Logf("Starting membership merge test")
+	nodes := makeNodeList(3)
+	view := mydynamo.NewMembership(nodes[0], nodes)
+
+	view.Merge([]mydynamo.Member{{Node: nodes[1], Incarnation: 0, Heartbeat: 5}})
+	if member := findMember(t, view.View(), 8081); member.Heartbeat != 5 {
+		t.Errorf("TestMembershipMerge: newer heartbeat was not merged")
+	}
+	view.Merge([]mydynamo.Member{{Node: nodes[1], Incarnation: 0, Heartbeat: 3}})
+	if member := findMember(t, view.View(), 8081); member.Heartbeat != 5 {
+		t.Errorf("TestMembershipMerge: older heartbeat replaced a newer one")
+	}
+
+	// a new incarnation wins even with a lower heartbeat
+	view.Merge([]mydynamo.Member{{Node: nodes[1], Incarnation: 1, Heartbeat: 1}})
+	if member := findMember(t, view.View(), 8081); member.Incarnation != 1 || member.Heartbeat != 1 {
+		t.Errorf("TestMembershipMerge: new incarnation was not merged")
+	}
+
+	// only a node itself advances its own state
+	view.Merge([]mydynamo.Member{{Node: nodes[0], Incarnation: 7, Status: mydynamo.MEMBER_DEAD}})
+	if member := findMember(t, view.View(), 8080); member.Incarnation != 0 || member.Status != mydynamo.MEMBER_ALIVE {
+		t.Errorf("TestMembershipMerge: a peer changed this node's own state")
+	}
+}
+
+func TestFailureDetection(t *testing.T) {
+	t.Logf("Starting failure detection test")
+	cmd := InitDynamoServer("./membership.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	clientInstance := MakeConnectedClient(8080)
+	view := clientInstance.Membership()
+	if len(view) != 3 {
+		t.Fatalf("TestFailureDetection: view has %v members, expected 3", len(view))
+	}
+	for _, member := range view {
+		if member.Status != mydynamo.MEMBER_ALIVE {
+			t.Errorf("TestFailureDetection: %v is %v before any crash", member.Node.Port, member.Status)
+		}
+	}
+
+	MakeConnectedClient(8082).Crash(4)
+	time.Sleep(2 * time.Second)
+	if member := findMember(t, clientInstance.Membership(), 8082); member.Status != mydynamo.MEMBER_DEAD {
+		t.Errorf("TestFailureDetection: crashed node is %v, expected dead", member.Status)
+	}
+
+	// writes skip the dead node and still reach W through the live one
+	if !clientInstance.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Errorf("TestFailureDetection: Put failed with one node dead")
+	}
+
+	// once it recovers, the node comes back with a new incarnation
+	time.Sleep(4 * time.Second)
+	member := findMember(t, clientInstance.Membership(), 8082)
+	if member.Status != mydynamo.MEMBER_ALIVE {
+		t.Errorf("TestFailureDetection: recovered node is %v, expected alive", member.Status)
+	}
+	if member.Incarnation < 1 {
+		t.Errorf("TestFailureDetection: recovered node kept incarnation %v", member.Incarnation)
+	}
+}
@@ -0,0 +1,124 @@
+package mydynamotest
+
+import (
+	"bytes"
+	"mydynamo"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMerkleRootOrderIndependent(t *testing.T) {
+	t.Logf("Starting Merkle root order test")
+	siblings := makeSiblings()
+	reversed := []mydynamo.ObjectEntry{siblings[1], siblings[0]}
+
+	tree1 := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s1": siblings, "s2": siblings[:1]})
+	tree2 := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s2": siblings[:1], "s1": reversed})
+	if !bytes.Equal(tree1.Root(), tree2.Root()) {
+		t.Errorf("TestMerkleRootOrderIndependent: roots differ for the same data")
+	}
+}
+
+func TestMerkleRootDetectsDifference(t *testing.T) {
+	t.Logf("Starting Merkle root difference test")
+	siblings := makeSiblings()
+	tree := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s1": siblings})
+
+	missing := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s1": siblings[:1]})
+	if bytes.Equal(tree.Root(), missing.Root()) {
+		t.Errorf("TestMerkleRootDetectsDifference: root did not change when a sibling was missing")
+	}
+
+	tombstoned := []mydynamo.ObjectEntry{siblings[0], siblings[1]}
+	tombstoned[1].Tombstone = true
+	deleted := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s1": tombstoned})
+	if bytes.Equal(tree.Root(), deleted.Root()) {
+		t.Errorf("TestMerkleRootDetectsDifference: root did not change when a sibling became a tombstone")
+	}
+
+	empty := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{})
+	if bytes.Equal(tree.Root(), empty.Root()) {
+		t.Errorf("TestMerkleRootDetectsDifference: root of an empty tree matched a populated one")
+	}
+}
+
+func TestMerkleUpdateMatchesRebuild(t *testing.T) {
+	t.Logf("Starting Merkle update test")
+	siblings := makeSiblings()
+	tree := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{})
+	tree.Update("s1", siblings)
+	tree.Update("s2", siblings[:1])
+	rebuilt := mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s1": siblings, "s2": siblings[:1]})
+	if !bytes.Equal(tree.Root(), rebuilt.Root()) {
+		t.Errorf("TestMerkleUpdateMatchesRebuild: updated root differs from a rebuilt one")
+	}
+
+	tombstoned := []mydynamo.ObjectEntry{siblings[0], siblings[1]}
+	tombstoned[1].Tombstone = true
+	tree.Update("s1", tombstoned)
+	tree.Update("s2", nil)
+	tree.Update("s3", nil)
+	rebuilt = mydynamo.NewMerkleTree(map[string][]mydynamo.ObjectEntry{"s1": tombstoned})
+	if !bytes.Equal(tree.Root(), rebuilt.Root()) {
+		t.Errorf("TestMerkleUpdateMatchesRebuild: root after replacing and removing keys differs from a rebuilt one")
+	}
+}
+
+//Stores value on the node at port alone, bypassing replication
+func putOnceAt(t *testing.T, port int, value mydynamo.PutArgs) {
+	conn, err := rpc.DialHTTP("tcp", "localhost:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var result bool
+	if err := conn.Call("MyDynamo.PutOnce", value, &result); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAntiEntropy(t *testing.T) {
+	t.Logf("Starting anti-entropy test")
+	cmd := InitDynamoServer("./antientropy.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	// s1 is only on node 0, s2 has concurrent versions on nodes 1 and 2
+	putOnceAt(t, 8080, PutFreshContext("s1", []byte("abcde")))
+	value1 := PutFreshContext("s2", []byte("efghi"))
+	value1.Context.Clock.Increment("1")
+	putOnceAt(t, 8081, value1)
+	value2 := PutFreshContext("s2", []byte("jklmn"))
+	value2.Context.Clock.Increment("2")
+	putOnceAt(t, 8082, value2)
+
+	MakeConnectedClient(8080).AntiEntropy()
+	MakeConnectedClient(8081).AntiEntropy()
+
+	for i, entries := range getOnceAll(t, "s1", 3) {
+		if len(entries) != 1 || !valuesEqual(entries[0].Value, []byte("abcde")) {
+			t.Errorf("TestAntiEntropy: node %v did not receive s1", i)
+		}
+	}
+	for i, entries := range getOnceAll(t, "s2", 3) {
+		if len(entries) != 2 {
+			t.Errorf("TestAntiEntropy: node %v holds %v versions of s2, expected 2", i, len(entries))
+		}
+	}
+
+	// a write after the trees were built only updates its own leaf, and the
+	// next round still finds it
+	putOnceAt(t, 8082, PutFreshContext("s3", []byte("opqrs")))
+	MakeConnectedClient(8082).AntiEntropy()
+	for i, entries := range getOnceAll(t, "s3", 3) {
+		if len(entries) != 1 || !valuesEqual(entries[0].Value, []byte("opqrs")) {
+			t.Errorf("TestAntiEntropy: node %v did not receive s3", i)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//Sends each node its preference list, as DynamoCoordinator does
+func sendPreferenceLists(t *testing.T, nodes []mydynamo.DynamoNode, preferenceList []mydynamo.DynamoNode) {
+	for _, node := range nodes {
+		conn, err := rpc.DialHTTP("tcp", node.Address+":"+node.Port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var empty mydynamo.Empty
+		if err := conn.Call("MyDynamo.SendPreferenceList", preferenceList, &empty); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+}
+
+func TestLazyPeerConnection(t *testing.T) {
+	t.Logf("Starting lazy peer connection test")
+	nodes := make([]mydynamo.DynamoNode, 0, 3)
+	servers := make([]mydynamo.DynamoServer, 0, 3)
+	for idx := 0; idx < 3; idx++ {
+		port := strconv.Itoa(9130 + idx)
+		servers = append(servers, mydynamo.NewDynamoServerWithStorage(3, 1, 3, "localhost", port, strconv.Itoa(idx), mydynamo.NewMemoryStorage()))
+		nodes = append(nodes, mydynamo.NewDynamoNode("localhost", port))
+	}
+
+	// the third node is not up when the others learn the membership
+	go mydynamo.ServeDynamoServer(servers[0])
+	go mydynamo.ServeDynamoServer(servers[1])
+	time.Sleep(500 * time.Millisecond)
+	sendPreferenceLists(t, nodes[:2], nodes)
+
+	clientInstance := MakeConnectedClient(9130)
+	defer clientInstance.CleanConn()
+	if clientInstance.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Errorf("TestLazyPeerConnection: Put met W=3 with a node down")
+	}
+
+	go mydynamo.ServeDynamoServer(servers[2])
+	time.Sleep(500 * time.Millisecond)
+	sendPreferenceLists(t, nodes[2:], nodes)
+
+	// the first node dials the third once its backoff has passed
+	deadline := time.Now().Add(time.Duration(mydynamo.MAX_PEER_RETRY_BACKOFF+1000) * time.Millisecond)
+	written := false
+	for !written && time.Now().Before(deadline) {
+		written = clientInstance.Put(PutFreshContext("s"+strconv.Itoa(time.Now().Nanosecond()), []byte("bcdef")))
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !written {
+		t.Errorf("TestLazyPeerConnection: first node never connected to the third")
+	}
+}
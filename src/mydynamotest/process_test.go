@@ -0,0 +1,79 @@
+package mydynamotest
+
+import (
+	"io"
+	"mydynamo"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNodeProcesses(t *testing.T) {
+	t.Logf("Starting node process test")
+	cmd := InitDynamoServer("./processes.ini")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer func() {
+		// the node processes exit once the coordinator closes their stdin
+		KillDynamoServer(cmd)
+		time.Sleep(time.Second)
+	}()
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	clientInstance := MakeConnectedClient(8080)
+	if members := clientInstance.Members(); len(members) != 3 {
+		t.Fatalf("TestNodeProcesses: nodes started with members %v", members)
+	}
+	for i := 0; i < 10; i++ {
+		key := "s" + strconv.Itoa(i)
+		if !clientInstance.Put(PutFreshContext(key, []byte(key))) {
+			t.Fatalf("TestNodeProcesses: Put of %v failed", key)
+		}
+	}
+
+	// the process dies with SIGKILL, the others keep serving
+	io.WriteString(stdin, "kill 8081\n")
+	time.Sleep(500 * time.Millisecond)
+	if conn, err := net.Dial("tcp", "localhost:8081"); err == nil {
+		conn.Close()
+		t.Fatalf("TestNodeProcesses: killed node still accepts connections")
+	}
+	time.Sleep(time.Second)
+	if member := findMember(t, clientInstance.Membership(), 8081); member.Status != mydynamo.MEMBER_DEAD {
+		t.Errorf("TestNodeProcesses: killed node is %v, expected dead", member.Status)
+	}
+	if !clientInstance.Put(PutFreshContext("t0", []byte("t0"))) {
+		t.Errorf("TestNodeProcesses: Put failed with one node killed")
+	}
+	for _, key := range []string{"s0", "t0"} {
+		gotValuePtr := clientInstance.Get(key)
+		if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte(key)) {
+			t.Errorf("TestNodeProcesses: Get of %v failed with one node killed", key)
+		}
+	}
+
+	// the coordinator restarts the process, which rejoins with a new incarnation
+	// and copies back the keys it lost, including the one written while it was down
+	time.Sleep(4 * time.Second)
+	restarted := MakeConnectedClient(8081)
+	defer restarted.CleanConn()
+	if members := restarted.Members(); len(members) != 3 {
+		t.Fatalf("TestNodeProcesses: restarted node has members %v", members)
+	}
+	member := findMember(t, clientInstance.Membership(), 8081)
+	if member.Status != mydynamo.MEMBER_ALIVE || member.Incarnation < 1 {
+		t.Errorf("TestNodeProcesses: restarted node is %v with incarnation %v", member.Status, member.Incarnation)
+	}
+	for _, key := range []string{"s0", "s9", "t0"} {
+		if stored := getOnceAll(t, key, 3)[1]; len(stored) != 1 || !valuesEqual(stored[0].Value, []byte(key)) {
+			t.Errorf("TestNodeProcesses: restarted node stores %v for %v", stored, key)
+		}
+	}
+}
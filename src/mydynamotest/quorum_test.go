@@ -0,0 +1,41 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"testing"
+)
+
+func TestValidateQuorum(t *testing.T) {
+	// valid configurations
+	if err := mydynamo.ValidateQuorum(2, 2, 3, 10); err != nil {
+		t.Errorf("TestValidateQuorum: rejected valid config: %v", err)
+	}
+	if err := mydynamo.ValidateQuorum(1, 1, 5, 5); err != nil {
+		t.Errorf("TestValidateQuorum: rejected valid config: %v", err)
+	}
+
+	// R and W can not exceed N
+	if mydynamo.ValidateQuorum(4, 2, 3, 10) == nil {
+		t.Errorf("TestValidateQuorum: accepted r_value > n_value")
+	}
+	if mydynamo.ValidateQuorum(2, 4, 3, 10) == nil {
+		t.Errorf("TestValidateQuorum: accepted w_value > n_value")
+	}
+
+	// N must fit in the cluster
+	if mydynamo.ValidateQuorum(1, 1, 6, 5) == nil {
+		t.Errorf("TestValidateQuorum: accepted n_value > cluster_size")
+	}
+	if mydynamo.ValidateQuorum(0, 1, 3, 5) == nil {
+		t.Errorf("TestValidateQuorum: accepted r_value of 0")
+	}
+}
+
+func TestIsStrictQuorum(t *testing.T) {
+	if !mydynamo.IsStrictQuorum(2, 2, 3) {
+		t.Errorf("TestIsStrictQuorum: R=2 W=2 N=3 should overlap")
+	}
+	if mydynamo.IsStrictQuorum(1, 1, 3) {
+		t.Errorf("TestIsStrictQuorum: R=1 W=1 N=3 should not overlap")
+	}
+}
@@ -0,0 +1,87 @@
+package mydynamotest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadRepair(t *testing.T) {
+	t.Logf("Starting read repair test")
+	cmd := InitDynamoServer("./readrepair.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	// node 0 holds a newer version than node 1, and node 2 holds nothing
+	older := PutFreshContext("s1", []byte("abcde"))
+	older.Context.Clock.Increment("0")
+	putOnceAt(t, 8080, older)
+	putOnceAt(t, 8081, older)
+	newer := PutFreshContext("s1", []byte("efghi"))
+	newer.Context.Clock.Increment("0")
+	newer.Context.Clock.Increment("0")
+	putOnceAt(t, 8080, newer)
+
+	clientInstance := MakeConnectedClient(8080)
+	gotValuePtr := clientInstance.Get("s1")
+	if gotValuePtr == nil {
+		t.Fatalf("TestReadRepair: Failed to get")
+	}
+	gotValue := *gotValuePtr
+	if len(gotValue.EntryList) != 1 || !valuesEqual(gotValue.EntryList[0].Value, []byte("efghi")) {
+		t.Errorf("TestReadRepair: Get did not return the newest version")
+	}
+	for i, entries := range getOnceAll(t, "s1", 3) {
+		if len(entries) != 1 || !valuesEqual(entries[0].Value, []byte("efghi")) {
+			t.Errorf("TestReadRepair: node %v was not repaired", i)
+		}
+	}
+	if repairs := clientInstance.ReadRepairs(); repairs != 2 {
+		t.Errorf("TestReadRepair: %v repairs counted, expected 2", repairs)
+	}
+
+	// the replicas agree now, so reading again repairs nothing
+	clientInstance.Get("s1")
+	if repairs := clientInstance.ReadRepairs(); repairs != 2 {
+		t.Errorf("TestReadRepair: %v repairs counted after a consistent read, expected 2", repairs)
+	}
+}
+
+func TestAsyncReadRepair(t *testing.T) {
+	t.Logf("Starting asynchronous read repair test")
+	cmd := InitDynamoServer("./asyncrepair.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	// a tombstone only on node 1 reaches the other replicas through a read
+	deleted := PutFreshContext("s1", []byte{})
+	deleted.Context.Clock.Increment("1")
+	deleted.Tombstone = true
+	putOnceAt(t, 8081, deleted)
+
+	clientInstance := MakeConnectedClient(8082)
+	gotValuePtr := clientInstance.Get("s1")
+	if gotValuePtr == nil {
+		t.Fatalf("TestAsyncReadRepair: Failed to get")
+	}
+	if len(gotValuePtr.EntryList) != 0 {
+		t.Errorf("TestAsyncReadRepair: Get returned a deleted key")
+	}
+
+	time.Sleep(time.Second)
+	for i, entries := range getOnceAll(t, "s1", 3) {
+		if len(entries) != 1 || !entries[0].Tombstone {
+			t.Errorf("TestAsyncReadRepair: node %v did not receive the tombstone", i)
+		}
+	}
+	if repairs := clientInstance.ReadRepairs(); repairs != 2 {
+		t.Errorf("TestAsyncReadRepair: %v repairs counted, expected 2", repairs)
+	}
+}
@@ -143,8 +143,11 @@ func TestDynamoPaper(t *testing.T){
     }
 
     clientInstance0.Gossip()
-    clientInstance1.Put(mydynamo.NewPutArgs("s1", gotValue.EntryList[0].Context, []byte("cdefg")))
-    clientInstance2.Put(mydynamo.NewPutArgs("s1", gotValue.EntryList[0].Context, []byte("defgh")))
+    // a Put is sent to every replica at once, so each of the two concurrent
+    // writes is made while the other node is crashed and can not receive it
+    context := gotValue.EntryList[0].Context
+    clientInstance2.Crash(1)
+    clientInstance1.Put(mydynamo.NewPutArgs("s1", context, []byte("cdefg")))
     gotValuePtr = clientInstance1.Get("s1")
     if gotValuePtr == nil {
         t.Fail()
@@ -155,6 +158,9 @@ func TestDynamoPaper(t *testing.T){
         t.Fail()
         t.Logf("TestDynamoPaper: Third value doesn't match")
     }
+    time.Sleep(1500 * time.Millisecond)
+    clientInstance1.Crash(1)
+    clientInstance2.Put(mydynamo.NewPutArgs("s1", context, []byte("defgh")))
     gotValuePtr = clientInstance2.Get("s1")
     if gotValuePtr == nil {
         t.Fail()
@@ -165,6 +171,7 @@ func TestDynamoPaper(t *testing.T){
         t.Fail()
         t.Logf("TestDynamoPaper: Fourth value doesn't match")
     }
+    time.Sleep(1500 * time.Millisecond)
     clientInstance1.Gossip()
     clientInstance2.Gossip()
     gotValuePtr = clientInstance0.Get("s1")
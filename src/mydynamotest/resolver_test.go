@@ -0,0 +1,119 @@
+package mydynamotest
+
+import (
+	"context"
+	"mydynamo"
+	"testing"
+	"time"
+)
+
+//Returns an entry holding value, written by node at the given time
+func makeSibling(node string, value string, timestamp int64) mydynamo.ObjectEntry {
+	clock := mydynamo.NewVectorClock()
+	clock.Increment(node)
+	entry := mydynamo.NewObjectEntry(mydynamo.NewContext(clock), []byte(value))
+	entry.Timestamp = timestamp
+	return entry
+}
+
+func TestBuiltinResolvers(t *testing.T) {
+	siblings := []mydynamo.ObjectEntry{makeSibling("0", "9", 2), makeSibling("1", "10", 1)}
+	if value, _ := mydynamo.LastWriterWins.Resolve("s1", siblings); string(value) != "9" {
+		t.Errorf("TestBuiltinResolvers: last writer wins picked %s", value)
+	}
+	if value, _ := mydynamo.MaxValue.Resolve("s1", siblings); string(value) != "10" {
+		t.Errorf("TestBuiltinResolvers: max value picked %s", value)
+	}
+
+	sets := []mydynamo.ObjectEntry{makeSibling("0", `["a", "b"]`, 1), makeSibling("1", `["c","b"]`, 2)}
+	if value, err := mydynamo.JSONSetUnion.Resolve("s1", sets); err != nil || string(value) != `["a","b","c"]` {
+		t.Errorf("TestBuiltinResolvers: set union returned %s, %v", value, err)
+	}
+	if _, err := mydynamo.JSONSetUnion.Resolve("s1", siblings[:1]); err == nil {
+		t.Errorf("TestBuiltinResolvers: set union accepted a value that is not an array")
+	}
+
+	merged, ok, err := mydynamo.ResolveSiblings("s1", mydynamo.DynamoResult{EntryList: siblings}, mydynamo.MaxValue)
+	if !ok || err != nil {
+		t.Fatalf("TestBuiltinResolvers: siblings were not resolved: %v", err)
+	}
+	for _, sibling := range siblings {
+		if !sibling.Context.Clock.LessThan(merged.Context.Clock) {
+			t.Errorf("TestBuiltinResolvers: merged context does not descend from every sibling")
+		}
+	}
+	if _, ok, _ := mydynamo.ResolveSiblings("s1", mydynamo.DynamoResult{EntryList: siblings[:1]}, mydynamo.MaxValue); ok {
+		t.Errorf("TestBuiltinResolvers: a single version was resolved")
+	}
+}
+
+func TestResolverWriteBack(t *testing.T) {
+	t.Logf("Starting resolver write-back test")
+	startLocalCluster(t, 9140, 3, 1, 1, 3)
+	clientInstance0 := MakeConnectedClient(9140)
+	defer clientInstance0.CleanConn()
+	clientInstance1 := MakeConnectedClient(9141)
+	defer clientInstance1.CleanConn()
+
+	// two fresh writes through different nodes are siblings
+	clientInstance0.Put(PutFreshContext("cart", []byte(`["apple"]`)))
+	clientInstance1.Put(PutFreshContext("cart", []byte(`["pear"]`)))
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+
+	// and a delete concurrent with both leaves a tombstone sibling
+	deleted := PutFreshContext("cart", []byte{})
+	deleted.Context.Clock.Increment("deleter")
+	deleted.Tombstone = true
+	for port := 9140; port < 9143; port++ {
+		putOnceAt(t, port, deleted)
+	}
+
+	clusterClient := mydynamo.NewClusterClient([]mydynamo.DynamoNode{mydynamo.NewDynamoNode("localhost", "9140")})
+	defer clusterClient.Close()
+	clusterClient.Resolver = mydynamo.JSONSetUnion
+	gotValue, err := clusterClient.Get(context.Background(), "cart")
+	if err != nil || len(gotValue.EntryList) != 1 || string(gotValue.EntryList[0].Value) != `["apple","pear"]` {
+		t.Fatalf("TestResolverWriteBack: Get returned %v, %v", gotValue, err)
+	}
+	if !deleted.Context.Clock.LessThan(gotValue.EntryList[0].Context.Clock) {
+		t.Errorf("TestResolverWriteBack: merged context does not descend from the tombstone")
+	}
+
+	// the merged value replaced the siblings
+	gotValuePtr := clientInstance1.Get("cart")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 {
+		t.Errorf("TestResolverWriteBack: siblings were not replaced")
+	}
+}
+
+func TestServerResolver(t *testing.T) {
+	t.Logf("Starting server resolver test")
+	mydynamo.RegisterResolver("lww_", mydynamo.LastWriterWins)
+	defer mydynamo.RegisterResolver("lww_", nil)
+	startLocalCluster(t, 9143, 3, 1, 1, 3)
+	clientInstance0 := MakeConnectedClient(9143)
+	defer clientInstance0.CleanConn()
+	clientInstance1 := MakeConnectedClient(9144)
+	defer clientInstance1.CleanConn()
+
+	clientInstance0.Put(PutFreshContext("lww_s1", []byte("abcde")))
+	time.Sleep(10 * time.Millisecond)
+	clientInstance1.Put(PutFreshContext("lww_s1", []byte("bcdef")))
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+
+	gotValuePtr := clientInstance0.Get("lww_s1")
+	if gotValuePtr == nil || len(gotValuePtr.EntryList) != 1 || !valuesEqual(gotValuePtr.EntryList[0].Value, []byte("bcdef")) {
+		t.Errorf("TestServerResolver: Get did not resolve to the last write: %v", gotValuePtr)
+	}
+
+	// keys outside the prefix keep their siblings
+	clientInstance0.Put(PutFreshContext("s1", []byte("abcde")))
+	clientInstance1.Put(PutFreshContext("s1", []byte("bcdef")))
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+	if gotValuePtr := clientInstance0.Get("s1"); gotValuePtr == nil || len(gotValuePtr.EntryList) != 2 {
+		t.Errorf("TestServerResolver: siblings outside the prefix were resolved")
+	}
+}
@@ -0,0 +1,127 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"net/rpc"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func makeNodeList(size int) []mydynamo.DynamoNode {
+	nodes := make([]mydynamo.DynamoNode, 0)
+	for i := 0; i < size; i++ {
+		nodes = append(nodes, mydynamo.NewDynamoNode("localhost", strconv.Itoa(8080+i)))
+	}
+	return nodes
+}
+
+func TestRingPreferenceList(t *testing.T) {
+	nodes := makeNodeList(5)
+	ring := mydynamo.NewRing(nodes, mydynamo.VIRTUAL_NODES)
+
+	// every key should map to N distinct nodes
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		indices := ring.PreferenceIndices(key, 3)
+		if len(indices) != 3 {
+			t.Fatalf("TestRingPreferenceList: expected 3 replicas for %v, got %v", key, len(indices))
+		}
+		seen := make(map[int]bool)
+		for _, idx := range indices {
+			if seen[idx] {
+				t.Errorf("TestRingPreferenceList: replica %v listed twice for %v", idx, key)
+			}
+			seen[idx] = true
+		}
+	}
+
+	// N larger than the cluster is capped at the cluster size
+	if len(ring.PreferenceIndices("s1", 10)) != 5 {
+		t.Errorf("TestRingPreferenceList: N was not capped at the cluster size")
+	}
+}
+
+func TestRingOrderIndependent(t *testing.T) {
+	nodes := makeNodeList(5)
+	ring := mydynamo.NewRing(nodes, mydynamo.VIRTUAL_NODES)
+
+	// a rotated membership list must produce the same placement of keys
+	rotated := mydynamo.RotateServerList(makeNodeList(5))
+	rotatedRing := mydynamo.NewRing(rotated, mydynamo.VIRTUAL_NODES)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		list := ring.PreferenceList(key, 3)
+		rotatedList := rotatedRing.PreferenceList(key, 3)
+		for j := range list {
+			if !list[j].Equals(rotatedList[j]) {
+				t.Fatalf("TestRingOrderIndependent: placement of %v depends on membership order", key)
+			}
+		}
+	}
+}
+
+func TestRingSpreadsKeys(t *testing.T) {
+	nodes := makeNodeList(5)
+	ring := mydynamo.NewRing(nodes, mydynamo.VIRTUAL_NODES)
+
+	counts := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		counts[ring.PreferenceIndices("key"+strconv.Itoa(i), 1)[0]]++
+	}
+	for i := range nodes {
+		if counts[i] == 0 {
+			t.Errorf("TestRingSpreadsKeys: node %v does not own any keys", i)
+		}
+	}
+}
+
+func TestPartitionedPut(t *testing.T) {
+	t.Logf("Starting partitioned Put test")
+	cmd := InitDynamoServer("./partition.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	// Put through every node, including ones that do not replicate the key
+	for port := 8080; port < 8085; port++ {
+		key := "s" + strconv.Itoa(port)
+		clientInstance := MakeConnectedClient(port)
+		if !clientInstance.Put(PutFreshContext(key, []byte("abcde"))) {
+			t.Errorf("TestPartitionedPut: Put of %v through %v failed", key, port)
+		}
+		clientInstance.Gossip()
+	}
+
+	for port := 8080; port < 8085; port++ {
+		key := "s" + strconv.Itoa(port)
+		gotValuePtr := MakeConnectedClient(8084 - (port - 8080)).Get(key)
+		if gotValuePtr == nil {
+			t.Fatalf("TestPartitionedPut: Failed to get %v", key)
+		}
+		gotValue := *gotValuePtr
+		if len(gotValue.EntryList) != 1 || !valuesEqual(gotValue.EntryList[0].Value, []byte("abcde")) {
+			t.Errorf("TestPartitionedPut: Failed to get value of %v", key)
+		}
+
+		// only n_value nodes should hold a copy of the key
+		holders := 0
+		for p := 8080; p < 8085; p++ {
+			conn, err := rpc.DialHTTP("tcp", "localhost:"+strconv.Itoa(p))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var local mydynamo.DynamoResult
+			if err := conn.Call("MyDynamo.GetOnce", key, &local); err == nil && len(local.EntryList) > 0 {
+				holders++
+			}
+			conn.Close()
+		}
+		if holders != 3 {
+			t.Errorf("TestPartitionedPut: %v is stored on %v nodes, expected 3", key, holders)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package mydynamotest
+
+import (
+	"mydynamo"
+	"testing"
+	"time"
+)
+
+//Returns the ports of the replicas of key followed by the ports of the nodes
+//that stand in for them, in ring order
+func ringPorts(key string, clusterSize int) []int {
+	ring := mydynamo.NewRing(makeNodeList(clusterSize), mydynamo.VIRTUAL_NODES)
+	ports := make([]int, 0)
+	for _, idx := range ring.PreferenceIndices(key, clusterSize) {
+		ports = append(ports, 8080+idx)
+	}
+	return ports
+}
+
+func TestHintedHandoff(t *testing.T) {
+	t.Logf("Starting hinted handoff test")
+	cmd := InitDynamoServer("./sloppy.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	ports := ringPorts("s1", 5)
+	coordinator := MakeConnectedClient(ports[0])
+	owner := MakeConnectedClient(ports[2])
+	holder := MakeConnectedClient(ports[3])
+
+	// with one replica down, the first node past the top N takes a hint so W=3 is still met
+	owner.Crash(2)
+	if !coordinator.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Fatalf("TestHintedHandoff: Put with a hint returned false")
+	}
+	stored := getOnceAll(t, "s1", 5)
+	if len(stored[ports[3]-8080]) != 0 {
+		t.Errorf("TestHintedHandoff: hint holder stored the hinted write as its own")
+	}
+
+	// once the owner recovers, the hint holder delivers the write
+	time.Sleep(2 * time.Second)
+	holder.Gossip()
+	stored = getOnceAll(t, "s1", 5)
+	entries := stored[ports[2]-8080]
+	if len(entries) != 1 || !valuesEqual(entries[0].Value, []byte("abcde")) {
+		t.Errorf("TestHintedHandoff: hint was not delivered to its owner")
+	}
+}
+
+func TestSloppyQuorumFails(t *testing.T) {
+	t.Logf("Starting sloppy quorum failure test")
+	cmd := InitDynamoServer("./sloppy.ini")
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	// one replica and both stand-ins down leaves only two nodes to write to
+	ports := ringPorts("s1", 5)
+	coordinator := MakeConnectedClient(ports[0])
+	MakeConnectedClient(ports[1]).Crash(3)
+	MakeConnectedClient(ports[3]).Crash(3)
+	MakeConnectedClient(ports[4]).Crash(3)
+	if coordinator.Put(PutFreshContext("s1", []byte("abcde"))) {
+		t.Errorf("TestSloppyQuorumFails: Put returned true without W acknowledgements")
+	}
+}
@@ -0,0 +1,547 @@
+package mydynamotest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mydynamo"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeSiblings() []mydynamo.ObjectEntry {
+	clock1 := mydynamo.NewVectorClock()
+	clock1.Increment("0")
+	clock2 := mydynamo.NewVectorClock()
+	clock2.Increment("1")
+	clock2.Increment("1")
+	return []mydynamo.ObjectEntry{
+		mydynamo.NewObjectEntry(mydynamo.NewContext(clock1), []byte("abcde")),
+		mydynamo.NewObjectEntry(mydynamo.NewContext(clock2), []byte("efghi")),
+	}
+}
+
+func checkSiblings(t *testing.T, store mydynamo.Storage, key string, expected []mydynamo.ObjectEntry) {
+	entries, ok := store.Get(key)
+	if !ok {
+		t.Fatalf("checkSiblings: key %v was not recovered", key)
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("checkSiblings: key %v has %v siblings, expected %v", key, len(entries), len(expected))
+	}
+	for i := range expected {
+		if !valuesEqual(entries[i].Value, expected[i].Value) {
+			t.Errorf("checkSiblings: key %v sibling %v has wrong value", key, i)
+		}
+		if !entries[i].Context.Clock.Equals(expected[i].Context.Clock) {
+			t.Errorf("checkSiblings: key %v sibling %v has wrong clock", key, i)
+		}
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	store := mydynamo.NewMemoryStorage()
+	siblings := makeSiblings()
+	store.Put("s2", siblings)
+	store.Put("s1", siblings[:1])
+
+	checkSiblings(t, store, "s1", siblings[:1])
+	checkSiblings(t, store, "s2", siblings)
+	if _, ok := store.Get("s3"); ok {
+		t.Errorf("TestMemoryStorage: found a key that was never stored")
+	}
+	keys := store.Keys()
+	if len(keys) != 2 || keys[0] != "s1" || keys[1] != "s2" {
+		t.Errorf("TestMemoryStorage: Keys returned %v", keys)
+	}
+}
+
+func TestDiskStorageRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("s1", siblings[:1])
+	store.Put("s2", siblings)
+	store.Put("s1", siblings)
+
+	// reopen without closing, as if the node was killed, so only the log is left
+	recovered, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSiblings(t, recovered, "s1", siblings)
+	checkSiblings(t, recovered, "s2", siblings)
+
+	// a clean shutdown leaves everything in the snapshot
+	if err := recovered.Close(); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err = mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSiblings(t, recovered, "s1", siblings)
+	checkSiblings(t, recovered, "s2", siblings)
+	if len(recovered.Keys()) != 2 {
+		t.Errorf("TestDiskStorageRecovery: recovered %v keys, expected 2", len(recovered.Keys()))
+	}
+	recovered.Close()
+}
+
+func TestDiskStorageSnapshotAndLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// write enough records to force a snapshot, then a few more that only live in the log
+	for i := 0; i < mydynamo.SNAPSHOT_INTERVAL+10; i++ {
+		store.Put("k"+strconv.Itoa(i), siblings[i%2:])
+	}
+
+	recovered, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered.Keys()) != mydynamo.SNAPSHOT_INTERVAL+10 {
+		t.Fatalf("TestDiskStorageSnapshotAndLog: recovered %v keys", len(recovered.Keys()))
+	}
+	checkSiblings(t, recovered, "k0", siblings)
+	checkSiblings(t, recovered, "k"+strconv.Itoa(mydynamo.SNAPSHOT_INTERVAL+9), siblings[1:])
+}
+
+func TestDiskStorageTornWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("s1", siblings)
+
+	// simulate a crash in the middle of appending a record
+	wal, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wal.Write([]byte{0, 0, 1, 0, 1, 2})
+	wal.Close()
+
+	recovered, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSiblings(t, recovered, "s1", siblings)
+
+	// a write after recovery must not land behind the torn record
+	recovered.Put("s2", siblings[1:])
+	reopened, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSiblings(t, reopened, "s1", siblings)
+	checkSiblings(t, reopened, "s2", siblings[1:])
+}
+
+func TestDiskStorageCorruptRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewDiskStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("s1", siblings)
+	store.Put("s2", siblings[1:])
+	walPath := filepath.Join(dir, "wal.log")
+	data, err := ioutil.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a corrupt record followed by valid ones is not a torn tail, so the store
+	// refuses to open rather than cut off the records after it
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)/4] ^= 0xff
+	if err := ioutil.WriteFile(walPath, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mydynamo.NewDiskStorage(dir); err == nil {
+		t.Errorf("TestDiskStorageCorruptRecord: opened a log with a corrupt record")
+	}
+	if after, _ := ioutil.ReadFile(walPath); !bytes.Equal(after, corrupt) {
+		t.Errorf("TestDiskStorageCorruptRecord: the log was changed from %v to %v bytes", len(corrupt), len(after))
+	}
+
+	// so does a header claiming a 4 GiB record, which is not worth allocating
+	huge := append(append([]byte{}, data...), 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1)
+	if err := ioutil.WriteFile(walPath, huge, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mydynamo.NewDiskStorage(dir); err == nil {
+		t.Errorf("TestDiskStorageCorruptRecord: opened a log with a corrupt length")
+	}
+}
+
+//Puts two concurrent versions of a key, restarts the cluster from the same data
+//directories and checks that both versions come back
+func checkRestart(t *testing.T, configPath string) {
+	os.RemoveAll("./dynamo_data")
+	defer os.RemoveAll("./dynamo_data")
+
+	cmd := InitDynamoServer(configPath)
+	ready := make(chan bool)
+	go StartDynamoServer(cmd, ready)
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	clientInstance0 := MakeConnectedClient(8080)
+	clientInstance1 := MakeConnectedClient(8081)
+	clientInstance0.Put(PutFreshContext("s1", []byte("abcde")))
+	clientInstance1.Put(PutFreshContext("s1", []byte("efghi")))
+	clientInstance0.Gossip()
+	clientInstance1.Gossip()
+	KillDynamoServer(cmd)
+	cmd.Wait()
+
+	// restart the cluster from the same data directories
+	cmd = InitDynamoServer(configPath)
+	go StartDynamoServer(cmd, ready)
+	defer KillDynamoServer(cmd)
+	time.Sleep(3 * time.Second)
+	<-ready
+
+	gotValuePtr := MakeConnectedClient(8082).Get("s1")
+	if gotValuePtr == nil {
+		t.Fatalf("checkRestart: Failed to get")
+	}
+	gotValue := *gotValuePtr
+	if len(gotValue.EntryList) != 2 {
+		t.Fatalf("checkRestart: recovered %v siblings, expected 2", len(gotValue.EntryList))
+	}
+	for _, entry := range gotValue.EntryList {
+		if valuesEqual(entry.Value, []byte("abcde")) && !entry.Context.Clock.VersionIs("0", 1) {
+			t.Errorf("checkRestart: wrong clock for first sibling")
+		}
+		if valuesEqual(entry.Value, []byte("efghi")) && !entry.Context.Clock.VersionIs("1", 1) {
+			t.Errorf("checkRestart: wrong clock for second sibling")
+		}
+	}
+}
+
+func TestDiskRestart(t *testing.T) {
+	t.Logf("Starting disk restart test")
+	checkRestart(t, "./disk.ini")
+}
+
+func TestLSMRestart(t *testing.T) {
+	t.Logf("Starting LSM restart test")
+	checkRestart(t, "./lsm.ini")
+}
+
+func TestMergeSiblings(t *testing.T) {
+	older := mydynamo.NewVectorClock()
+	older.Increment("0")
+	newer := mydynamo.NewVectorClock()
+	newer.Increment("0")
+	newer.Increment("0")
+	concurrent := mydynamo.NewVectorClock()
+	concurrent.Increment("1")
+
+	olderEntry := mydynamo.NewObjectEntry(mydynamo.NewContext(older), []byte("abcde"))
+	newerEntry := mydynamo.NewObjectEntry(mydynamo.NewContext(newer), []byte("bcdef"))
+	concurrentEntry := mydynamo.NewObjectEntry(mydynamo.NewContext(concurrent), []byte("cdefg"))
+
+	merged := mydynamo.MergeSiblings(
+		[]mydynamo.ObjectEntry{olderEntry, concurrentEntry},
+		[]mydynamo.ObjectEntry{newerEntry, concurrentEntry},
+	)
+	if len(merged) != 2 {
+		t.Fatalf("TestMergeSiblings: merged to %v entries, expected 2", len(merged))
+	}
+	for _, entry := range merged {
+		if entry.Context.Clock.Equals(older) {
+			t.Errorf("TestMergeSiblings: kept an obsolete version")
+		}
+	}
+}
+
+func TestLSMStorageFlushAndCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrite the same keys with causally newer versions, flushing a table each round
+	clock := mydynamo.NewVectorClock()
+	for round := 0; round < mydynamo.COMPACTION_THRESHOLD; round++ {
+		clock.Increment("0")
+		entry := mydynamo.NewObjectEntry(mydynamo.NewContext(clock), []byte(strconv.Itoa(round)))
+		for i := 0; i < mydynamo.MEMTABLE_SIZE; i++ {
+			store.Put("k"+strconv.Itoa(i), []mydynamo.ObjectEntry{entry})
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// closing waits for the background compaction to merge the tables
+	recovered, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	if recovered.TableCount() != 1 {
+		t.Errorf("TestLSMStorageFlushAndCompaction: %v tables left after compaction", recovered.TableCount())
+	}
+	if len(recovered.Keys()) != mydynamo.MEMTABLE_SIZE {
+		t.Errorf("TestLSMStorageFlushAndCompaction: recovered %v keys", len(recovered.Keys()))
+	}
+	latest := mydynamo.NewObjectEntry(mydynamo.NewContext(clock), []byte(strconv.Itoa(mydynamo.COMPACTION_THRESHOLD-1)))
+	checkSiblings(t, recovered, "k0", []mydynamo.ObjectEntry{latest})
+	checkSiblings(t, recovered, "k"+strconv.Itoa(mydynamo.MEMTABLE_SIZE-1), []mydynamo.ObjectEntry{latest})
+}
+
+func TestLSMStorageCloseDuringFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	siblings := makeSiblings()
+	for i := 0; i < (mydynamo.COMPACTION_THRESHOLD-1)*mydynamo.MEMTABLE_SIZE+1; i++ {
+		store.Put("k"+strconv.Itoa(i), siblings)
+	}
+
+	// the flush made by Close reaches the compaction threshold, which must not
+	// start a compaction on the tables Close is about to close
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tables, _ := filepath.Glob(filepath.Join(dir, "*.sst"))
+	time.Sleep(200 * time.Millisecond)
+	if after, _ := filepath.Glob(filepath.Join(dir, "*.sst")); len(after) != len(tables) || len(tables) != mydynamo.COMPACTION_THRESHOLD {
+		t.Errorf("TestLSMStorageCloseDuringFlush: %v tables after Close, then %v", len(tables), len(after))
+	}
+
+	recovered, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	if len(recovered.Keys()) != (mydynamo.COMPACTION_THRESHOLD-1)*mydynamo.MEMTABLE_SIZE+1 {
+		t.Errorf("TestLSMStorageCloseDuringFlush: recovered %v keys", len(recovered.Keys()))
+	}
+	checkSiblings(t, recovered, "k0", siblings)
+}
+
+func TestLSMStorageRecovery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// enough keys for one table, plus a few that only live in the memtable
+	for i := 0; i < mydynamo.MEMTABLE_SIZE+10; i++ {
+		store.Put("k"+strconv.Itoa(i), siblings[i%2:])
+	}
+	if _, ok := store.Get("missing"); ok {
+		t.Errorf("TestLSMStorageRecovery: found a key that was never stored")
+	}
+
+	// reopen without closing, as if the node was killed
+	recovered, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered.TableCount() != 1 {
+		t.Errorf("TestLSMStorageRecovery: recovered %v tables, expected 1", recovered.TableCount())
+	}
+	if len(recovered.Keys()) != mydynamo.MEMTABLE_SIZE+10 {
+		t.Fatalf("TestLSMStorageRecovery: recovered %v keys", len(recovered.Keys()))
+	}
+	checkSiblings(t, recovered, "k0", siblings)
+	checkSiblings(t, recovered, "k"+strconv.Itoa(mydynamo.MEMTABLE_SIZE+9), siblings[1:])
+}
+
+func TestStorageDelete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	for _, engine := range []string{mydynamo.STORAGE_MEMORY, mydynamo.STORAGE_DISK, mydynamo.STORAGE_LSM} {
+		engineDir := filepath.Join(dir, engine)
+		store, err := mydynamo.NewStorage(engine, engineDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.Put("s1", siblings)
+		store.Put("s2", siblings)
+		store.Delete("s1")
+		if _, ok := store.Get("s1"); ok {
+			t.Errorf("TestStorageDelete: %v engine still holds deleted key", engine)
+		}
+		if keys := store.Keys(); len(keys) != 1 || keys[0] != "s2" {
+			t.Errorf("TestStorageDelete: %v engine returned keys %v", engine, keys)
+		}
+
+		// a Put after a delete only holds the new versions
+		store.Put("s1", siblings[1:])
+		checkSiblings(t, store, "s1", siblings[1:])
+		if engine == mydynamo.STORAGE_MEMORY {
+			continue
+		}
+
+		// the delete survives a restart
+		recovered, err := mydynamo.NewStorage(engine, engineDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSiblings(t, recovered, "s1", siblings[1:])
+		checkSiblings(t, recovered, "s2", siblings)
+	}
+}
+
+func TestLSMStorageDeleteAcrossTables(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flush s1 to a table, then delete it in a later table
+	store.Put("s1", siblings)
+	for i := 1; i < mydynamo.MEMTABLE_SIZE; i++ {
+		store.Put("k"+strconv.Itoa(i), siblings)
+	}
+	store.Delete("s1")
+	for i := 1; i < mydynamo.MEMTABLE_SIZE; i++ {
+		store.Put("j"+strconv.Itoa(i), siblings)
+	}
+	if store.TableCount() != 2 {
+		t.Fatalf("TestLSMStorageDeleteAcrossTables: expected 2 tables, got %v", store.TableCount())
+	}
+	if _, ok := store.Get("s1"); ok {
+		t.Errorf("TestLSMStorageDeleteAcrossTables: deleted key is visible through an older table")
+	}
+	if len(store.Keys()) != 2*(mydynamo.MEMTABLE_SIZE-1) {
+		t.Errorf("TestLSMStorageDeleteAcrossTables: Keys returned %v keys", len(store.Keys()))
+	}
+}
+
+func TestLSMStorageCrashDuringCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydynamo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	siblings := makeSiblings()
+	store, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// k lives in the first table and is deleted in the second, which fills
+	// three tables as k takes a slot in each of the first two
+	store.Put("k", siblings)
+	for i := 1; i < (mydynamo.COMPACTION_THRESHOLD-1)*mydynamo.MEMTABLE_SIZE-1; i++ {
+		if i == mydynamo.MEMTABLE_SIZE {
+			store.Delete("k")
+		}
+		store.Put("s"+strconv.Itoa(i), siblings)
+	}
+	inputs, _ := filepath.Glob(filepath.Join(dir, "*.sst"))
+	saved := make(map[string][]byte)
+	for _, input := range inputs {
+		saved[input], _ = ioutil.ReadFile(input)
+	}
+
+	// the next flush compacts every table into one without k
+	for i := 0; i < mydynamo.MEMTABLE_SIZE; i++ {
+		store.Put("t"+strconv.Itoa(i), siblings)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	merged, _ := filepath.Glob(filepath.Join(dir, "*.sst"))
+	if len(merged) != 1 {
+		t.Fatalf("TestLSMStorageCrashDuringCompaction: %v tables after compaction", len(merged))
+	}
+
+	// put the disk back as a crash leaves it after the merged table is committed
+	// but before the older inputs are removed
+	if err := os.Rename(merged[0], strings.TrimSuffix(merged[0], ".sst")+".compact"); err != nil {
+		t.Fatal(err)
+	}
+	for input, content := range saved {
+		ioutil.WriteFile(input, content, 0644)
+	}
+
+	recovered, err := mydynamo.NewLSMStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recovered.Close()
+	if recovered.TableCount() != 1 {
+		t.Errorf("TestLSMStorageCrashDuringCompaction: recovered %v tables, expected 1", recovered.TableCount())
+	}
+	if _, ok := recovered.Get("k"); ok {
+		t.Errorf("TestLSMStorageCrashDuringCompaction: deleted key came back")
+	}
+	if len(recovered.Keys()) != mydynamo.COMPACTION_THRESHOLD*mydynamo.MEMTABLE_SIZE-2 {
+		t.Errorf("TestLSMStorageCrashDuringCompaction: recovered %v keys", len(recovered.Keys()))
+	}
+	checkSiblings(t, recovered, "s1", siblings)
+	checkSiblings(t, recovered, "t0", siblings)
+}
@@ -61,6 +61,16 @@ func valuesEqual(v1 []byte, v2 []byte) bool {
 	return true
 }
 
+//Tests if any entry in entries holds value
+func entriesContain(entries []mydynamo.ObjectEntry, value []byte) bool {
+	for _, entry := range entries {
+		if valuesEqual(entry.Value, value) {
+			return true
+		}
+	}
+	return false
+}
+
 func setClusterSize(configFilePath string) {
 	configContent, err := ini.Load(configFilePath)
 	if err != nil {
@@ -333,3 +333,95 @@ func TestCombineVectorClock(t *testing.T) {
 		}
 	} // end of iterations
 }
+
+//Returns a clock holding version 1 of every id in ids, incremented in order
+func clockOf(ids ...string) mydynamo.VectorClock {
+	clock	:= mydynamo.NewVectorClock()
+	for _, id := range ids {
+		clock.Increment(id)
+	}
+	return clock
+}
+
+//Returns the ids "first" up to but not including "last"
+func idRange(first, last int) []string {
+	ids	:= make([]string, 0, last-first)
+	for i := first; i < last; i++ {
+		ids	= append(ids, strconv.Itoa(i))
+	}
+	return ids
+}
+
+func TestTruncateVectorClock(t *testing.T) {
+	// one element more than a clock keeps drops the one updated longest ago
+	clock	:= clockOf(idRange(0, mydynamo.DEFAULT_MAX_CLOCK_SIZE+1)...)
+	if len(clock.Elements) != mydynamo.DEFAULT_MAX_CLOCK_SIZE || len(clock.Pruned) != 1 {
+		t.Fatalf("clock was not truncated: %s", mydynamo.PrintFormatVectorClock(clock))
+	}
+	if _, ok := clock.Elements["0"]; ok {
+		t.Errorf("truncation kept the oldest element")
+	}
+
+	// updating an element moves it to the back of the line
+	clock.Increment("1")
+	clock.Increment(strconv.Itoa(mydynamo.DEFAULT_MAX_CLOCK_SIZE + 1))
+	if !clock.VersionIs("1", 2) {
+		t.Errorf("truncation dropped a recently updated element")
+	}
+	if _, ok := clock.Elements["2"]; ok {
+		t.Errorf("truncation kept the oldest element")
+	}
+
+	// replicas that truncate the same clock agree on the result
+	ids	:= idRange(0, mydynamo.DEFAULT_MAX_CLOCK_SIZE)
+	a, b	:= clockOf(ids...), clockOf(ids...)
+	extra	:= clockOf("x")
+	a.Combine([]mydynamo.VectorClock{extra})
+	b.Combine([]mydynamo.VectorClock{extra})
+	if !a.Equals(b) || len(a.Pruned) != 1 {
+		t.Errorf("combining the same clocks gave %s and %s", mydynamo.PrintFormatVectorClock(a), mydynamo.PrintFormatVectorClock(b))
+	}
+}
+
+func TestTruncationIsConservative(t *testing.T) {
+	ids	:= idRange(0, mydynamo.DEFAULT_MAX_CLOCK_SIZE)
+	ancestor	:= clockOf(ids...)
+	newer	:= clockOf(ids...)
+	newer.Increment("new")
+	if _, ok := newer.Elements["0"]; ok {
+		t.Fatalf("clock was not truncated: %s", mydynamo.PrintFormatVectorClock(newer))
+	}
+
+	// the newer version no longer shows it descends from its ancestor, so the
+	// two become siblings, but the newer one is never taken for the ancestor
+	if newer.LessThan(ancestor) || ancestor.LessThan(newer) || !newer.Concurrent(ancestor) {
+		t.Errorf("truncated clock was ordered against its ancestor")
+	}
+
+	// a version that never saw the dropped element covers every element the
+	// truncated clock kept, yet it must not supersede it
+	other	:= clockOf(append(ids[1:], "new")...)
+	other.Increment("1")
+	if newer.LessThan(other) || !newer.Concurrent(other) {
+		t.Errorf("truncated clock was taken for an ancestor of a concurrent version")
+	}
+	merged	:= mydynamo.MergeSiblings(
+		[]mydynamo.ObjectEntry{mydynamo.NewObjectEntry(mydynamo.NewContext(newer), []byte("newer"))},
+		[]mydynamo.ObjectEntry{mydynamo.NewObjectEntry(mydynamo.NewContext(other), []byte("other"))})
+	if len(merged) != 2 {
+		t.Errorf("a sibling was lost: %v", merged)
+	}
+
+	// writes made on top of the truncated clock still supersede it
+	descendant	:= mydynamo.NewVectorClock()
+	descendant.Combine([]mydynamo.VectorClock{newer})
+	descendant.Increment("5")
+	if !newer.LessThan(descendant) || descendant.LessThan(newer) {
+		t.Errorf("truncated clock is not an ancestor of its descendant")
+	}
+	resolved	:= mydynamo.NewVectorClock()
+	resolved.Combine([]mydynamo.VectorClock{newer, other})
+	if !newer.LessThan(resolved) || !other.LessThan(resolved) {
+		t.Errorf("combined clock does not descend from both siblings")
+	}
+}